@@ -0,0 +1,11 @@
+-- Named template fragments persona prompts can include with {{template "name" .}}.
+CREATE TABLE prompt_partials (
+    partial_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The persona prompt rendered for a stage run before it was dispatched.
+ALTER TABLE stage_runs ADD COLUMN prompt TEXT;
@@ -0,0 +1,13 @@
+-- History of project status transitions. from_status is NULL for the event
+-- recorded when the project is created.
+CREATE TABLE project_events (
+    event_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    from_status project_status,
+    to_status project_status NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_project_events_project_id ON project_events (project_id, created_at);
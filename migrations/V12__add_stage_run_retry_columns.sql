@@ -0,0 +1,7 @@
+ALTER TABLE stage_runs ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE stage_runs ADD COLUMN last_error TEXT;
+ALTER TABLE stage_runs ADD COLUMN error_class TEXT;
+-- A re-queued run is not picked up before this time.
+ALTER TABLE stage_runs ADD COLUMN next_attempt_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_stage_runs_pending_next_attempt ON stage_runs (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- The orchestrator replica executing a running stage run holds a lease on it
+-- until lease_expires_at; expired leases are reclaimed by other replicas.
+ALTER TABLE stage_runs ADD COLUMN lease_owner TEXT;
+ALTER TABLE stage_runs ADD COLUMN lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_stage_runs_running_lease_expiry ON stage_runs (lease_expires_at) WHERE status = 'running';
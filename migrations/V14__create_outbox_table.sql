@@ -0,0 +1,15 @@
+-- Events written in the same transaction as the state change they describe.
+-- A relay publishes undelivered rows to the event bus in id order.
+CREATE TABLE outbox (
+    outbox_id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    stream TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    envelope JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_outbox_undelivered ON outbox (outbox_id) WHERE delivered_at IS NULL;
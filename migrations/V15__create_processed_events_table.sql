@@ -0,0 +1,15 @@
+-- Events a consumer has handled, so redelivered events are skipped.
+CREATE TABLE processed_events (
+    consumer TEXT NOT NULL,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (consumer, event_id)
+);
+
+CREATE INDEX idx_processed_events_processed_at ON processed_events (processed_at);
+
+-- A stage has at most one pending or running run per project, however many
+-- schedulers race to create it.
+CREATE UNIQUE INDEX idx_stage_runs_one_active_per_stage ON stage_runs (project_id, stage_name)
+    WHERE status IN ('pending', 'running');
@@ -0,0 +1,8 @@
+-- Runs of stages that require review wait in completed until a person
+-- approves or rejects their output; the decision is kept on the run.
+ALTER TABLE stage_runs ADD COLUMN review_required BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE stage_runs ADD COLUMN reviewed_by TEXT;
+ALTER TABLE stage_runs ADD COLUMN review_comment TEXT;
+ALTER TABLE stage_runs ADD COLUMN reviewed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_stage_runs_pending_review ON stage_runs (completed_at) WHERE status = 'completed' AND review_required;
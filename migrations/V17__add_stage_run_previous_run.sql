@@ -0,0 +1,3 @@
+-- A stage run created because a reviewer rejected an earlier attempt points
+-- back at that attempt.
+ALTER TABLE stage_runs ADD COLUMN previous_run_id UUID REFERENCES stage_runs(stage_run_id) ON DELETE SET NULL;
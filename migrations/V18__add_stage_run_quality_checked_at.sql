@@ -0,0 +1,8 @@
+-- A completed run is marked once the quality gate has looked at it, so runs
+-- whose orchestrator stopped between finishing and evaluating them can be
+-- found and evaluated later. Runs finished before this column existed were
+-- already handled.
+ALTER TABLE stage_runs ADD COLUMN quality_checked_at TIMESTAMP WITH TIME ZONE;
+UPDATE stage_runs SET quality_checked_at = completed_at WHERE status NOT IN ('pending', 'running');
+
+CREATE INDEX idx_stage_runs_quality_unchecked ON stage_runs (completed_at) WHERE status = 'completed' AND quality_checked_at IS NULL;
@@ -0,0 +1,2 @@
+-- Delivered messages are pruned once they are older than the retention period.
+CREATE INDEX idx_outbox_delivered ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- A run that succeeded is marked once its declared outputs are on the Context
+-- Bus, so outputs whose publication failed or was interrupted can be
+-- published later. Runs that succeeded before this column existed were
+-- already published.
+ALTER TABLE stage_runs ADD COLUMN outputs_published_at TIMESTAMP WITH TIME ZONE;
+UPDATE stage_runs SET outputs_published_at = updated_at WHERE status IN ('completed', 'approved');
+
+CREATE INDEX idx_stage_runs_unpublished ON stage_runs (updated_at) WHERE status IN ('completed', 'approved') AND outputs_published_at IS NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE workflows (
+    workflow_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    definition JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE projects ADD COLUMN workflow_id UUID REFERENCES workflows(workflow_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_projects_workflow_id ON projects (workflow_id);
@@ -0,0 +1,12 @@
+CREATE TABLE context_entries (
+    project_id UUID NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    value JSONB NOT NULL,
+    stage_run_id UUID REFERENCES stage_runs(stage_run_id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, key, version)
+);
+
+CREATE INDEX idx_context_entries_stage_run_id ON context_entries (stage_run_id);
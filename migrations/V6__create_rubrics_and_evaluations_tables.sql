@@ -0,0 +1,27 @@
+CREATE TABLE rubrics (
+    rubric_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    persona_id UUID NOT NULL UNIQUE REFERENCES personas(persona_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    criteria JSONB NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    on_failure TEXT NOT NULL DEFAULT 'fail',
+    max_reruns INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TYPE evaluation_verdict AS ENUM ('pass', 'fail');
+
+CREATE TABLE stage_run_evaluations (
+    evaluation_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    stage_run_id UUID NOT NULL REFERENCES stage_runs(stage_run_id) ON DELETE CASCADE,
+    rubric_id UUID REFERENCES rubrics(rubric_id) ON DELETE SET NULL,
+    scores JSONB NOT NULL,
+    overall_score DOUBLE PRECISION NOT NULL,
+    verdict evaluation_verdict NOT NULL,
+    comments TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stage_run_evaluations_stage_run_id ON stage_run_evaluations (stage_run_id);
+CREATE INDEX idx_stage_run_evaluations_rubric_id ON stage_run_evaluations (rubric_id);
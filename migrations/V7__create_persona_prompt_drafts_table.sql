@@ -0,0 +1,18 @@
+CREATE TYPE prompt_draft_status AS ENUM ('pending', 'accepted', 'rejected');
+
+CREATE TABLE persona_prompt_drafts (
+    draft_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    persona_id UUID NOT NULL REFERENCES personas(persona_id) ON DELETE CASCADE,
+    base_prompt_template TEXT NOT NULL,
+    proposed_prompt_template TEXT NOT NULL,
+    rationale TEXT,
+    status prompt_draft_status NOT NULL DEFAULT 'pending',
+    decided_by TEXT,
+    decided_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- At most one draft per persona awaits a decision at any time.
+CREATE UNIQUE INDEX idx_persona_prompt_drafts_pending ON persona_prompt_drafts (persona_id) WHERE status = 'pending';
+CREATE INDEX idx_persona_prompt_drafts_status ON persona_prompt_drafts (status);
@@ -0,0 +1,23 @@
+CREATE TABLE persona_versions (
+    persona_version_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    persona_id UUID NOT NULL REFERENCES personas(persona_id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    prompt_template TEXT NOT NULL,
+    model_config JSONB,
+    -- Set when this version was created by rolling back to an earlier one.
+    rolled_back_from INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (persona_id, version)
+);
+
+-- personas keeps a copy of the current version's prompt and model config so
+-- existing readers are unaffected; current_version points at the version row.
+ALTER TABLE personas ADD COLUMN current_version INTEGER NOT NULL DEFAULT 1;
+
+INSERT INTO persona_versions (persona_id, version, prompt_template, model_config, created_at)
+SELECT persona_id, 1, prompt_template, model_config, COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM personas;
+
+ALTER TABLE stage_runs ADD COLUMN persona_version_id UUID REFERENCES persona_versions(persona_version_id);
+
+CREATE INDEX idx_stage_runs_persona_version_id ON stage_runs (persona_version_id);
@@ -0,0 +1,5 @@
+-- Deleting a persona removes its versions; stage runs keep their history but
+-- lose the link to the version they ran with.
+ALTER TABLE stage_runs DROP CONSTRAINT stage_runs_persona_version_id_fkey;
+ALTER TABLE stage_runs ADD CONSTRAINT stage_runs_persona_version_id_fkey
+    FOREIGN KEY (persona_version_id) REFERENCES persona_versions(persona_version_id) ON DELETE SET NULL;
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"workflow-engine/store"
+)
+
+// listContextEntries lists the latest version of every Context Bus key in a
+// project, ordered by key.
+func (s *Server) listContextEntries(w http.ResponseWriter, r *http.Request, params []string) error {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return err
+	}
+	project, err := s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	snapshot, err := s.context.Snapshot(r.Context(), project.ID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	keys = keys[offset:]
+	if len(keys) > limit+1 {
+		keys = keys[:limit+1]
+	}
+	page, n := newPage(limit, offset, len(keys))
+	views := make([]contextEntryView, 0, n)
+	for _, key := range keys[:n] {
+		views = append(views, newContextEntryView(snapshot[key]))
+	}
+	page.Items = views
+	writeJSON(w, http.StatusOK, page)
+	return nil
+}
+
+// getContextEntry returns the latest version of a Context Bus key, or the
+// version given by the version query parameter.
+func (s *Server) getContextEntry(w http.ResponseWriter, r *http.Request, params []string) error {
+	project, err := s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	key := params[1]
+
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			return errInvalid("version must be a positive integer, got %q", v)
+		}
+	}
+	var entry *store.ContextEntry
+	if version > 0 {
+		entry, err = s.context.Get(r.Context(), project.ID, key, version)
+	} else {
+		entry, err = s.context.Latest(r.Context(), project.ID, key)
+	}
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		if version > 0 {
+			return errNotFound("context key %s of project %s has no version %d", key, project.ID, version)
+		}
+		return errNotFound("context key %s of project %s not found", key, project.ID)
+	}
+	writeJSON(w, http.StatusOK, newContextEntryView(entry))
+	return nil
+}
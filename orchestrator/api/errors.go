@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"workflow-engine/prompt"
+	"workflow-engine/store"
+)
+
+// Error codes returned in error bodies.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeUnprocessable    = "unprocessable"
+	CodeInternal         = "internal"
+)
+
+// Error is the body of every failed request, wrapped as {"error": ...}.
+// Fields maps request fields to what is wrong with them.
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func errNotFound(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func errInvalid(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+func errConflict(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// fieldErrors collects validation failures for a request body.
+type fieldErrors map[string]string
+
+func (f fieldErrors) add(field, problem string) {
+	if _, ok := f[field]; !ok {
+		f[field] = problem
+	}
+}
+
+// err returns nil when no field failed validation.
+func (f fieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidRequest,
+		Message: "invalid fields: " + strings.Join(names, ", "),
+		Fields:  f,
+	}
+}
+
+// apiError maps err to the error body and status sent to the client. Store
+// errors the client can act on keep their message, and so do persona prompts
+// that fail to render, for instance for a rerun a review requested; anything
+// else is logged and reported as an internal error.
+func apiError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var templateErr *prompt.TemplateError
+	var missingErr *prompt.MissingVariablesError
+	switch {
+	case errors.Is(err, store.ErrProjectNotFound),
+		errors.Is(err, store.ErrPersonaNotFound),
+		errors.Is(err, store.ErrStageRunNotFound):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: err.Error()}
+	case errors.Is(err, store.ErrProjectExists),
+		errors.Is(err, store.ErrPersonaExists),
+		errors.Is(err, store.ErrPersonaConflict),
+		errors.Is(err, store.ErrPersonaInUse),
+		errors.Is(err, store.ErrReviewNotPending),
+		errors.Is(err, store.ErrIllegalTransition):
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: err.Error()}
+	case errors.Is(err, store.ErrInvalidPersona),
+		errors.As(err, &templateErr),
+		errors.As(err, &missingErr):
+		return &Error{Status: http.StatusUnprocessableEntity, Code: CodeUnprocessable, Message: err.Error()}
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e := apiError(err)
+	if e == nil {
+		log.Printf("Error serving %s %s: %v", r.Method, r.URL.Path, err)
+		e = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error"}
+	}
+	writeJSON(w, e.Status, struct {
+		Error *Error `json:"error"`
+	}{e})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// maxBodyBytes caps the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// decodeJSON reads a single JSON object from the request body into v,
+// rejecting unknown fields and trailing data.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errInvalid("request body is empty")
+		case errors.As(err, &maxErr):
+			return &Error{Status: http.StatusRequestEntityTooLarge, Code: CodeInvalidRequest,
+				Message: "request body exceeds " + strconv.Itoa(maxBodyBytes) + " bytes"}
+		default:
+			return errInvalid("invalid JSON body: %v", err)
+		}
+	}
+	if dec.More() {
+		return errInvalid("request body must hold a single JSON object")
+	}
+	return nil
+}
+
+// Page is the body of every list response. NextOffset is set when more items
+// follow.
+type Page struct {
+	Items      interface{} `json:"items"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	NextOffset *int        `json:"next_offset,omitempty"`
+}
+
+// pageParams parses the limit and offset query parameters. Limits above
+// maxPageSize are capped.
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	limit = defaultPageSize
+	query := r.URL.Query()
+	if s := query.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return 0, 0, errInvalid("limit must be a positive integer, got %q", s)
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+	if s := query.Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errInvalid("offset must be a non-negative integer, got %q", s)
+		}
+	}
+	return limit, offset, nil
+}
+
+// newPage starts the page for fetched items read at offset, where up to
+// limit+1 items were requested; the extra item only signals that another page
+// follows. It returns how many of the items belong on the page.
+func newPage(limit, offset, fetched int) (Page, int) {
+	page := Page{Limit: limit, Offset: offset}
+	if fetched <= limit {
+		return page, fetched
+	}
+	next := offset + limit
+	page.NextOffset = &next
+	return page, limit
+}
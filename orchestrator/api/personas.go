@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+type personaRequest struct {
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	PromptTemplate string          `json:"prompt_template"`
+	ModelConfig    json.RawMessage `json:"model_config"`
+	// UpdatedAt is required when updating: it must be the updated_at last
+	// read, so concurrent edits are detected rather than overwritten.
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+func (req *personaRequest) validate(update bool) error {
+	fields := fieldErrors{}
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.Name == "":
+		fields.add("name", "is required")
+	case len(req.Name) > maxNameLength:
+		fields.add("name", "must be at most 200 characters")
+	}
+	if len(req.Description) > maxDescriptionLength {
+		fields.add("description", "must be at most 2000 characters")
+	}
+	if strings.TrimSpace(req.PromptTemplate) == "" {
+		fields.add("prompt_template", "is required")
+	}
+	config := bytes.TrimSpace(req.ModelConfig)
+	if bytes.Equal(config, []byte("null")) {
+		req.ModelConfig = nil
+	} else if len(config) > 0 && config[0] != '{' {
+		fields.add("model_config", "must be a JSON object")
+	}
+	if update && req.UpdatedAt == nil {
+		fields.add("updated_at", "is required")
+	}
+	if !update && req.UpdatedAt != nil {
+		fields.add("updated_at", "must not be set when creating a persona")
+	}
+	return fields.err()
+}
+
+func (s *Server) createPersona(w http.ResponseWriter, r *http.Request, _ []string) error {
+	var req personaRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(false); err != nil {
+		return err
+	}
+
+	persona := &store.Persona{
+		Name:           req.Name,
+		Description:    nullString(req.Description),
+		PromptTemplate: req.PromptTemplate,
+		ModelConfig:    req.ModelConfig,
+	}
+	if err := s.store.Personas.CreatePersona(r.Context(), persona); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, newPersonaView(persona))
+	return nil
+}
+
+// listPersonas lists personas by name. The name query parameter matches
+// names containing it and model matches the model in their model config.
+func (s *Server) listPersonas(w http.ResponseWriter, r *http.Request, _ []string) error {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	personas, err := s.store.Personas.ListPersonas(r.Context(), store.PersonaFilter{
+		NameContains: query.Get("name"),
+		Model:        query.Get("model"),
+		Limit:        limit + 1,
+		Offset:       offset,
+	})
+	if err != nil {
+		return err
+	}
+	page, n := newPage(limit, offset, len(personas))
+	views := make([]personaView, 0, n)
+	for _, persona := range personas[:n] {
+		views = append(views, newPersonaView(persona))
+	}
+	page.Items = views
+	writeJSON(w, http.StatusOK, page)
+	return nil
+}
+
+func (s *Server) getPersona(w http.ResponseWriter, r *http.Request, params []string) error {
+	id, err := personaID(params[0])
+	if err != nil {
+		return err
+	}
+	persona, err := s.store.Personas.GetPersona(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	if persona == nil {
+		return errNotFound("persona %s not found", id)
+	}
+	writeJSON(w, http.StatusOK, newPersonaView(persona))
+	return nil
+}
+
+// updatePersona replaces a persona's fields. A changed prompt template or
+// model config becomes the persona's next version.
+func (s *Server) updatePersona(w http.ResponseWriter, r *http.Request, params []string) error {
+	id, err := personaID(params[0])
+	if err != nil {
+		return err
+	}
+	var req personaRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(true); err != nil {
+		return err
+	}
+
+	persona := &store.Persona{
+		ID:             id,
+		Name:           req.Name,
+		Description:    nullString(req.Description),
+		PromptTemplate: req.PromptTemplate,
+		ModelConfig:    req.ModelConfig,
+		UpdatedAt:      *req.UpdatedAt,
+	}
+	if err := s.store.Personas.UpdatePersona(r.Context(), persona); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newPersonaView(persona))
+	return nil
+}
+
+func (s *Server) deletePersona(w http.ResponseWriter, r *http.Request, params []string) error {
+	id, err := personaID(params[0])
+	if err != nil {
+		return err
+	}
+	if err := s.store.Personas.DeletePersona(r.Context(), id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func personaID(id string) (uuid.UUID, error) {
+	personaID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, errNotFound("persona %s not found", id)
+	}
+	return personaID, nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength        = 200
+	maxDescriptionLength = 2000
+)
+
+type createProjectRequest struct {
+	// ID lets clients retry a create safely: a second request with the same
+	// ID fails with a conflict instead of creating another project.
+	ID          *uuid.UUID `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Workflow    string     `json:"workflow"`
+}
+
+func (req *createProjectRequest) validate() error {
+	fields := fieldErrors{}
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.Name == "":
+		fields.add("name", "is required")
+	case len(req.Name) > maxNameLength:
+		fields.add("name", "must be at most 200 characters")
+	}
+	if len(req.Description) > maxDescriptionLength {
+		fields.add("description", "must be at most 2000 characters")
+	}
+	if req.ID != nil && *req.ID == uuid.Nil {
+		fields.add("id", "must not be the nil UUID")
+	}
+	return fields.err()
+}
+
+// createProject creates a project, optionally bound to a workflow by name.
+// The workflow does not run until the project is started.
+func (s *Server) createProject(w http.ResponseWriter, r *http.Request, _ []string) error {
+	var req createProjectRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	project := &store.Project{
+		Name:        req.Name,
+		Description: nullString(req.Description),
+	}
+	if req.ID != nil {
+		project.ID = *req.ID
+	}
+	if req.Workflow != "" {
+		wf, err := s.store.Workflows.GetWorkflowByName(r.Context(), req.Workflow)
+		if err != nil {
+			return err
+		}
+		if wf == nil {
+			return fieldErrors{"workflow": "unknown workflow " + req.Workflow}.err()
+		}
+		project.WorkflowID = uuid.NullUUID{UUID: wf.ID, Valid: true}
+	}
+	if err := s.store.Projects.CreateProject(r.Context(), project); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, newProjectView(project))
+	return nil
+}
+
+func (s *Server) listProjects(w http.ResponseWriter, r *http.Request, _ []string) error {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return err
+	}
+	status := store.ProjectStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", store.ProjectStatusCreated, store.ProjectStatusRunning, store.ProjectStatusCompleted, store.ProjectStatusFailed:
+	default:
+		return errInvalid("unknown project status %q", status)
+	}
+
+	projects, err := s.store.Projects.ListProjects(r.Context(), store.ProjectFilter{
+		Status: status,
+		Limit:  limit + 1,
+		Offset: offset,
+	})
+	if err != nil {
+		return err
+	}
+	page, n := newPage(limit, offset, len(projects))
+	views := make([]projectView, 0, n)
+	for _, project := range projects[:n] {
+		views = append(views, newProjectView(project))
+	}
+	page.Items = views
+	writeJSON(w, http.StatusOK, page)
+	return nil
+}
+
+func (s *Server) getProject(w http.ResponseWriter, r *http.Request, params []string) error {
+	project, err := s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newProjectView(project))
+	return nil
+}
+
+// startProject starts a created project's workflow. Starting a project that
+// is already running only re-evaluates its stages.
+func (s *Server) startProject(w http.ResponseWriter, r *http.Request, params []string) error {
+	project, err := s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	if !project.WorkflowID.Valid {
+		return errConflict("project %s has no workflow", project.ID)
+	}
+	if project.Status != store.ProjectStatusCreated && project.Status != store.ProjectStatusRunning {
+		return errConflict("project %s is already %s", project.ID, project.Status)
+	}
+	if err := s.scheduler.StartProject(r.Context(), project.ID); err != nil {
+		return err
+	}
+
+	project, err = s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusAccepted, newProjectView(project))
+	return nil
+}
+
+// listStageRuns lists a project's stage runs, oldest first.
+func (s *Server) listStageRuns(w http.ResponseWriter, r *http.Request, params []string) error {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return err
+	}
+	project, err := s.project(r, params[0])
+	if err != nil {
+		return err
+	}
+	runs, err := s.store.StageRuns.ListStageRuns(r.Context(), store.StageRunFilter{
+		ProjectID: project.ID,
+		Limit:     limit + 1,
+		Offset:    offset,
+	})
+	if err != nil {
+		return err
+	}
+	page, n := newPage(limit, offset, len(runs))
+	views := make([]stageRunView, 0, n)
+	for _, run := range runs[:n] {
+		views = append(views, newStageRunView(run))
+	}
+	page.Items = views
+	writeJSON(w, http.StatusOK, page)
+	return nil
+}
+
+// project loads the project whose ID is the path parameter id.
+func (s *Server) project(r *http.Request, id string) (*store.Project, error) {
+	projectID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("project %s not found", id)
+	}
+	project, err := s.store.Projects.GetProject(r.Context(), projectID)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		return nil, errNotFound("project %s not found", projectID)
+	}
+	return project, nil
+}
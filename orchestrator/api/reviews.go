@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"workflow-engine/scheduler"
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+const maxCommentLength = 4000
+
+type reviewRequest struct {
+	Reviewer string `json:"reviewer"`
+	Comment  string `json:"comment"`
+	// Rerun, only allowed when rejecting, runs the stage again with the
+	// rejected output and the comment as feedback.
+	Rerun bool `json:"rerun"`
+}
+
+func (req *reviewRequest) validate(decision store.StageRunStatus) error {
+	fields := fieldErrors{}
+	req.Reviewer = strings.TrimSpace(req.Reviewer)
+	switch {
+	case req.Reviewer == "":
+		fields.add("reviewer", "is required")
+	case len(req.Reviewer) > maxNameLength:
+		fields.add("reviewer", "must be at most 200 characters")
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	switch {
+	case decision == store.StageRunStatusRejected && req.Comment == "":
+		fields.add("comment", "is required when rejecting")
+	case len(req.Comment) > maxCommentLength:
+		fields.add("comment", "must be at most 4000 characters")
+	}
+	if req.Rerun && decision != store.StageRunStatusRejected {
+		fields.add("rerun", "is only allowed when rejecting")
+	}
+	return fields.err()
+}
+
+// listPendingReviews lists completed runs waiting for a review decision, the
+// longest waiting first. The project_id query parameter narrows the list to
+// one project.
+func (s *Server) listPendingReviews(w http.ResponseWriter, r *http.Request, _ []string) error {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return err
+	}
+	filter := store.ReviewFilter{Limit: limit + 1, Offset: offset}
+	if id := r.URL.Query().Get("project_id"); id != "" {
+		projectID, err := uuid.Parse(id)
+		if err != nil {
+			return errInvalid("project_id must be a UUID, got %q", id)
+		}
+		filter.ProjectID = uuid.NullUUID{UUID: projectID, Valid: true}
+	}
+
+	runs, err := s.store.StageRuns.ListPendingReviews(r.Context(), filter)
+	if err != nil {
+		return err
+	}
+	page, n := newPage(limit, offset, len(runs))
+	views := make([]stageRunView, 0, n)
+	for _, run := range runs[:n] {
+		views = append(views, newStageRunView(run))
+	}
+	page.Items = views
+	writeJSON(w, http.StatusOK, page)
+	return nil
+}
+
+func (s *Server) getStageRun(w http.ResponseWriter, r *http.Request, params []string) error {
+	run, err := s.stageRun(r, params[0])
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newStageRunView(run))
+	return nil
+}
+
+func (s *Server) approveStageRun(w http.ResponseWriter, r *http.Request, params []string) error {
+	return s.reviewStageRun(w, r, params[0], store.StageRunStatusApproved)
+}
+
+// rejectStageRun rejects a run's output. A comment explaining the rejection
+// is required. With rerun set the stage runs again with the comment as
+// feedback; otherwise the rejection fails the project.
+func (s *Server) rejectStageRun(w http.ResponseWriter, r *http.Request, params []string) error {
+	return s.reviewStageRun(w, r, params[0], store.StageRunStatusRejected)
+}
+
+func (s *Server) reviewStageRun(w http.ResponseWriter, r *http.Request, id string, decision store.StageRunStatus) error {
+	stageRunID, err := uuid.Parse(id)
+	if err != nil {
+		return errNotFound("stage run %s not found", id)
+	}
+	var req reviewRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if err := req.validate(decision); err != nil {
+		return err
+	}
+
+	review := scheduler.Review{
+		Decision: decision,
+		Reviewer: req.Reviewer,
+		Comment:  req.Comment,
+		Rerun:    req.Rerun,
+	}
+	if err := s.scheduler.ReviewStageRun(r.Context(), stageRunID, review); err != nil {
+		return err
+	}
+	run, err := s.stageRun(r, id)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newStageRunView(run))
+	return nil
+}
+
+// stageRun loads the stage run whose ID is the path parameter id.
+func (s *Server) stageRun(r *http.Request, id string) (*store.StageRun, error) {
+	stageRunID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errNotFound("stage run %s not found", id)
+	}
+	run, err := s.store.StageRuns.GetStageRun(r.Context(), stageRunID)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, errNotFound("stage run %s not found", stageRunID)
+	}
+	return run, nil
+}
@@ -0,0 +1,125 @@
+// Package api serves the orchestrator's HTTP API: projects and their stage
+// runs, stage run reviews, personas and Context Bus entries.
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"workflow-engine/scheduler"
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+// BasePath prefixes every API route.
+const BasePath = "/api/v1"
+
+// Scheduler starts project workflows and applies review decisions.
+type Scheduler interface {
+	StartProject(ctx context.Context, projectID uuid.UUID) error
+	ReviewStageRun(ctx context.Context, stageRunID uuid.UUID, review scheduler.Review) error
+}
+
+// ContextReader reads Context Bus entries.
+type ContextReader interface {
+	Get(ctx context.Context, projectID uuid.UUID, key string, version int) (*store.ContextEntry, error)
+	Latest(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error)
+	Snapshot(ctx context.Context, projectID uuid.UUID) (map[string]*store.ContextEntry, error)
+}
+
+// handlerFunc serves a matched route. params holds the values of the route's
+// wildcard segments in order. A returned error is written as an error body.
+type handlerFunc func(w http.ResponseWriter, r *http.Request, params []string) error
+
+type route struct {
+	method  string
+	pattern []string // "*" matches any single segment
+	handle  handlerFunc
+}
+
+// Server routes API requests to handlers backed by the store.
+type Server struct {
+	store     *store.Store
+	scheduler Scheduler
+	context   ContextReader
+	routes    []route
+}
+
+func New(dbStore *store.Store, scheduler Scheduler, contextReader ContextReader) *Server {
+	s := &Server{
+		store:     dbStore,
+		scheduler: scheduler,
+		context:   contextReader,
+	}
+	s.routes = []route{
+		{http.MethodGet, []string{"projects"}, s.listProjects},
+		{http.MethodPost, []string{"projects"}, s.createProject},
+		{http.MethodGet, []string{"projects", "*"}, s.getProject},
+		{http.MethodPost, []string{"projects", "*", "start"}, s.startProject},
+		{http.MethodGet, []string{"projects", "*", "stage-runs"}, s.listStageRuns},
+		{http.MethodGet, []string{"projects", "*", "context"}, s.listContextEntries},
+		{http.MethodGet, []string{"projects", "*", "context", "*"}, s.getContextEntry},
+		{http.MethodGet, []string{"stage-runs", "*"}, s.getStageRun},
+		{http.MethodPost, []string{"stage-runs", "*", "approve"}, s.approveStageRun},
+		{http.MethodPost, []string{"stage-runs", "*", "reject"}, s.rejectStageRun},
+		{http.MethodGet, []string{"reviews"}, s.listPendingReviews},
+		{http.MethodGet, []string{"personas"}, s.listPersonas},
+		{http.MethodPost, []string{"personas"}, s.createPersona},
+		{http.MethodGet, []string{"personas", "*"}, s.getPersona},
+		{http.MethodPut, []string{"personas", "*"}, s.updatePersona},
+		{http.MethodDelete, []string{"personas", "*"}, s.deletePersona},
+	}
+	return s
+}
+
+// ServeHTTP dispatches a request to the route matching its method and path.
+// A path that matches routes for other methods only gets 405.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, BasePath+"/")
+	if !ok {
+		writeError(w, r, errNotFound("no such endpoint"))
+		return
+	}
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+
+	var allowed []string
+	for _, rt := range s.routes {
+		params, ok := match(rt.pattern, segments)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+		if err := rt.handle(w, r, params); err != nil {
+			writeError(w, r, err)
+		}
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, &Error{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed,
+			Message: r.Method + " is not supported here"})
+		return
+	}
+	writeError(w, r, errNotFound("no such endpoint"))
+}
+
+func match(pattern, segments []string) ([]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var params []string
+	for i, part := range pattern {
+		switch {
+		case part == "*" && segments[i] != "":
+			params = append(params, segments[i])
+		case part != segments[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"workflow-engine/prompt"
+	"workflow-engine/store"
+)
+
+// The cases below are all rejected before the store is touched, so the
+// server runs without one.
+func TestServer_RejectsInvalidRequests(t *testing.T) {
+	server := New(nil, nil, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantFields []string
+	}{
+		{"unknown path", http.MethodGet, "/api/v1/workflows", "", http.StatusNotFound, CodeNotFound, nil},
+		{"outside base path", http.MethodGet, "/projects", "", http.StatusNotFound, CodeNotFound, nil},
+		{"wrong method", http.MethodPatch, "/api/v1/personas/x", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed, nil},
+		{"empty body", http.MethodPost, "/api/v1/projects", "", http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"malformed body", http.MethodPost, "/api/v1/projects", `{"name":`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"unknown field", http.MethodPost, "/api/v1/projects", `{"name":"a","owner":"b"}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"trailing data", http.MethodPost, "/api/v1/projects", `{"name":"a"} {}`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"missing project name", http.MethodPost, "/api/v1/projects", `{"name":"  "}`, http.StatusBadRequest, CodeInvalidRequest, []string{"name"}},
+		{"nil project id", http.MethodPost, "/api/v1/projects", `{"id":"00000000-0000-0000-0000-000000000000","name":"a"}`, http.StatusBadRequest, CodeInvalidRequest, []string{"id"}},
+		{"bad limit", http.MethodGet, "/api/v1/projects?limit=0", "", http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"bad offset", http.MethodGet, "/api/v1/personas?offset=-1", "", http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"unknown status", http.MethodGet, "/api/v1/projects?status=paused", "", http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"invalid persona", http.MethodPost, "/api/v1/personas", `{"model_config":[1]}`, http.StatusBadRequest, CodeInvalidRequest,
+			[]string{"model_config", "name", "prompt_template"}},
+		{"persona update without updated_at", http.MethodPut, "/api/v1/personas/7a0c5c4e-4f39-4d0c-9f43-5e0b8a0a7d11",
+			`{"name":"a","prompt_template":"b"}`, http.StatusBadRequest, CodeInvalidRequest, []string{"updated_at"}},
+		{"approval without reviewer", http.MethodPost, "/api/v1/stage-runs/7a0c5c4e-4f39-4d0c-9f43-5e0b8a0a7d11/approve",
+			`{"comment":"looks good"}`, http.StatusBadRequest, CodeInvalidRequest, []string{"reviewer"}},
+		{"rejection without comment", http.MethodPost, "/api/v1/stage-runs/7a0c5c4e-4f39-4d0c-9f43-5e0b8a0a7d11/reject",
+			`{"reviewer":"ana"}`, http.StatusBadRequest, CodeInvalidRequest, []string{"comment"}},
+		{"approval with rerun", http.MethodPost, "/api/v1/stage-runs/7a0c5c4e-4f39-4d0c-9f43-5e0b8a0a7d11/approve",
+			`{"reviewer":"ana","rerun":true}`, http.StatusBadRequest, CodeInvalidRequest, []string{"rerun"}},
+		{"malformed review project id", http.MethodGet, "/api/v1/reviews?project_id=7", "", http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"malformed stage run id", http.MethodPost, "/api/v1/stage-runs/not-a-uuid/approve", `{"reviewer":"ana"}`, http.StatusNotFound, CodeNotFound, nil},
+		{"malformed project id", http.MethodGet, "/api/v1/projects/not-a-uuid", "", http.StatusNotFound, CodeNotFound, nil},
+		{"malformed persona id", http.MethodDelete, "/api/v1/personas/not-a-uuid", "", http.StatusNotFound, CodeNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			var body struct {
+				Error Error `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected an error body, got %q: %v", rec.Body, err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message == "" {
+				t.Errorf("Expected code %s with a message, got %+v", tt.wantCode, body.Error)
+			}
+			if len(body.Error.Fields) != len(tt.wantFields) {
+				t.Errorf("Expected fields %v, got %v", tt.wantFields, body.Error.Fields)
+			}
+			for _, field := range tt.wantFields {
+				if _, ok := body.Error.Fields[field]; !ok {
+					t.Errorf("Expected field %s to be reported, got %v", field, body.Error.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_MethodNotAllowedListsAllowedMethods(t *testing.T) {
+	server := New(nil, nil, nil)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/v1/personas/x", nil))
+
+	if allow := rec.Header().Get("Allow"); allow != "GET, PUT, DELETE" {
+		t.Errorf("Expected Allow: GET, PUT, DELETE, got %q", allow)
+	}
+}
+
+// The errors below are wrapped the way the store returns them.
+func TestWriteError_MapsStoreErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"duplicate persona", fmt.Errorf("persona name %q: %w", "architect", store.ErrPersonaExists), http.StatusConflict, CodeConflict},
+		{"stale persona", fmt.Errorf("persona %s: %w", "x", store.ErrPersonaConflict), http.StatusConflict, CodeConflict},
+		{"missing stage run", fmt.Errorf("stage run %s: %w", "x", store.ErrStageRunNotFound), http.StatusNotFound, CodeNotFound},
+		{"invalid persona", fmt.Errorf("%w: empty template", store.ErrInvalidPersona), http.StatusUnprocessableEntity, CodeUnprocessable},
+		{"broken rerun prompt", fmt.Errorf("stage design: %w", &prompt.TemplateError{Template: "architect", Problems: []string{"unknown function"}}), http.StatusUnprocessableEntity, CodeUnprocessable},
+		{"rerun prompt missing input", &prompt.MissingVariablesError{Template: "architect", Variables: []string{".Input.requirements"}}, http.StatusUnprocessableEntity, CodeUnprocessable},
+		{"unexpected", errors.New("failed to create persona: connection refused"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, httptest.NewRequest(http.MethodPost, "/api/v1/personas", nil), tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			var body struct {
+				Error Error `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected an error body, got %q: %v", rec.Body, err)
+			}
+			if body.Error.Code != tt.wantCode {
+				t.Errorf("Expected code %s, got %+v", tt.wantCode, body.Error)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	page, n := newPage(10, 20, 11)
+	if n != 10 || page.NextOffset == nil || *page.NextOffset != 30 {
+		t.Errorf("Expected 10 items and a next offset of 30, got %d and %v", n, page.NextOffset)
+	}
+	page, n = newPage(10, 20, 10)
+	if n != 10 || page.NextOffset != nil {
+		t.Errorf("Expected 10 items and no next offset, got %d and %v", n, page.NextOffset)
+	}
+}
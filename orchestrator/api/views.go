@@ -0,0 +1,150 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+// The views below are the JSON shapes of store types, with nullable columns
+// rendered as null or omitted rather than as sql.Null* structs.
+
+type projectView struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status"`
+	WorkflowID  *uuid.UUID `json:"workflow_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func newProjectView(p *store.Project) projectView {
+	return projectView{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description.String,
+		Status:      string(p.Status),
+		WorkflowID:  nullUUID(p.WorkflowID),
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+type stageRunView struct {
+	ID               uuid.UUID       `json:"id"`
+	ProjectID        uuid.UUID       `json:"project_id"`
+	StageName        string          `json:"stage_name"`
+	Status           string          `json:"status"`
+	Attempt          int             `json:"attempt"`
+	PersonaVersionID *uuid.UUID      `json:"persona_version_id"`
+	Prompt           string          `json:"prompt,omitempty"`
+	InputContext     json.RawMessage `json:"input_context,omitempty"`
+	OutputContext    json.RawMessage `json:"output_context,omitempty"`
+	ErrorClass       string          `json:"error_class,omitempty"`
+	LastError        string          `json:"last_error,omitempty"`
+	NextAttemptAt    *time.Time      `json:"next_attempt_at"`
+	ReviewRequired   bool            `json:"review_required"`
+	ReviewedBy       string          `json:"reviewed_by,omitempty"`
+	ReviewComment    string          `json:"review_comment,omitempty"`
+	ReviewedAt       *time.Time      `json:"reviewed_at"`
+	PreviousRunID    *uuid.UUID      `json:"previous_run_id"`
+	StartedAt        *time.Time      `json:"started_at"`
+	CompletedAt      *time.Time      `json:"completed_at"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+func newStageRunView(run *store.StageRun) stageRunView {
+	return stageRunView{
+		ID:               run.ID,
+		ProjectID:        run.ProjectID,
+		StageName:        run.StageName,
+		Status:           string(run.Status),
+		Attempt:          run.Attempt,
+		PersonaVersionID: nullUUID(run.PersonaVersionID),
+		Prompt:           run.Prompt.String,
+		InputContext:     run.InputContext,
+		OutputContext:    run.OutputContext,
+		ErrorClass:       run.ErrorClass.String,
+		LastError:        run.LastError.String,
+		NextAttemptAt:    nullTime(run.NextAttemptAt),
+		ReviewRequired:   run.ReviewRequired,
+		ReviewedBy:       run.ReviewedBy.String,
+		ReviewComment:    run.ReviewComment.String,
+		ReviewedAt:       nullTime(run.ReviewedAt),
+		PreviousRunID:    nullUUID(run.PreviousRunID),
+		StartedAt:        nullTime(run.StartedAt),
+		CompletedAt:      nullTime(run.CompletedAt),
+		CreatedAt:        run.CreatedAt,
+		UpdatedAt:        run.UpdatedAt,
+	}
+}
+
+type personaView struct {
+	ID             uuid.UUID       `json:"id"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description,omitempty"`
+	PromptTemplate string          `json:"prompt_template"`
+	ModelConfig    json.RawMessage `json:"model_config,omitempty"`
+	CurrentVersion int             `json:"current_version"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+func newPersonaView(p *store.Persona) personaView {
+	return personaView{
+		ID:             p.ID,
+		Name:           p.Name,
+		Description:    p.Description.String,
+		PromptTemplate: p.PromptTemplate,
+		ModelConfig:    p.ModelConfig,
+		CurrentVersion: p.CurrentVersion,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
+
+type contextEntryView struct {
+	ProjectID  uuid.UUID       `json:"project_id"`
+	Key        string          `json:"key"`
+	Version    int             `json:"version"`
+	Kind       string          `json:"kind"`
+	Value      json.RawMessage `json:"value"`
+	StageRunID *uuid.UUID      `json:"stage_run_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func newContextEntryView(e *store.ContextEntry) contextEntryView {
+	return contextEntryView{
+		ProjectID:  e.ProjectID,
+		Key:        e.Key,
+		Version:    e.Version,
+		Kind:       e.Kind,
+		Value:      e.Value,
+		StageRunID: nullUUID(e.StageRunID),
+		CreatedAt:  e.CreatedAt,
+	}
+}
+
+func nullUUID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -4,15 +4,37 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DatabaseURL string
-	RedisAddr   string
-	RedisPass   string
-	RedisDB     int
+	DatabaseURL             string
+	RedisAddr               string
+	RedisPass               string
+	RedisDB                 int
+	WorkflowDir             string
+	ContextCacheTTL         time.Duration
+	LLMProvider             string
+	LLMTimeout              time.Duration
+	OpenAIBaseURL           string
+	OpenAIAPIKey            string
+	ExecutorConcurrency     int
+	ExecutorPollInterval    time.Duration
+	ExecutorLeaseTTL        time.Duration
+	InstanceID              string
+	EventMaxDeliveries      int64
+	EventClaimIdle          time.Duration
+	OutboxPollInterval      time.Duration
+	OutboxRetention         time.Duration
+	ProcessedEventRetention time.Duration
+	EventWorkers            int
+	EventHandlerTimeout     time.Duration
+	MetricsAddr             string
+	APIAddr                 string
+	ShutdownTimeout         time.Duration
+	RecoveryInterval        time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -64,10 +86,176 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	workflowDir := os.Getenv("WORKFLOW_DIR")
+	if workflowDir == "" {
+		workflowDir = "../workflows" // Workflow definitions live next to migrations by default
+	}
+
+	contextCacheTTL := 24 * time.Hour
+	if ttlStr := os.Getenv("CONTEXT_CACHE_TTL"); ttlStr != "" {
+		contextCacheTTL, err = time.ParseDuration(ttlStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CONTEXT_CACHE_TTL: %w", err)
+		}
+	}
+
+	llmProvider := os.Getenv("LLM_PROVIDER")
+	if llmProvider == "" {
+		llmProvider = "fake" // Deterministic offline provider
+	}
+	llmTimeout := 2 * time.Minute
+	if timeoutStr := os.Getenv("LLM_TIMEOUT"); timeoutStr != "" {
+		llmTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_TIMEOUT: %w", err)
+		}
+	}
+	openAIBaseURL := os.Getenv("OPENAI_BASE_URL")
+	if openAIBaseURL == "" {
+		openAIBaseURL = "https://api.openai.com/v1"
+	}
+
+	executorConcurrency := 4
+	if concurrencyStr := os.Getenv("EXECUTOR_CONCURRENCY"); concurrencyStr != "" {
+		executorConcurrency, err = strconv.Atoi(concurrencyStr)
+		if err != nil || executorConcurrency < 1 {
+			return nil, fmt.Errorf("invalid EXECUTOR_CONCURRENCY: %q", concurrencyStr)
+		}
+	}
+	executorPollInterval := 5 * time.Second
+	if intervalStr := os.Getenv("EXECUTOR_POLL_INTERVAL"); intervalStr != "" {
+		executorPollInterval, err = time.ParseDuration(intervalStr)
+		if err != nil || executorPollInterval <= 0 {
+			return nil, fmt.Errorf("invalid EXECUTOR_POLL_INTERVAL: %q", intervalStr)
+		}
+	}
+
+	// Leases are renewed a third of the TTL at a time, so anything shorter
+	// than a second would have replicas renewing leases continuously.
+	executorLeaseTTL := time.Minute
+	if ttlStr := os.Getenv("EXECUTOR_LEASE_TTL"); ttlStr != "" {
+		executorLeaseTTL, err = time.ParseDuration(ttlStr)
+		if err != nil || executorLeaseTTL < time.Second {
+			return nil, fmt.Errorf("invalid EXECUTOR_LEASE_TTL: %q", ttlStr)
+		}
+	}
+
+	instanceID := os.Getenv("INSTANCE_ID")
+	if instanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "orchestrator"
+		}
+		instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid()) // Unique per replica
+	}
+
+	eventMaxDeliveries := int64(5)
+	if deliveriesStr := os.Getenv("EVENT_MAX_DELIVERIES"); deliveriesStr != "" {
+		eventMaxDeliveries, err = strconv.ParseInt(deliveriesStr, 10, 64)
+		if err != nil || eventMaxDeliveries < 1 {
+			return nil, fmt.Errorf("invalid EVENT_MAX_DELIVERIES: %q", deliveriesStr)
+		}
+	}
+	eventClaimIdle := time.Minute
+	if idleStr := os.Getenv("EVENT_CLAIM_IDLE"); idleStr != "" {
+		eventClaimIdle, err = time.ParseDuration(idleStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EVENT_CLAIM_IDLE: %w", err)
+		}
+	}
+
+	eventWorkers := 8
+	if workersStr := os.Getenv("EVENT_WORKERS"); workersStr != "" {
+		eventWorkers, err = strconv.Atoi(workersStr)
+		if err != nil || eventWorkers < 1 {
+			return nil, fmt.Errorf("invalid EVENT_WORKERS: %q", workersStr)
+		}
+	}
+	eventHandlerTimeout := 30 * time.Second
+	if timeoutStr := os.Getenv("EVENT_HANDLER_TIMEOUT"); timeoutStr != "" {
+		eventHandlerTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EVENT_HANDLER_TIMEOUT: %w", err)
+		}
+	}
+	if eventHandlerTimeout >= eventClaimIdle {
+		return nil, fmt.Errorf("EVENT_HANDLER_TIMEOUT %s must be shorter than EVENT_CLAIM_IDLE %s", eventHandlerTimeout, eventClaimIdle)
+	}
+
+	metricsAddr, ok := os.LookupEnv("METRICS_ADDR")
+	if !ok {
+		metricsAddr = ":9090" // Set METRICS_ADDR to an empty string to disable
+	}
+
+	apiAddr, ok := os.LookupEnv("API_ADDR")
+	if !ok {
+		apiAddr = ":8080" // Set API_ADDR to an empty string to disable
+	}
+
+	shutdownTimeout := 30 * time.Second
+	if timeoutStr := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutStr != "" {
+		shutdownTimeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+	}
+
+	recoveryInterval := time.Minute
+	if intervalStr := os.Getenv("RECOVERY_INTERVAL"); intervalStr != "" {
+		recoveryInterval, err = time.ParseDuration(intervalStr)
+		if err != nil || recoveryInterval <= 0 {
+			return nil, fmt.Errorf("invalid RECOVERY_INTERVAL: %q", intervalStr)
+		}
+	}
+
+	outboxPollInterval := time.Second
+	if intervalStr := os.Getenv("OUTBOX_POLL_INTERVAL"); intervalStr != "" {
+		outboxPollInterval, err = time.ParseDuration(intervalStr)
+		if err != nil || outboxPollInterval <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL: %q", intervalStr)
+		}
+	}
+	outboxRetention := 7 * 24 * time.Hour
+	if retentionStr := os.Getenv("OUTBOX_RETENTION"); retentionStr != "" {
+		outboxRetention, err = time.ParseDuration(retentionStr)
+		if err != nil || outboxRetention <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_RETENTION: %q", retentionStr)
+		}
+	}
+	// Events are only recognised as redelivered while they are remembered.
+	processedEventRetention := 7 * 24 * time.Hour
+	if retentionStr := os.Getenv("PROCESSED_EVENT_RETENTION"); retentionStr != "" {
+		processedEventRetention, err = time.ParseDuration(retentionStr)
+		if err != nil || processedEventRetention <= 0 {
+			return nil, fmt.Errorf("invalid PROCESSED_EVENT_RETENTION: %q", retentionStr)
+		}
+	}
+
 	return &Config{
-		DatabaseURL: databaseURL,
-		RedisAddr:   redisAddr,
-		RedisPass:   redisPass,
-		RedisDB:     redisDB,
+		DatabaseURL:             databaseURL,
+		RedisAddr:               redisAddr,
+		RedisPass:               redisPass,
+		RedisDB:                 redisDB,
+		WorkflowDir:             workflowDir,
+		ContextCacheTTL:         contextCacheTTL,
+		LLMProvider:             llmProvider,
+		LLMTimeout:              llmTimeout,
+		OpenAIBaseURL:           openAIBaseURL,
+		OpenAIAPIKey:            os.Getenv("OPENAI_API_KEY"),
+		ExecutorConcurrency:     executorConcurrency,
+		ExecutorPollInterval:    executorPollInterval,
+		ExecutorLeaseTTL:        executorLeaseTTL,
+		InstanceID:              instanceID,
+		EventMaxDeliveries:      eventMaxDeliveries,
+		EventClaimIdle:          eventClaimIdle,
+		OutboxPollInterval:      outboxPollInterval,
+		OutboxRetention:         outboxRetention,
+		ProcessedEventRetention: processedEventRetention,
+		EventWorkers:            eventWorkers,
+		EventHandlerTimeout:     eventHandlerTimeout,
+		MetricsAddr:             metricsAddr,
+		APIAddr:                 apiAddr,
+		ShutdownTimeout:         shutdownTimeout,
+		RecoveryInterval:        recoveryInterval,
 	}, nil
 }
@@ -0,0 +1,151 @@
+package contextbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidEntry is wrapped by every error caused by a malformed entry.
+var ErrInvalidEntry = errors.New("invalid context entry")
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// entryStore is the durable store behind the bus. *store.ContextEntryStore
+// implements it.
+type entryStore interface {
+	AppendContextEntry(ctx context.Context, entry *store.ContextEntry) error
+	GetContextEntry(ctx context.Context, projectID uuid.UUID, key string, version int) (*store.ContextEntry, error)
+	GetLatestContextEntry(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error)
+	ListLatestContextEntries(ctx context.Context, projectID uuid.UUID) ([]*store.ContextEntry, error)
+}
+
+// Bus lets stages publish and read versioned, project-scoped knowledge.
+// Postgres is the source of truth; Redis serves hot reads.
+type Bus struct {
+	entries entryStore
+	cache   cache
+}
+
+func newBus(entries entryStore, c cache) *Bus {
+	return &Bus{entries: entries, cache: c}
+}
+
+// Publish validates value against kind and stores it as the next version of
+// key. The entry is durable once Publish returns; cache failures are logged.
+func (b *Bus) Publish(ctx context.Context, projectID uuid.UUID, key string, kind Kind, value interface{}, stageRunID uuid.NullUUID) (*store.ContextEntry, error) {
+	if !keyPattern.MatchString(key) {
+		return nil, fmt.Errorf("%w: key %q must be 1-128 letters, digits, '_', '.' or '-'", ErrInvalidEntry, key)
+	}
+	raw, ok := value.(json.RawMessage)
+	if !ok {
+		var err error
+		raw, err = json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEntry, err)
+		}
+	}
+	if err := validateValue(kind, raw); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidEntry, key, err)
+	}
+
+	entry := &store.ContextEntry{
+		ProjectID:  projectID,
+		Key:        key,
+		Kind:       string(kind),
+		Value:      raw,
+		StageRunID: stageRunID,
+	}
+	if err := b.entries.AppendContextEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal context entry: %w", err)
+	}
+	if err := b.cache.Set(ctx, versionKey(projectID, key, entry.Version), data); err != nil {
+		log.Printf("Error caching context entry %s v%d for project %s: %v", key, entry.Version, projectID, err)
+	}
+	if err := b.cache.SetLatest(ctx, latestKey(projectID, key), data, entry.Version); err != nil {
+		log.Printf("Error caching latest context entry %s for project %s: %v", key, projectID, err)
+	}
+	return entry, nil
+}
+
+// Get returns a specific version of key, or nil if it does not exist.
+func (b *Bus) Get(ctx context.Context, projectID uuid.UUID, key string, version int) (*store.ContextEntry, error) {
+	return b.read(ctx, versionKey(projectID, key, version), false, func() (*store.ContextEntry, error) {
+		return b.entries.GetContextEntry(ctx, projectID, key, version)
+	})
+}
+
+// Latest returns the newest version of key, or nil if it was never published.
+func (b *Bus) Latest(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error) {
+	return b.read(ctx, latestKey(projectID, key), true, func() (*store.ContextEntry, error) {
+		return b.entries.GetLatestContextEntry(ctx, projectID, key)
+	})
+}
+
+// Snapshot returns the latest version of every key in a project. It always
+// reads from Postgres so the result is consistent.
+func (b *Bus) Snapshot(ctx context.Context, projectID uuid.UUID) (map[string]*store.ContextEntry, error) {
+	entries, err := b.entries.ListLatestContextEntries(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(map[string]*store.ContextEntry, len(entries))
+	for _, entry := range entries {
+		snapshot[entry.Key] = entry
+	}
+	return snapshot, nil
+}
+
+// read serves an entry from the cache, falling back to Postgres and
+// repopulating the cache on a miss.
+func (b *Bus) read(ctx context.Context, cacheKey string, latest bool, load func() (*store.ContextEntry, error)) (*store.ContextEntry, error) {
+	data, err := b.cache.Get(ctx, cacheKey)
+	switch {
+	case err == nil:
+		entry := &store.ContextEntry{}
+		if err := json.Unmarshal(data, entry); err == nil {
+			return entry, nil
+		}
+		log.Printf("Discarding undecodable cached context entry %s", cacheKey)
+	case !errors.Is(err, errCacheMiss):
+		log.Printf("Error reading context entry %s from cache: %v", cacheKey, err)
+	}
+
+	entry, err := load()
+	if err != nil || entry == nil {
+		return entry, err
+	}
+	data, err = json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal context entry: %w", err)
+	}
+	if latest {
+		err = b.cache.SetLatest(ctx, cacheKey, data, entry.Version)
+	} else {
+		err = b.cache.Set(ctx, cacheKey, data)
+	}
+	if err != nil {
+		log.Printf("Error caching context entry %s: %v", cacheKey, err)
+	}
+	return entry, nil
+}
+
+func versionKey(projectID uuid.UUID, key string, version int) string {
+	return fmt.Sprintf("contextbus:%s:%s:v%d", projectID, key, version)
+}
+
+func latestKey(projectID uuid.UUID, key string) string {
+	return fmt.Sprintf("contextbus:%s:%s:latest", projectID, key)
+}
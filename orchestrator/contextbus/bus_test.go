@@ -0,0 +1,222 @@
+package contextbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore is an in-memory entryStore.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string][]*store.ContextEntry
+	reads   int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string][]*store.ContextEntry)}
+}
+
+func (m *memoryStore) AppendContextEntry(ctx context.Context, entry *store.ContextEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := entry.ProjectID.String() + "/" + entry.Key
+	entry.Version = len(m.entries[id]) + 1
+	stored := *entry
+	m.entries[id] = append(m.entries[id], &stored)
+	return nil
+}
+
+func (m *memoryStore) GetContextEntry(ctx context.Context, projectID uuid.UUID, key string, version int) (*store.ContextEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	versions := m.entries[projectID.String()+"/"+key]
+	if version < 1 || version > len(versions) {
+		return nil, nil
+	}
+	return versions[version-1], nil
+}
+
+func (m *memoryStore) GetLatestContextEntry(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	versions := m.entries[projectID.String()+"/"+key]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+func (m *memoryStore) ListLatestContextEntries(ctx context.Context, projectID uuid.UUID) ([]*store.ContextEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest []*store.ContextEntry
+	for _, versions := range m.entries {
+		if versions[0].ProjectID == projectID {
+			latest = append(latest, versions[len(versions)-1])
+		}
+	}
+	return latest, nil
+}
+
+// memoryCache is an in-memory cache that can be switched off to simulate a
+// Redis outage.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	down   bool
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string][]byte)}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return nil, errors.New("cache down")
+	}
+	data, ok := c.values[key]
+	if !ok {
+		return nil, errCacheMiss
+	}
+	return data, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errors.New("cache down")
+	}
+	c.values[key] = value
+	return nil
+}
+
+func (c *memoryCache) SetLatest(ctx context.Context, key string, value []byte, version int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errors.New("cache down")
+	}
+	if current, ok := c.values[key]; ok {
+		var entry store.ContextEntry
+		if json.Unmarshal(current, &entry) == nil && entry.Version >= version {
+			return nil
+		}
+	}
+	c.values[key] = value
+	return nil
+}
+
+func TestBus_PublishVersionsEntries(t *testing.T) {
+	entries := newMemoryStore()
+	bus := newBus(entries, newMemoryCache())
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	first, err := bus.Publish(ctx, projectID, "tech_stack", KindTechStack, &TechStack{Languages: []string{"Go"}}, uuid.NullUUID{})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	second, err := bus.Publish(ctx, projectID, "tech_stack", KindTechStack, &TechStack{Languages: []string{"Go", "SQL"}}, uuid.NullUUID{})
+	if err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if first.Version != 1 || second.Version != 2 {
+		t.Fatalf("Expected versions 1 and 2, got %d and %d", first.Version, second.Version)
+	}
+
+	latest, err := bus.Latest(ctx, projectID, "tech_stack")
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest.Version != 2 {
+		t.Errorf("Expected latest version 2, got %d", latest.Version)
+	}
+
+	old, err := bus.Get(ctx, projectID, "tech_stack", 1)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	var stack TechStack
+	if err := json.Unmarshal(old.Value, &stack); err != nil {
+		t.Fatalf("Failed to decode entry value: %v", err)
+	}
+	if len(stack.Languages) != 1 {
+		t.Errorf("Expected version 1 to hold one language, got %v", stack.Languages)
+	}
+	if entries.reads != 0 {
+		t.Errorf("Expected hot reads to be served from the cache, got %d store reads", entries.reads)
+	}
+}
+
+func TestBus_ReadsFallBackToStore(t *testing.T) {
+	entries := newMemoryStore()
+	cache := newMemoryCache()
+	bus := newBus(entries, cache)
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	cache.down = true
+	if _, err := bus.Publish(ctx, projectID, "summary", KindGeneric, map[string]string{"text": "done"}, uuid.NullUUID{}); err != nil {
+		t.Fatalf("Publish should survive a cache outage: %v", err)
+	}
+	cache.down = false
+
+	latest, err := bus.Latest(ctx, projectID, "summary")
+	if err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if latest == nil || latest.Version != 1 {
+		t.Fatalf("Expected version 1 from the store, got %+v", latest)
+	}
+	if _, err := bus.Latest(ctx, projectID, "summary"); err != nil {
+		t.Fatalf("Latest failed: %v", err)
+	}
+	if entries.reads != 1 {
+		t.Errorf("Expected the miss to repopulate the cache, got %d store reads", entries.reads)
+	}
+
+	missing, err := bus.Latest(ctx, projectID, "unknown")
+	if err != nil || missing != nil {
+		t.Errorf("Expected nil entry for unknown key, got %+v, %v", missing, err)
+	}
+}
+
+func TestBus_PublishRejectsInvalidEntries(t *testing.T) {
+	bus := newBus(newMemoryStore(), newMemoryCache())
+	ctx := context.Background()
+	projectID := uuid.New()
+
+	cases := []struct {
+		name  string
+		key   string
+		kind  Kind
+		value interface{}
+	}{
+		{"bad key", "tech stack", KindTechStack, &TechStack{Languages: []string{"Go"}}},
+		{"unknown kind", "x", Kind("mystery"), map[string]int{"a": 1}},
+		{"tech stack without languages", "tech_stack", KindTechStack, &TechStack{}},
+		{"risk with bad severity", "risks", KindRisks, json.RawMessage(`{"items": [{"title": "outage", "severity": "apocalyptic"}]}`)},
+		{"unknown field", "milestone", KindMilestoneSummary, json.RawMessage(`{"milestone": "m1", "summary": "ok", "extra": true}`)},
+		{"invalid json", "notes", KindGeneric, json.RawMessage(`{`)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := bus.Publish(ctx, projectID, tc.key, tc.kind, tc.value, uuid.NullUUID{})
+			if !errors.Is(err, ErrInvalidEntry) {
+				t.Errorf("Expected ErrInvalidEntry, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package contextbus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"workflow-engine/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var errCacheMiss = errors.New("cache miss")
+
+// cache is the hot-read layer in front of Postgres.
+type cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte) error
+	// SetLatest stores value unless the cached entry already has a version
+	// at least as new, so racing publishers never move "latest" backwards.
+	SetLatest(ctx context.Context, key string, value []byte, version int) error
+}
+
+// New returns a Bus persisting to entries and caching in Redis for ttl, which
+// keeps entries of finished projects from pinning Redis memory forever.
+func New(entries *store.ContextEntryStore, redisClient *redis.Client, ttl time.Duration) *Bus {
+	return newBus(entries, &redisCache{client: redisClient, ttl: ttl})
+}
+
+type redisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, errCacheMiss
+	}
+	return data, err
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte) error {
+	return c.client.Set(ctx, key, value, c.ttl).Err()
+}
+
+var setLatestScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ok, decoded = pcall(cjson.decode, current)
+	if ok and tonumber(decoded['version']) >= tonumber(ARGV[2]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+func (c *redisCache) SetLatest(ctx context.Context, key string, value []byte, version int) error {
+	return setLatestScript.Run(ctx, c.client, []string{key}, value, version, c.ttl.Milliseconds()).Err()
+}
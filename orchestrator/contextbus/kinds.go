@@ -0,0 +1,119 @@
+package contextbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Kind classifies the structure of a Context Bus entry's value.
+type Kind string
+
+const (
+	KindTechStack        Kind = "tech_stack"
+	KindRisks            Kind = "risks"
+	KindMilestoneSummary Kind = "milestone_summary"
+	// KindGeneric entries may hold any JSON value.
+	KindGeneric Kind = "generic"
+)
+
+// TechStack records the technology decisions made for a project.
+type TechStack struct {
+	Languages      []string `json:"languages"`
+	Frameworks     []string `json:"frameworks,omitempty"`
+	Datastores     []string `json:"datastores,omitempty"`
+	Infrastructure []string `json:"infrastructure,omitempty"`
+	Rationale      string   `json:"rationale,omitempty"`
+}
+
+func (t *TechStack) validate() error {
+	if len(t.Languages) == 0 {
+		return errors.New("at least one language is required")
+	}
+	return nil
+}
+
+type RiskSeverity string
+
+const (
+	RiskSeverityLow    RiskSeverity = "low"
+	RiskSeverityMedium RiskSeverity = "medium"
+	RiskSeverityHigh   RiskSeverity = "high"
+)
+
+type Risk struct {
+	Title      string       `json:"title"`
+	Severity   RiskSeverity `json:"severity"`
+	Mitigation string       `json:"mitigation,omitempty"`
+}
+
+// Risks lists the risks identified for a project.
+type Risks struct {
+	Items []Risk `json:"items"`
+}
+
+func (r *Risks) validate() error {
+	for i, risk := range r.Items {
+		if risk.Title == "" {
+			return fmt.Errorf("risk #%d has no title", i+1)
+		}
+		switch risk.Severity {
+		case RiskSeverityLow, RiskSeverityMedium, RiskSeverityHigh:
+		default:
+			return fmt.Errorf("risk %q has invalid severity %q", risk.Title, risk.Severity)
+		}
+	}
+	return nil
+}
+
+// MilestoneSummary distills what a stage or group of stages achieved.
+type MilestoneSummary struct {
+	Milestone string   `json:"milestone"`
+	Summary   string   `json:"summary"`
+	Completed []string `json:"completed,omitempty"`
+	NextSteps []string `json:"next_steps,omitempty"`
+}
+
+func (m *MilestoneSummary) validate() error {
+	if m.Milestone == "" {
+		return errors.New("milestone is required")
+	}
+	if m.Summary == "" {
+		return errors.New("summary is required")
+	}
+	return nil
+}
+
+type validator interface {
+	validate() error
+}
+
+// validateValue checks value against the schema of kind. Typed kinds must
+// decode without unknown fields; generic values only need to be valid JSON.
+func validateValue(kind Kind, value json.RawMessage) error {
+	if !json.Valid(value) {
+		return errors.New("value is not valid JSON")
+	}
+
+	var typed validator
+	switch kind {
+	case KindTechStack:
+		typed = &TechStack{}
+	case KindRisks:
+		typed = &Risks{}
+	case KindMilestoneSummary:
+		typed = &MilestoneSummary{}
+	case KindGeneric:
+		return nil
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(typed); err != nil {
+		return fmt.Errorf("value does not match %s schema: %v", kind, err)
+	}
+	return typed.validate()
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ProjectCreatedStream is the Redis stream project_created events are
+	// appended to.
+	ProjectCreatedStream = "project_created_events"
+	// ProjectStatusStream carries project_status_changed events.
+	ProjectStatusStream = "project_status_events"
+	// StageRunStatusStream carries stage_run_status_changed events.
+	StageRunStatusStream = "stage_run_status_events"
+	// OrchestratorGroup is the consumer group orchestrator replicas share, so
+	// each event is handled by one of them.
+	OrchestratorGroup = "orchestrator"
+)
+
+// Type identifies the kind of event carried by an Envelope.
+type Type string
+
+const (
+	TypeProjectCreated        Type = "project_created"
+	TypeProjectStatusChanged  Type = "project_status_changed"
+	TypeStageRunStatusChanged Type = "stage_run_status_changed"
+)
+
+// SchemaVersion is the envelope schema version produced by this build.
+// Decoders accept any version up to and including it.
+const SchemaVersion = 1
+
+// ErrInvalidEvent is wrapped by every decoding and validation error so callers
+// can tell malformed events apart from processing failures.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// Envelope is the versioned wrapper every event on the bus is sent in.
+type Envelope struct {
+	Type          Type            `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	ID            uuid.UUID       `json:"id"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// Payload is implemented by every typed event payload.
+type Payload interface {
+	EventType() Type
+	Validate() error
+}
+
+// NewEnvelope validates payload and wraps it in an envelope with a fresh event ID.
+func NewEnvelope(payload Payload) (*Envelope, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s payload: %v", ErrInvalidEvent, payload.EventType(), err)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", payload.EventType(), err)
+	}
+	return &Envelope{
+		Type:          payload.EventType(),
+		SchemaVersion: SchemaVersion,
+		ID:            uuid.New(),
+		Timestamp:     time.Now().UTC(),
+		Payload:       data,
+	}, nil
+}
+
+// Encode marshals the envelope for publishing.
+func (e *Envelope) Encode() ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event envelope: %w", err)
+	}
+	return data, nil
+}
+
+// Validate checks the envelope header. It does not look inside the payload.
+func (e *Envelope) Validate() error {
+	if e.Type == "" {
+		return fmt.Errorf("%w: missing type", ErrInvalidEvent)
+	}
+	if e.SchemaVersion < 1 || e.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("%w: unsupported schema version %d", ErrInvalidEvent, e.SchemaVersion)
+	}
+	if e.ID == uuid.Nil {
+		return fmt.Errorf("%w: missing id", ErrInvalidEvent)
+	}
+	if e.Timestamp.IsZero() {
+		return fmt.Errorf("%w: missing timestamp", ErrInvalidEvent)
+	}
+	if len(e.Payload) == 0 || string(e.Payload) == "null" {
+		return fmt.Errorf("%w: missing payload", ErrInvalidEvent)
+	}
+	return nil
+}
+
+// Decode parses and validates an envelope received from the bus.
+func Decode(data []byte) (*Envelope, error) {
+	env := &Envelope{}
+	if err := json.Unmarshal(data, env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	if err := env.Validate(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// DecodePayload unmarshals the envelope payload into dst and validates it.
+// The envelope type must match dst's event type.
+func (e *Envelope) DecodePayload(dst Payload) error {
+	if e.Type != dst.EventType() {
+		return fmt.Errorf("%w: expected %s event, got %s", ErrInvalidEvent, dst.EventType(), e.Type)
+	}
+	if err := json.Unmarshal(e.Payload, dst); err != nil {
+		return fmt.Errorf("%w: %s payload: %v", ErrInvalidEvent, e.Type, err)
+	}
+	if err := dst.Validate(); err != nil {
+		return fmt.Errorf("%w: %s payload: %v", ErrInvalidEvent, e.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+func TestEnvelope_RoundTripProjectCreated(t *testing.T) {
+	projectID := uuid.New()
+	env, err := NewEnvelope(&ProjectCreated{
+		ID:          projectID,
+		Name:        "Roundtrip Project",
+		Description: "created in a test",
+	})
+	if err != nil {
+		t.Fatalf("NewEnvelope failed: %v", err)
+	}
+	data, err := env.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.ID != env.ID {
+		t.Errorf("Expected event ID %s, got %s", env.ID, decoded.ID)
+	}
+	if decoded.SchemaVersion != SchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", SchemaVersion, decoded.SchemaVersion)
+	}
+
+	event := &ProjectCreated{}
+	if err := decoded.DecodePayload(event); err != nil {
+		t.Fatalf("DecodePayload failed: %v", err)
+	}
+	if event.ID != projectID {
+		t.Errorf("Expected project ID %s, got %s", projectID, event.ID)
+	}
+	if event.Name != "Roundtrip Project" {
+		t.Errorf("Expected project name %q, got %q", "Roundtrip Project", event.Name)
+	}
+}
+
+func TestDecode_RejectsMalformedEvents(t *testing.T) {
+	validID := uuid.New().String()
+	cases := map[string]string{
+		"not json":           `{"id": `,
+		"raw legacy payload": `{"id": "` + validID + `", "name": "legacy", "description": "no envelope"}`,
+		"missing type":       `{"schema_version": 1, "id": "` + validID + `", "timestamp": "2024-01-01T00:00:00Z", "payload": {}}`,
+		"future version":     `{"type": "project_created", "schema_version": 99, "id": "` + validID + `", "timestamp": "2024-01-01T00:00:00Z", "payload": {}}`,
+		"missing timestamp":  `{"type": "project_created", "schema_version": 1, "id": "` + validID + `", "payload": {}}`,
+		"missing payload":    `{"type": "project_created", "schema_version": 1, "id": "` + validID + `", "timestamp": "2024-01-01T00:00:00Z"}`,
+		"invalid event id":   `{"type": "project_created", "schema_version": 1, "id": "nope", "timestamp": "2024-01-01T00:00:00Z", "payload": {}}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode([]byte(data))
+			if !errors.Is(err, ErrInvalidEvent) {
+				t.Errorf("Expected ErrInvalidEvent, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodePayload_ValidatesProjectCreated(t *testing.T) {
+	base := `{"type": "project_created", "schema_version": 1, "id": "` + uuid.New().String() + `", "timestamp": "2024-01-01T00:00:00Z", "payload": `
+	cases := map[string]string{
+		"missing project id": base + `{"name": "No ID"}}`,
+		"blank name":         base + `{"id": "` + uuid.New().String() + `", "name": "  "}}`,
+		"wrong payload type": base + `["not", "an", "object"]}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			env, err := Decode([]byte(data))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if err := env.DecodePayload(&ProjectCreated{}); !errors.Is(err, ErrInvalidEvent) {
+				t.Errorf("Expected ErrInvalidEvent, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEntryData(t *testing.T) {
+	data, err := EntryData(redis.XMessage{ID: "1-0", Values: map[string]interface{}{"event": `{"type": "project_created"}`}})
+	if err != nil {
+		t.Fatalf("EntryData failed: %v", err)
+	}
+	if string(data) != `{"type": "project_created"}` {
+		t.Errorf("Unexpected entry data %s", data)
+	}
+
+	if _, err := EntryData(redis.XMessage{ID: "2-0", Values: map[string]interface{}{"payload": "{}"}}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Expected ErrInvalidEvent for an entry without an event field, got %v", err)
+	}
+	if got := DeadLetterStream(ProjectCreatedStream); got != "project_created_events:dead" {
+		t.Errorf("Unexpected dead-letter stream %s", got)
+	}
+}
+
+func TestConsumer_AcquireAppliesBackpressure(t *testing.T) {
+	c := NewConsumer(nil, "acquire_test_events", OrchestratorGroup, "test", nil)
+	c.BatchSize = 3
+	slots := make(chan struct{}, 4)
+
+	if got := c.acquire(context.Background(), slots); got != 3 {
+		t.Errorf("Expected a full batch of 3 slots, got %d", got)
+	}
+	if got := c.acquire(context.Background(), slots); got != 1 {
+		t.Errorf("Expected the last free slot, got %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- c.acquire(ctx, slots) }()
+	select {
+	case got := <-done:
+		t.Fatalf("Expected acquire to wait while saturated, got %d slots", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-slots
+	if got := <-done; got != 1 {
+		t.Errorf("Expected the released slot, got %d", got)
+	}
+
+	cancel()
+	if got := c.acquire(ctx, slots); got != 0 {
+		t.Errorf("Expected no slots once cancelled, got %d", got)
+	}
+	if saturated := c.metrics.Get("saturated"); saturated == nil || saturated.String() != "2" {
+		t.Errorf("Expected 2 saturated waits, got %v", saturated)
+	}
+}
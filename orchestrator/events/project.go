@@ -0,0 +1,32 @@
+package events
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ProjectCreated is published when a new project should be created.
+// The publisher chooses the project ID. When Workflow names a known workflow
+// the project starts running it immediately.
+type ProjectCreated struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Workflow    string    `json:"workflow,omitempty"`
+}
+
+func (p *ProjectCreated) EventType() Type {
+	return TypeProjectCreated
+}
+
+func (p *ProjectCreated) Validate() error {
+	if p.ID == uuid.Nil {
+		return errors.New("id is required")
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
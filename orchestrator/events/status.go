@@ -0,0 +1,56 @@
+package events
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ProjectStatusChanged is published when a project moves to a new status.
+// From is empty for a newly created project.
+type ProjectStatusChanged struct {
+	ProjectID uuid.UUID `json:"project_id"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+func (p *ProjectStatusChanged) EventType() Type {
+	return TypeProjectStatusChanged
+}
+
+func (p *ProjectStatusChanged) Validate() error {
+	if p.ProjectID == uuid.Nil {
+		return errors.New("project_id is required")
+	}
+	if p.To == "" {
+		return errors.New("to is required")
+	}
+	return nil
+}
+
+// StageRunStatusChanged is published when a stage run moves to a new status.
+// From is empty for a newly created run.
+type StageRunStatusChanged struct {
+	StageRunID uuid.UUID `json:"stage_run_id"`
+	ProjectID  uuid.UUID `json:"project_id"`
+	StageName  string    `json:"stage_name"`
+	Attempt    int       `json:"attempt"`
+	From       string    `json:"from,omitempty"`
+	To         string    `json:"to"`
+}
+
+func (p *StageRunStatusChanged) EventType() Type {
+	return TypeStageRunStatusChanged
+}
+
+func (p *StageRunStatusChanged) Validate() error {
+	if p.StageRunID == uuid.Nil || p.ProjectID == uuid.Nil {
+		return errors.New("stage_run_id and project_id are required")
+	}
+	if p.To == "" {
+		return errors.New("to is required")
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// eventField is the stream entry field holding the encoded envelope.
+const eventField = "event"
+
+// DeadLetterStream names the stream that entries of stream are moved to once
+// they cannot be handled.
+func DeadLetterStream(stream string) string {
+	return stream + ":dead"
+}
+
+// Publish appends an envelope to stream and returns the stream entry ID.
+func Publish(ctx context.Context, client redis.Cmdable, stream string, env *Envelope) (string, error) {
+	data, err := env.Encode()
+	if err != nil {
+		return "", err
+	}
+	id, err := PublishEncoded(ctx, client, stream, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish %s event %s: %w", env.Type, env.ID, err)
+	}
+	return id, nil
+}
+
+// PublishEncoded appends an already encoded envelope to stream.
+func PublishEncoded(ctx context.Context, client redis.Cmdable, stream string, data []byte) (string, error) {
+	id, err := client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{eventField: data},
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to append to %s: %w", stream, err)
+	}
+	return id, nil
+}
+
+// Handler processes the encoded envelope of one stream entry. Returning an
+// error leaves the entry unacknowledged so it is delivered again; an error
+// wrapping ErrInvalidEvent dead-letters it at once, as retrying cannot help.
+type Handler func(ctx context.Context, data []byte) error
+
+const (
+	DefaultMaxDeliveries  = 5
+	DefaultClaimIdle      = time.Minute
+	DefaultBlock          = 5 * time.Second
+	DefaultBatchSize      = 10
+	DefaultWorkers        = 8
+	DefaultHandlerTimeout = 30 * time.Second
+)
+
+// consumerMetrics publishes a map of counters per consumed stream under
+// /debug/vars: in_flight and queued entries, handled, failed and
+// dead_lettered totals, and how often consumption paused because every
+// worker was busy (saturated).
+var consumerMetrics = expvar.NewMap("event_consumers")
+
+// Consumer reads a stream as one member of a consumer group and hands the
+// entries to a fixed pool of Workers. It reads no more entries than the pool
+// has room for, so a burst waits in Redis instead of piling up in memory. An
+// entry is acknowledged only after its handler succeeds. Entries left pending
+// by a failed handler or a crashed consumer are claimed again once idle for
+// ClaimIdle, and after MaxDeliveries deliveries they are moved to the
+// stream's dead-letter stream instead.
+type Consumer struct {
+	client  redis.Cmdable
+	stream  string
+	group   string
+	name    string
+	handler Handler
+	metrics *expvar.Map
+
+	// stop is closed by Shutdown to stop reading; abort is closed when the
+	// drain deadline passes; done is closed when Run returns.
+	stop     chan struct{}
+	stopOnce sync.Once
+	abort    chan struct{}
+	done     chan struct{}
+
+	MaxDeliveries int64
+	// ClaimIdle must exceed HandlerTimeout, or entries still being handled
+	// are claimed again.
+	ClaimIdle time.Duration
+	Block     time.Duration
+	BatchSize int64
+	// Workers is how many entries are handled at once.
+	Workers int
+	// HandlerTimeout bounds each handler call.
+	HandlerTimeout time.Duration
+}
+
+// NewConsumer returns a consumer named name in group. name must be unique
+// among the group's live consumers.
+func NewConsumer(client redis.Cmdable, stream, group, name string, handler Handler) *Consumer {
+	metrics := new(expvar.Map).Init()
+	consumerMetrics.Set(stream, metrics)
+	return &Consumer{
+		client:         client,
+		stream:         stream,
+		group:          group,
+		name:           name,
+		handler:        handler,
+		metrics:        metrics,
+		stop:           make(chan struct{}),
+		abort:          make(chan struct{}),
+		done:           make(chan struct{}),
+		MaxDeliveries:  DefaultMaxDeliveries,
+		ClaimIdle:      DefaultClaimIdle,
+		Block:          DefaultBlock,
+		BatchSize:      DefaultBatchSize,
+		Workers:        DefaultWorkers,
+		HandlerTimeout: DefaultHandlerTimeout,
+	}
+}
+
+// delivery is an entry read from the stream together with how often it has
+// been delivered.
+type delivery struct {
+	msg        redis.XMessage
+	deliveries int64
+}
+
+// Run consumes the stream until ctx is done or Shutdown is called, then waits
+// for the handlers in flight. It creates the group, reading from the start of
+// the stream, if it does not exist yet.
+func (c *Consumer) Run(ctx context.Context) error {
+	defer close(c.done)
+
+	// Handlers run under work, which outlives reading so that Shutdown can
+	// drain them.
+	work, cancelWork := context.WithCancel(ctx)
+	defer cancelWork()
+	ctx, cancelRead := context.WithCancel(ctx)
+	defer cancelRead()
+	go func() {
+		select {
+		case <-c.stop:
+			cancelRead()
+		case <-ctx.Done():
+		}
+		select {
+		case <-c.abort:
+			cancelWork()
+		case <-work.Done():
+		}
+	}()
+
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s on %s: %w", c.group, c.stream, err)
+	}
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	log.Printf("Consuming stream %s as %s/%s with %d workers", c.stream, c.group, c.name, workers)
+
+	// Every entry holds a slot from being read until it is handled. There
+	// are twice as many slots as workers, so while every worker handles an
+	// entry as many again can wait in the queue. The queue is as large as
+	// the number of slots, so queuing an entry that holds one never blocks.
+	capacity := 2 * workers
+	slots := make(chan struct{}, capacity)
+	queue := make(chan delivery, capacity)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range queue {
+				c.metrics.Add("queued", -1)
+				c.metrics.Add("in_flight", 1)
+				c.handle(work, d.msg, d.deliveries)
+				c.metrics.Add("in_flight", -1)
+				<-slots
+			}
+		}()
+	}
+
+	for ctx.Err() == nil {
+		free := c.acquire(ctx, slots)
+		if free == 0 {
+			break // ctx is done
+		}
+		batch, err := c.fetch(ctx, free)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error reading stream %s: %v", c.stream, err)
+			time.Sleep(time.Second) // Avoid spinning while Redis is unavailable
+		}
+		for i := len(batch); i < free; i++ {
+			<-slots
+		}
+		for _, d := range batch {
+			c.metrics.Add("queued", 1)
+			queue <- d
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return nil
+}
+
+// Shutdown stops reading new entries and waits for Run to finish the ones in
+// flight. Handlers still running when ctx is done are cancelled; their
+// entries stay unacknowledged and are delivered again later.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+	}
+	close(c.abort)
+	<-c.done
+	return fmt.Errorf("consumer of %s did not drain in time: %w", c.stream, ctx.Err())
+}
+
+// acquire blocks until at least one slot is free, then takes up to BatchSize
+// slots and returns how many it took. It returns 0 once ctx is done.
+func (c *Consumer) acquire(ctx context.Context, slots chan struct{}) int {
+	select {
+	case slots <- struct{}{}:
+	default:
+		c.metrics.Add("saturated", 1)
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return 0
+		}
+	}
+	taken := 1
+	for int64(taken) < c.BatchSize {
+		select {
+		case slots <- struct{}{}:
+			taken++
+		default:
+			return taken
+		}
+	}
+	return taken
+}
+
+// fetch returns up to n entries: pending entries idle for longer than
+// ClaimIdle first, whichever consumer they were delivered to, then new ones,
+// waiting up to Block for some to arrive.
+func (c *Consumer) fetch(ctx context.Context, n int) ([]delivery, error) {
+	claimed, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.name,
+		MinIdle:  c.ClaimIdle,
+		Start:    "0-0",
+		Count:    int64(n),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending entries: %w", err)
+	}
+	if len(claimed) > 0 {
+		batch := make([]delivery, 0, len(claimed))
+		for _, msg := range claimed {
+			deliveries, err := c.deliveries(ctx, msg.ID)
+			if err != nil {
+				return batch, err
+			}
+			batch = append(batch, delivery{msg: msg, deliveries: deliveries})
+		}
+		return batch, nil
+	}
+
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.name,
+		Streams:  []string{c.stream, ">"},
+		Count:    int64(n),
+		Block:    c.Block,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil // Nothing arrived
+		}
+		return nil, err
+	}
+	var batch []delivery
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			batch = append(batch, delivery{msg: msg, deliveries: 1})
+		}
+	}
+	return batch, nil
+}
+
+// deliveries returns how often the pending entry id has been delivered.
+func (c *Consumer) deliveries(ctx context.Context, id string) (int64, error) {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect pending entry %s: %w", id, err)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	return pending[0].RetryCount, nil
+}
+
+func (c *Consumer) handle(ctx context.Context, msg redis.XMessage, deliveries int64) {
+	data, err := EntryData(msg)
+	if err == nil {
+		if deliveries > c.MaxDeliveries {
+			c.deadLetter(ctx, msg, fmt.Sprintf("gave up after %d deliveries", deliveries-1))
+			return
+		}
+		err = c.callHandler(ctx, data)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidEvent) {
+			c.deadLetter(ctx, msg, err.Error())
+			return
+		}
+		c.metrics.Add("failed", 1)
+		log.Printf("Error handling entry %s of %s (delivery %d of %d): %v", msg.ID, c.stream, deliveries, c.MaxDeliveries, err)
+		return
+	}
+	c.metrics.Add("handled", 1)
+	c.ack(ctx, msg.ID)
+}
+
+func (c *Consumer) callHandler(ctx context.Context, data []byte) error {
+	if c.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.HandlerTimeout)
+		defer cancel()
+	}
+	return c.handler(ctx, data)
+}
+
+// deadLetter copies an entry to the dead-letter stream with the reason it was
+// given up on, then acknowledges it.
+func (c *Consumer) deadLetter(ctx context.Context, msg redis.XMessage, reason string) {
+	values := make(map[string]interface{}, len(msg.Values)+3)
+	for field, value := range msg.Values {
+		values[field] = value
+	}
+	values["source_id"] = msg.ID
+	values["consumer_group"] = c.group
+	values["reason"] = reason
+
+	dead := DeadLetterStream(c.stream)
+	if err := c.client.XAdd(ctx, &redis.XAddArgs{Stream: dead, Values: values}).Err(); err != nil {
+		log.Printf("Error moving entry %s of %s to %s: %v", msg.ID, c.stream, dead, err)
+		return // Stays pending and is dead-lettered on a later claim
+	}
+	c.metrics.Add("dead_lettered", 1)
+	log.Printf("Moved entry %s of %s to %s: %s", msg.ID, c.stream, dead, reason)
+	c.ack(ctx, msg.ID)
+}
+
+func (c *Consumer) ack(ctx context.Context, id string) {
+	if err := c.client.XAck(ctx, c.stream, c.group, id).Err(); err != nil {
+		log.Printf("Error acknowledging entry %s of %s: %v", id, c.stream, err)
+	}
+}
+
+// EntryData returns the encoded envelope carried by a stream entry.
+func EntryData(msg redis.XMessage) ([]byte, error) {
+	value, ok := msg.Values[eventField]
+	if !ok {
+		return nil, fmt.Errorf("%w: stream entry %s has no %q field", ErrInvalidEvent, msg.ID, eventField)
+	}
+	data, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: stream entry %s has a non-string %q field", ErrInvalidEvent, msg.ID, eventField)
+	}
+	return []byte(data), nil
+}
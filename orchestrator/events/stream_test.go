@@ -0,0 +1,258 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// fakeStreams serves the stream commands a Consumer uses from memory for a
+// single stream and consumer group. Calling any other command panics.
+type fakeStreams struct {
+	redis.Cmdable
+
+	mu      sync.Mutex
+	entries []redis.XMessage
+	// read is how many entries were delivered to the group.
+	read    int
+	pending map[string]*fakePending
+	acked   []string
+	added   map[string][]map[string]interface{}
+}
+
+type fakePending struct {
+	msg        redis.XMessage
+	consumer   string
+	deliveries int64
+	since      time.Time
+}
+
+func newFakeStreams(events ...string) *fakeStreams {
+	f := &fakeStreams{pending: make(map[string]*fakePending), added: make(map[string][]map[string]interface{})}
+	for i, event := range events {
+		f.entries = append(f.entries, redis.XMessage{
+			ID:     fmt.Sprintf("%d-0", i+1),
+			Values: map[string]interface{}{eventField: event},
+		})
+	}
+	return f
+}
+
+func (f *fakeStreams) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	cmd := redis.NewStatusCmd(ctx)
+	cmd.SetVal("OK")
+	return cmd
+}
+
+func (f *fakeStreams) XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []redis.XMessage
+	for _, msg := range f.entries[:f.read] {
+		p, ok := f.pending[msg.ID]
+		if !ok || time.Since(p.since) < a.MinIdle || int64(len(claimed)) == a.Count {
+			continue
+		}
+		p.consumer = a.Consumer
+		p.deliveries++
+		p.since = time.Now()
+		claimed = append(claimed, msg)
+	}
+	cmd := redis.NewXAutoClaimCmd(ctx)
+	cmd.SetVal(claimed, "0-0")
+	return cmd
+}
+
+func (f *fakeStreams) XPendingExt(ctx context.Context, a *redis.XPendingExtArgs) *redis.XPendingExtCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var pending []redis.XPendingExt
+	if p, ok := f.pending[a.Start]; ok {
+		pending = append(pending, redis.XPendingExt{ID: a.Start, Consumer: p.consumer, Idle: time.Since(p.since), RetryCount: p.deliveries})
+	}
+	cmd := redis.NewXPendingExtCmd(ctx)
+	cmd.SetVal(pending)
+	return cmd
+}
+
+func (f *fakeStreams) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	cmd := redis.NewXStreamSliceCmd(ctx)
+	f.mu.Lock()
+	var messages []redis.XMessage
+	for f.read < len(f.entries) && int64(len(messages)) < a.Count {
+		msg := f.entries[f.read]
+		f.pending[msg.ID] = &fakePending{msg: msg, consumer: a.Consumer, deliveries: 1, since: time.Now()}
+		messages = append(messages, msg)
+		f.read++
+	}
+	f.mu.Unlock()
+
+	if len(messages) == 0 {
+		select {
+		case <-time.After(a.Block):
+			cmd.SetErr(redis.Nil)
+		case <-ctx.Done():
+			cmd.SetErr(ctx.Err())
+		}
+		return cmd
+	}
+	cmd.SetVal([]redis.XStream{{Stream: a.Streams[0], Messages: messages}})
+	return cmd
+}
+
+func (f *fakeStreams) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := a.Values.(map[string]interface{})
+	f.added[a.Stream] = append(f.added[a.Stream], values)
+	cmd := redis.NewStringCmd(ctx)
+	cmd.SetVal(fmt.Sprintf("%d-0", len(f.added[a.Stream])))
+	return cmd
+}
+
+func (f *fakeStreams) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.pending, id)
+		f.acked = append(f.acked, id)
+	}
+	cmd := redis.NewIntCmd(ctx)
+	cmd.SetVal(int64(len(ids)))
+	return cmd
+}
+
+func (f *fakeStreams) ackedIDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.acked...)
+}
+
+func (f *fakeStreams) addedTo(stream string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.added[stream]
+}
+
+// runConsumer runs c until the test ends and fails the test if Run returns an
+// error.
+func runConsumer(t *testing.T, c *Consumer) {
+	t.Helper()
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(context.Background()) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := c.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown failed: %v", err)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+	})
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// countingHandler fails the first failures calls with err and counts calls.
+type countingHandler struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+	err      error
+}
+
+func (h *countingHandler) handle(ctx context.Context, data []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	if h.calls <= h.failures {
+		return h.err
+	}
+	return nil
+}
+
+func (h *countingHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls
+}
+
+func newTestConsumer(client redis.Cmdable, stream string, handler Handler) *Consumer {
+	c := NewConsumer(client, stream, OrchestratorGroup, "replica-a", handler)
+	c.Block = 10 * time.Millisecond
+	c.ClaimIdle = 20 * time.Millisecond
+	c.HandlerTimeout = 10 * time.Millisecond
+	c.Workers = 2
+	return c
+}
+
+func TestConsumer_HandlesAndAcknowledgesEntries(t *testing.T) {
+	streams := newFakeStreams(`{"n": 1}`, `{"n": 2}`, `{"n": 3}`)
+	handler := &countingHandler{}
+	runConsumer(t, newTestConsumer(streams, "handled_test_events", handler.handle))
+
+	waitFor(t, "every entry to be acknowledged", func() bool { return len(streams.ackedIDs()) == 3 })
+	if handler.count() != 3 {
+		t.Errorf("Expected each entry to be handled once, got %d calls", handler.count())
+	}
+}
+
+func TestConsumer_RedeliversFailedEntries(t *testing.T) {
+	streams := newFakeStreams(`{"n": 1}`)
+	handler := &countingHandler{failures: 1, err: errors.New("database unavailable")}
+	runConsumer(t, newTestConsumer(streams, "redelivery_test_events", handler.handle))
+
+	waitFor(t, "the entry to be acknowledged", func() bool { return len(streams.ackedIDs()) == 1 })
+	if handler.count() != 2 {
+		t.Errorf("Expected the entry to be claimed again after failing, got %d calls", handler.count())
+	}
+	if dead := streams.addedTo(DeadLetterStream("redelivery_test_events")); len(dead) != 0 {
+		t.Errorf("Expected nothing to be dead-lettered, got %v", dead)
+	}
+}
+
+func TestConsumer_DeadLettersAfterMaxDeliveries(t *testing.T) {
+	streams := newFakeStreams(`{"n": 1}`)
+	handler := &countingHandler{failures: 100, err: errors.New("database unavailable")}
+	consumer := newTestConsumer(streams, "exhausted_test_events", handler.handle)
+	consumer.MaxDeliveries = 2
+	runConsumer(t, consumer)
+
+	dead := DeadLetterStream("exhausted_test_events")
+	waitFor(t, "the entry to be dead-lettered", func() bool { return len(streams.addedTo(dead)) == 1 })
+	entry := streams.addedTo(dead)[0]
+	if entry["source_id"] != "1-0" || entry["reason"] != "gave up after 2 deliveries" || entry[eventField] != `{"n": 1}` {
+		t.Errorf("Unexpected dead-letter entry %v", entry)
+	}
+	waitFor(t, "the entry to be acknowledged", func() bool { return len(streams.ackedIDs()) == 1 })
+	if handler.count() != 2 {
+		t.Errorf("Expected the handler to be called MaxDeliveries times, got %d", handler.count())
+	}
+}
+
+func TestConsumer_DeadLettersInvalidEventsAtOnce(t *testing.T) {
+	streams := newFakeStreams(`{"n": 1}`)
+	handler := &countingHandler{failures: 1, err: fmt.Errorf("%w: unknown workflow", ErrInvalidEvent)}
+	runConsumer(t, newTestConsumer(streams, "invalid_test_events", handler.handle))
+
+	dead := DeadLetterStream("invalid_test_events")
+	waitFor(t, "the entry to be dead-lettered", func() bool { return len(streams.addedTo(dead)) == 1 })
+	if handler.count() != 1 {
+		t.Errorf("Expected an invalid event not to be retried, got %d calls", handler.count())
+	}
+}
@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"workflow-engine/llm"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+func TestBuildRequest(t *testing.T) {
+	stage := workflow.Stage{Name: "design", Persona: "architect", Outputs: []string{"design", "risks"}}
+	run := &store.StageRun{
+		Prompt:       sql.NullString{String: "You are an architect.", Valid: true},
+		InputContext: json.RawMessage(`{"requirements":"a todo app"}`),
+	}
+
+	req, err := BuildRequest(llm.ModelConfig{Model: "echo"}, stage, run)
+	if err != nil {
+		t.Fatalf("BuildRequest failed: %v", err)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != llm.RoleSystem || req.Messages[0].Content != "You are an architect." {
+		t.Fatalf("Unexpected messages %+v", req.Messages)
+	}
+	user := req.Messages[1].Content
+	if !strings.Contains(user, `"requirements": "a todo app"`) || !strings.Contains(user, "keys: design, risks.") {
+		t.Errorf("Unexpected user message %q", user)
+	}
+	if len(req.OutputKeys) != 2 {
+		t.Errorf("Expected 2 output keys, got %v", req.OutputKeys)
+	}
+
+	run.Prompt = sql.NullString{}
+	if _, err := BuildRequest(llm.ModelConfig{Model: "echo"}, stage, run); err == nil {
+		t.Error("Expected an error for a run without a rendered prompt")
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	withOutputs := workflow.Stage{Outputs: []string{"design"}}
+
+	output, err := ParseOutput(withOutputs, "```json\n{\"design\": \"layers\"}\n```")
+	if err != nil {
+		t.Fatalf("ParseOutput failed: %v", err)
+	}
+	if string(output) != `{"design":"layers"}` {
+		t.Errorf("Unexpected output %s", output)
+	}
+
+	if _, err := ParseOutput(withOutputs, "Here is the design: layers"); err == nil {
+		t.Error("Expected an error for a non-JSON response")
+	}
+
+	output, err = ParseOutput(workflow.Stage{}, "free text")
+	if err != nil {
+		t.Fatalf("ParseOutput failed: %v", err)
+	}
+	if string(output) != `{"response":"free text"}` {
+		t.Errorf("Unexpected output %s", output)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want workflow.ErrorClass
+	}{
+		{&StageError{Class: workflow.ErrorClassTimeout, Err: context.DeadlineExceeded}, workflow.ErrorClassTimeout},
+		{fmt.Errorf("stage design: %w", &StageError{Class: workflow.ErrorClassInvalidOutput, Err: errors.New("not JSON")}), workflow.ErrorClassInvalidOutput},
+		{errors.New("connection refused"), workflow.ErrorClassInternal},
+	}
+	for _, tc := range cases {
+		if got := Classify(tc.err); got != tc.want {
+			t.Errorf("Classify(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
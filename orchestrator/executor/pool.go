@@ -0,0 +1,360 @@
+// Package executor runs pending stage runs: it sends the persona prompt
+// rendered when the run was scheduled to the persona's model and stores the
+// response as the run's output.
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"workflow-engine/llm"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// Scheduler is the part of the scheduler the pool reports back to.
+type Scheduler interface {
+	StageFor(ctx context.Context, run *store.StageRun) (workflow.Stage, error)
+	StageRunFinished(ctx context.Context, stageRunID uuid.UUID) error
+}
+
+// Completer sends a request to a model provider.
+type Completer interface {
+	Complete(ctx context.Context, req llm.Request) (*llm.Response, error)
+}
+
+// StageRuns is the part of the stage run store the pool uses to claim, lease
+// and finish runs. *store.StageRunStore implements it.
+type StageRuns interface {
+	ClaimStageRun(ctx context.Context, owner string, ttl time.Duration) (*store.StageRun, error)
+	RenewStageRunLease(ctx context.Context, id uuid.UUID, owner string, ttl time.Duration) error
+	FinishStageRun(ctx context.Context, id uuid.UUID, owner string, outcome store.StageRunOutcome) error
+	ReleaseStageRun(ctx context.Context, id uuid.UUID, owner string) error
+	FailExpiredStageRuns(ctx context.Context, class, message string) ([]*store.StageRun, error)
+}
+
+// PersonaVersions looks up the persona version a run is pinned to.
+// *store.PersonaStore implements it.
+type PersonaVersions interface {
+	GetPersonaVersion(ctx context.Context, id uuid.UUID) (*store.PersonaVersion, error)
+}
+
+// Pool executes pending stage runs on a fixed number of workers. Workers
+// claim runs from the database under a lease held by the pool's owner name,
+// so several orchestrator replicas can share the same stage_runs table: a run
+// is executed by one replica at a time, and a run whose replica dies fails
+// once its lease expires and is retried as its stage's retry policy allows.
+type Pool struct {
+	runs         StageRuns
+	personas     PersonaVersions
+	models       Completer
+	owner        string
+	concurrency  int
+	pollInterval time.Duration
+	leaseTTL     time.Duration
+
+	// wake tells idle workers that a run may be waiting.
+	wake chan struct{}
+	// stop is closed by Shutdown to stop workers claiming runs.
+	stop     chan struct{}
+	stopOnce sync.Once
+	// abort is closed when the drain deadline passes, cancelling the runs
+	// still executing.
+	abort   chan struct{}
+	workers sync.WaitGroup
+}
+
+// NewPool returns a pool whose leases are held as owner, which must be unique
+// among the replicas sharing the database. Leases last leaseTTL and are
+// renewed while a run executes; idle workers look for runs every
+// pollInterval.
+func NewPool(runs StageRuns, personas PersonaVersions, models Completer, owner string, concurrency int, pollInterval, leaseTTL time.Duration) *Pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Pool{
+		runs:         runs,
+		personas:     personas,
+		models:       models,
+		owner:        owner,
+		concurrency:  concurrency,
+		pollInterval: pollInterval,
+		leaseTTL:     leaseTTL,
+		wake:         make(chan struct{}, concurrency),
+		stop:         make(chan struct{}),
+		abort:        make(chan struct{}),
+	}
+}
+
+// Dispatch wakes an idle worker to claim the run. It never blocks: when every
+// worker is busy the run stays pending until one is free.
+func (p *Pool) Dispatch(ctx context.Context, run *store.StageRun) {
+	p.notify()
+}
+
+func (p *Pool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the workers and the lease expiry check. They stop when ctx is
+// done or the pool is shut down.
+func (p *Pool) Start(ctx context.Context, scheduler Scheduler) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		<-p.abort
+		cancel()
+	}()
+	for i := 0; i < p.concurrency; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			p.work(ctx, scheduler)
+		}()
+	}
+	go p.expireLeases(ctx, scheduler)
+	log.Printf("Stage executor %s started with %d workers.", p.owner, p.concurrency)
+}
+
+// Shutdown stops the workers claiming runs and waits for the runs they are
+// executing. Runs still executing when ctx is done are cancelled and returned
+// to pending for another replica, or this one after a restart, to pick up.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	drained := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+	close(p.abort)
+	<-drained
+	return fmt.Errorf("stage executor did not drain in time, unfinished runs were released: %w", ctx.Err())
+}
+
+func (p *Pool) stopping() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// work claims and executes runs until none is due, then waits to be woken or
+// for the next poll.
+func (p *Pool) work(ctx context.Context, scheduler Scheduler) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for !p.stopping() {
+		run, err := p.runs.ClaimStageRun(ctx, p.owner, p.leaseTTL)
+		if err != nil {
+			log.Printf("Error claiming stage run: %v", err)
+		}
+		if run != nil {
+			if err := p.execute(ctx, scheduler, run); err != nil {
+				log.Printf("Error executing stage run %s: %v", run.ID, err)
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireLeases fails runs whose lease expired every pollInterval and hands
+// them to the scheduler, which retries them or fails their project.
+func (p *Pool) expireLeases(ctx context.Context, scheduler Scheduler) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		expired, err := p.runs.FailExpiredStageRuns(ctx,
+			string(workflow.ErrorClassInternal), "lease expired before the stage run finished")
+		if err != nil {
+			log.Printf("Error failing expired stage runs: %v", err)
+			continue
+		}
+		for _, run := range expired {
+			log.Printf("Stage run %s (attempt %d) failed after its lease expired.", run.ID, run.Attempt)
+			if err := scheduler.StageRunFinished(ctx, run.ID); err != nil {
+				log.Printf("Error advancing project %s: %v", run.ProjectID, err)
+			}
+		}
+		if len(expired) > 0 {
+			p.notify()
+		}
+	}
+}
+
+// execute runs a claimed stage run to completed or failed while renewing its
+// lease, then hands it back to the scheduler. If the lease is lost midway the
+// run is abandoned to whichever replica fails it on expiry; if the pool is aborted
+// the run is released to pending.
+func (p *Pool) execute(ctx context.Context, scheduler Scheduler, run *store.StageRun) error {
+	log.Printf("Running stage %s (run %s, attempt %d) for project %s.", run.StageName, run.ID, run.Attempt, run.ProjectID)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+		p.heartbeat(runCtx, cancel, run.ID)
+	}()
+	output, runErr := p.runStage(runCtx, scheduler, run)
+	cancel()
+	<-heartbeat
+
+	if ctx.Err() != nil {
+		return p.release(run) // Shutting down; the outcome cannot be recorded
+	}
+
+	outcome := store.StageRunOutcome{Status: store.StageRunStatusCompleted, Output: output}
+	if runErr != nil {
+		log.Printf("Stage run %s failed: %v", run.ID, runErr)
+		outcome = store.StageRunOutcome{
+			Status:     store.StageRunStatusFailed,
+			ErrorClass: string(Classify(runErr)),
+			Error:      runErr.Error(),
+		}
+	}
+	if err := p.runs.FinishStageRun(ctx, run.ID, p.owner, outcome); err != nil {
+		if errors.Is(err, store.ErrLeaseLost) {
+			log.Printf("Discarding result of stage run %s: %v", run.ID, err)
+			return nil
+		}
+		return err
+	}
+	if err := scheduler.StageRunFinished(ctx, run.ID); err != nil {
+		return fmt.Errorf("failed to advance project %s: %w", run.ProjectID, err)
+	}
+	return nil
+}
+
+// release returns a run interrupted by shutdown to pending. It uses a context
+// of its own as the pool's is already cancelled.
+func (p *Pool) release(run *store.StageRun) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.runs.ReleaseStageRun(ctx, run.ID, p.owner); err != nil {
+		if errors.Is(err, store.ErrLeaseLost) {
+			return nil // Already failed on lease expiry
+		}
+		return fmt.Errorf("failed to release interrupted stage run: %w", err)
+	}
+	log.Printf("Released stage run %s back to pending on shutdown.", run.ID)
+	return nil
+}
+
+// heartbeat renews the lease on a run a third of the lease TTL at a time
+// until ctx is done. It cancels the run when the lease is lost.
+func (p *Pool) heartbeat(ctx context.Context, cancel context.CancelFunc, id uuid.UUID) {
+	ticker := time.NewTicker(p.leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := p.runs.RenewStageRunLease(ctx, id, p.owner, p.leaseTTL)
+		if errors.Is(err, store.ErrLeaseLost) {
+			log.Printf("Lost lease on stage run %s, abandoning it.", id)
+			cancel()
+			return
+		}
+		if err != nil {
+			log.Printf("Error renewing lease on stage run %s: %v", id, err)
+		}
+	}
+}
+
+func (p *Pool) runStage(ctx context.Context, scheduler Scheduler, run *store.StageRun) ([]byte, error) {
+	stage, err := scheduler.StageFor(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := p.modelConfig(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	req, err := BuildRequest(*cfg, stage, run)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.models.Complete(ctx, req)
+	if err != nil {
+		class := workflow.ErrorClassProvider
+		if errors.Is(err, context.DeadlineExceeded) {
+			class = workflow.ErrorClassTimeout
+		}
+		return nil, &StageError{Class: class, Err: err}
+	}
+	output, err := ParseOutput(stage, resp.Content)
+	if err != nil {
+		return nil, &StageError{Class: workflow.ErrorClassInvalidOutput, Err: err}
+	}
+	return output, nil
+}
+
+// StageError is a stage run failure attributed to an error class.
+type StageError struct {
+	Class workflow.ErrorClass
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the error class of a stage run failure; errors not raised
+// by the model call or output parsing are internal.
+func Classify(err error) workflow.ErrorClass {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return stageErr.Class
+	}
+	return workflow.ErrorClassInternal
+}
+
+// modelConfig loads the model config of the persona version the run is pinned to.
+func (p *Pool) modelConfig(ctx context.Context, run *store.StageRun) (*llm.ModelConfig, error) {
+	if !run.PersonaVersionID.Valid {
+		return nil, fmt.Errorf("stage run %s has no persona version", run.ID)
+	}
+	version, err := p.personas.GetPersonaVersion(ctx, run.PersonaVersionID.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return nil, fmt.Errorf("persona version %s of stage run %s not found", run.PersonaVersionID.UUID, run.ID)
+	}
+	return llm.ParseModelConfig(version.ModelConfig)
+}
@@ -0,0 +1,259 @@
+package executor
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"workflow-engine/llm"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// fakeStageRuns is an in-memory StageRuns. Claims hand out the pending runs
+// in order and each lease expiry check fails the expired runs once.
+type fakeStageRuns struct {
+	mu      sync.Mutex
+	pending []*store.StageRun
+	expired []*store.StageRun
+	// renewErr and finishErr are returned by every lease renewal and finish.
+	renewErr  error
+	finishErr error
+
+	renewals int
+	finished map[uuid.UUID]store.StageRunOutcome
+	released []uuid.UUID
+}
+
+func (f *fakeStageRuns) ClaimStageRun(ctx context.Context, owner string, ttl time.Duration) (*store.StageRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) == 0 {
+		return nil, nil
+	}
+	run := f.pending[0]
+	f.pending = f.pending[1:]
+	return run, nil
+}
+
+func (f *fakeStageRuns) RenewStageRunLease(ctx context.Context, id uuid.UUID, owner string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewals++
+	return f.renewErr
+}
+
+func (f *fakeStageRuns) FinishStageRun(ctx context.Context, id uuid.UUID, owner string, outcome store.StageRunOutcome) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.finished == nil {
+		f.finished = make(map[uuid.UUID]store.StageRunOutcome)
+	}
+	f.finished[id] = outcome
+	return f.finishErr
+}
+
+func (f *fakeStageRuns) ReleaseStageRun(ctx context.Context, id uuid.UUID, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = append(f.released, id)
+	return nil
+}
+
+func (f *fakeStageRuns) FailExpiredStageRuns(ctx context.Context, class, message string) ([]*store.StageRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	expired := f.expired
+	f.expired = nil
+	return expired, nil
+}
+
+func (f *fakeStageRuns) outcome(id uuid.UUID) (store.StageRunOutcome, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	outcome, ok := f.finished[id]
+	return outcome, ok
+}
+
+// fakePersonas pins every run to a version of the fake model.
+type fakePersonas struct{}
+
+func (fakePersonas) GetPersonaVersion(ctx context.Context, id uuid.UUID) (*store.PersonaVersion, error) {
+	return &store.PersonaVersion{ID: id, ModelConfig: json.RawMessage(`{"provider": "fake", "model": "echo"}`)}, nil
+}
+
+// fakeScheduler runs every stage as stage and reports the runs handed back to
+// it on finished.
+type fakeScheduler struct {
+	stage    workflow.Stage
+	finished chan uuid.UUID
+}
+
+func newFakeScheduler(stage workflow.Stage) *fakeScheduler {
+	return &fakeScheduler{stage: stage, finished: make(chan uuid.UUID, 10)}
+}
+
+func (s *fakeScheduler) StageFor(ctx context.Context, run *store.StageRun) (workflow.Stage, error) {
+	return s.stage, nil
+}
+
+func (s *fakeScheduler) StageRunFinished(ctx context.Context, stageRunID uuid.UUID) error {
+	s.finished <- stageRunID
+	return nil
+}
+
+// blockingModel answers only once the request is cancelled.
+type blockingModel struct {
+	started chan struct{}
+}
+
+func (m *blockingModel) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	m.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func pendingRun() *store.StageRun {
+	return &store.StageRun{
+		ID:               uuid.New(),
+		ProjectID:        uuid.New(),
+		StageName:        "plan",
+		Attempt:          1,
+		Status:           store.StageRunStatusRunning,
+		Prompt:           sql.NullString{String: "You are a planner.", Valid: true},
+		PersonaVersionID: uuid.NullUUID{UUID: uuid.New(), Valid: true},
+	}
+}
+
+func waitFinished(t *testing.T, scheduler *fakeScheduler) uuid.UUID {
+	t.Helper()
+	select {
+	case id := <-scheduler.finished:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a run to be handed to the scheduler")
+		return uuid.Nil
+	}
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPool_FinishesClaimedRun(t *testing.T) {
+	run := pendingRun()
+	runs := &fakeStageRuns{pending: []*store.StageRun{run}}
+	scheduler := newFakeScheduler(workflow.Stage{Name: "plan", Outputs: []string{"plan"}})
+	pool := NewPool(runs, fakePersonas{}, &llm.Fake{}, "replica-a", 1, 10*time.Millisecond, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx, scheduler)
+	defer pool.Shutdown(context.Background())
+
+	if id := waitFinished(t, scheduler); id != run.ID {
+		t.Fatalf("Expected run %s to be handed to the scheduler, got %s", run.ID, id)
+	}
+	outcome, ok := runs.outcome(run.ID)
+	if !ok || outcome.Status != store.StageRunStatusCompleted {
+		t.Fatalf("Expected the run to be finished as completed before the handoff, got %+v", outcome)
+	}
+	var output map[string]string
+	if err := json.Unmarshal(outcome.Output, &output); err != nil || output["plan"] == "" {
+		t.Errorf("Expected the model's plan as output, got %s", outcome.Output)
+	}
+}
+
+func TestPool_HandsExpiredLeasesToScheduler(t *testing.T) {
+	expired := pendingRun()
+	runs := &fakeStageRuns{expired: []*store.StageRun{expired}}
+	scheduler := newFakeScheduler(workflow.Stage{Name: "plan"})
+	pool := NewPool(runs, fakePersonas{}, &llm.Fake{}, "replica-a", 1, 10*time.Millisecond, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx, scheduler)
+	defer pool.Shutdown(context.Background())
+
+	if id := waitFinished(t, scheduler); id != expired.ID {
+		t.Fatalf("Expected the expired run %s to be handed to the scheduler, got %s", expired.ID, id)
+	}
+}
+
+func TestPool_ReleasesRunsOnShutdown(t *testing.T) {
+	run := pendingRun()
+	runs := &fakeStageRuns{pending: []*store.StageRun{run}}
+	scheduler := newFakeScheduler(workflow.Stage{Name: "plan"})
+	model := &blockingModel{started: make(chan struct{}, 1)}
+	pool := NewPool(runs, fakePersonas{}, model, "replica-a", 1, 10*time.Millisecond, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx, scheduler)
+	<-model.started
+
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+	cancelDrain()
+	if err := pool.Shutdown(drainCtx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the drain deadline to be reported, got %v", err)
+	}
+	if len(runs.released) != 1 || runs.released[0] != run.ID {
+		t.Errorf("Expected run %s to be released, got %v", run.ID, runs.released)
+	}
+	if _, ok := runs.outcome(run.ID); ok {
+		t.Error("Expected no outcome to be recorded for an interrupted run")
+	}
+	select {
+	case id := <-scheduler.finished:
+		t.Errorf("Expected the released run not to be handed to the scheduler, got %s", id)
+	default:
+	}
+}
+
+func TestPool_AbandonsRunWhenLeaseIsLost(t *testing.T) {
+	run := pendingRun()
+	runs := &fakeStageRuns{
+		pending:   []*store.StageRun{run},
+		renewErr:  store.ErrLeaseLost,
+		finishErr: store.ErrLeaseLost,
+	}
+	scheduler := newFakeScheduler(workflow.Stage{Name: "plan"})
+	model := &blockingModel{started: make(chan struct{}, 1)}
+	pool := NewPool(runs, fakePersonas{}, model, "replica-a", 1, 10*time.Millisecond, 30*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx, scheduler)
+	defer pool.Shutdown(context.Background())
+
+	<-model.started
+	waitFor(t, "the abandoned run's result", func() bool {
+		_, ok := runs.outcome(run.ID)
+		return ok
+	})
+	outcome, _ := runs.outcome(run.ID)
+	if outcome.Status != store.StageRunStatusFailed {
+		t.Errorf("Expected the cancelled run's result to be a failure, got %s", outcome.Status)
+	}
+	select {
+	case id := <-scheduler.finished:
+		t.Errorf("Expected the discarded result not to be handed to the scheduler, got %s", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(runs.released) != 0 {
+		t.Errorf("Expected a run with a lost lease not to be released, got %v", runs.released)
+	}
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"workflow-engine/llm"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+// ResponseKey holds a free-text model response for stages that declare no outputs.
+const ResponseKey = "response"
+
+// BuildRequest turns a stage run into a completion request: the rendered
+// persona prompt is the system message, and the user message carries the run's
+// input context and the output keys the stage must produce.
+func BuildRequest(cfg llm.ModelConfig, stage workflow.Stage, run *store.StageRun) (llm.Request, error) {
+	if !run.Prompt.Valid {
+		return llm.Request{}, fmt.Errorf("stage run %s has no rendered prompt", run.ID)
+	}
+
+	var user strings.Builder
+	if len(run.InputContext) > 0 && string(run.InputContext) != "null" {
+		var input bytes.Buffer
+		if err := json.Indent(&input, run.InputContext, "", "  "); err != nil {
+			return llm.Request{}, fmt.Errorf("stage run %s has invalid input context: %w", run.ID, err)
+		}
+		user.WriteString("Input context:\n")
+		user.Write(input.Bytes())
+		user.WriteString("\n\n")
+	}
+	if len(stage.Outputs) > 0 {
+		fmt.Fprintf(&user, "Respond with a single JSON object containing exactly these keys: %s.", strings.Join(stage.Outputs, ", "))
+	} else {
+		user.WriteString("Respond with your work for this stage.")
+	}
+
+	return llm.Request{
+		Config: cfg,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: run.Prompt.String},
+			{Role: llm.RoleUser, Content: user.String()},
+		},
+		OutputKeys: stage.Outputs,
+	}, nil
+}
+
+// ParseOutput converts a model response into a stage run's output context. A
+// stage with declared outputs must get a JSON object back, optionally wrapped
+// in a Markdown code fence; otherwise the text is stored under ResponseKey.
+func ParseOutput(stage workflow.Stage, content string) (json.RawMessage, error) {
+	if len(stage.Outputs) == 0 {
+		return json.Marshal(map[string]string{ResponseKey: content})
+	}
+
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	var output map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		return nil, fmt.Errorf("model response is not a JSON object: %w", err)
+	}
+	return json.Marshal(output)
+}
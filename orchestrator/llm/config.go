@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ModelConfig is the typed form of a persona's model_config column.
+type ModelConfig struct {
+	// Provider names a registered Provider; empty means the registry default.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model"`
+	// Temperature is left to the provider's default when nil.
+	Temperature   *float64     `json:"temperature,omitempty"`
+	MaxTokens     int          `json:"max_tokens,omitempty"`
+	StopSequences []string     `json:"stop_sequences,omitempty"`
+	Tools         ToolSettings `json:"tools,omitempty"`
+}
+
+type ToolChoice string
+
+const (
+	ToolChoiceAuto     ToolChoice = "auto"
+	ToolChoiceNone     ToolChoice = "none"
+	ToolChoiceRequired ToolChoice = "required"
+)
+
+// ToolSettings controls whether the model may call tools and which ones.
+type ToolSettings struct {
+	Enabled bool       `json:"enabled,omitempty"`
+	Allowed []string   `json:"allowed,omitempty"`
+	Choice  ToolChoice `json:"choice,omitempty"`
+}
+
+const (
+	MaxTemperature   = 2.0
+	MaxStopSequences = 4
+)
+
+// ConfigError lists every problem found in a model config.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid model config: " + strings.Join(e.Problems, "; ")
+}
+
+// ParseModelConfig decodes and validates a model_config document. Unknown
+// fields are rejected so typos do not silently fall back to defaults.
+func ParseModelConfig(raw json.RawMessage) (*ModelConfig, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return nil, &ConfigError{Problems: []string{"model config is required"}}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	cfg := &ModelConfig{}
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, &ConfigError{Problems: []string{err.Error()}}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the config on its own; whether the provider exists is
+// checked by Registry.ValidateModelConfig.
+func (c *ModelConfig) Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(c.Model) == "" {
+		addf("model is required")
+	}
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > MaxTemperature) {
+		addf("temperature %.2f is outside [0, %.1f]", *c.Temperature, MaxTemperature)
+	}
+	if c.MaxTokens < 0 {
+		addf("max_tokens must not be negative")
+	}
+	if len(c.StopSequences) > MaxStopSequences {
+		addf("at most %d stop sequences are allowed, got %d", MaxStopSequences, len(c.StopSequences))
+	}
+	for i, stop := range c.StopSequences {
+		if stop == "" {
+			addf("stop sequence %d is empty", i)
+		}
+	}
+	switch c.Tools.Choice {
+	case "", ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+	default:
+		addf("unknown tool choice %q", c.Tools.Choice)
+	}
+	if !c.Tools.Enabled && (len(c.Tools.Allowed) > 0 || c.Tools.Choice == ToolChoiceRequired) {
+		addf("tools are configured but not enabled")
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
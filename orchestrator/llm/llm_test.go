@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"workflow-engine/store"
+)
+
+func TestParseModelConfig(t *testing.T) {
+	cfg, err := ParseModelConfig(json.RawMessage(`{
+		"provider": "fake",
+		"model": "echo",
+		"temperature": 0.2,
+		"max_tokens": 512,
+		"stop_sequences": ["END"],
+		"tools": {"enabled": true, "allowed": ["search"], "choice": "auto"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseModelConfig failed: %v", err)
+	}
+	if cfg.Model != "echo" || *cfg.Temperature != 0.2 || cfg.MaxTokens != 512 || cfg.Tools.Choice != ToolChoiceAuto {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+}
+
+func TestParseModelConfig_ReportsProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		problem string
+	}{
+		{"missing", ``, "model config is required"},
+		{"unknown field", `{"model": "echo", "temprature": 1}`, "unknown field"},
+		{"no model", `{"provider": "fake"}`, "model is required"},
+		{"temperature", `{"model": "echo", "temperature": 3}`, "temperature 3.00 is outside"},
+		{"negative max tokens", `{"model": "echo", "max_tokens": -1}`, "max_tokens must not be negative"},
+		{"too many stops", `{"model": "echo", "stop_sequences": ["a", "b", "c", "d", "e"]}`, "at most 4 stop sequences"},
+		{"tool choice", `{"model": "echo", "tools": {"enabled": true, "choice": "sometimes"}}`, "unknown tool choice"},
+		{"tools disabled", `{"model": "echo", "tools": {"allowed": ["search"]}}`, "tools are configured but not enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseModelConfig(json.RawMessage(tt.raw))
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Expected *ConfigError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("Expected error to mention %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestRegistry_ValidatePersona(t *testing.T) {
+	registry := NewRegistry(FakeProviderName, &Fake{})
+
+	persona := &store.Persona{Name: "architect", ModelConfig: json.RawMessage(`{"model": "echo"}`)}
+	if err := registry.ValidatePersona(context.Background(), persona); err != nil {
+		t.Errorf("Expected default provider to be accepted, got %v", err)
+	}
+	persona.ModelConfig = json.RawMessage(`{"provider": "anthropic", "model": "x"}`)
+	if err := registry.ValidatePersona(context.Background(), persona); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestFake_IsDeterministic(t *testing.T) {
+	registry := NewRegistry(FakeProviderName, &Fake{})
+	req := Request{
+		Config:     ModelConfig{Model: "echo"},
+		Messages:   []Message{{Role: RoleSystem, Content: "You are an architect."}},
+		OutputKeys: []string{"design", "risks"},
+	}
+
+	first, err := registry.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	second, err := registry.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if first.Content != second.Content {
+		t.Errorf("Expected identical responses, got %q and %q", first.Content, second.Content)
+	}
+
+	var output map[string]string
+	if err := json.Unmarshal([]byte(first.Content), &output); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", first.Content, err)
+	}
+	if output["design"] == "" || output["risks"] == "" {
+		t.Errorf("Expected every output key to be filled, got %v", output)
+	}
+
+	req.Messages[0].Content = "You are a tester."
+	third, err := registry.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if third.Content == first.Content {
+		t.Error("Expected a different prompt to change the response")
+	}
+}
+
+func TestFake_CannedResponse(t *testing.T) {
+	fake := &Fake{Responses: map[string]string{"scripted": `{"plan": "ship it"}`}}
+	resp, err := fake.Complete(context.Background(), Request{Config: ModelConfig{Model: "scripted"}})
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if resp.Content != `{"plan": "ship it"}` {
+		t.Errorf("Unexpected content %q", resp.Content)
+	}
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const OpenAIProviderName = "openai"
+
+// OpenAI calls an OpenAI-compatible chat completions endpoint.
+type OpenAI struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewOpenAI(baseURL, apiKey string, timeout time.Duration) *OpenAI {
+	return &OpenAI{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *OpenAI) Name() string {
+	return OpenAIProviderName
+}
+
+type openAIRequest struct {
+	Model          string            `json:"model"`
+	Messages       []Message         `json:"messages"`
+	Temperature    *float64          `json:"temperature,omitempty"`
+	MaxTokens      int               `json:"max_tokens,omitempty"`
+	Stop           []string          `json:"stop,omitempty"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAI) Complete(ctx context.Context, req Request) (*Response, error) {
+	if req.Config.Tools.Enabled {
+		// Personas do not declare tool definitions yet.
+		return nil, errors.New("tool calling is not supported")
+	}
+
+	body := openAIRequest{
+		Model:       req.Config.Model,
+		Messages:    req.Messages,
+		Temperature: req.Config.Temperature,
+		MaxTokens:   req.Config.MaxTokens,
+		Stop:        req.Config.StopSequences,
+	}
+	if len(req.OutputKeys) > 0 {
+		body.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	httpResp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	respData, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var resp openAIResponse
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return nil, fmt.Errorf("unexpected response (HTTP %d): %w", httpResp.StatusCode, err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("HTTP %d: %s", httpResp.StatusCode, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", httpResp.StatusCode)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("response has no choices")
+	}
+	return &Response{
+		Content:      resp.Choices[0].Message.Content,
+		FinishReason: resp.Choices[0].FinishReason,
+		Usage:        resp.Usage,
+	}, nil
+}
@@ -0,0 +1,132 @@
+// Package llm defines the model configuration personas run with and the
+// providers stage executors call to produce stage output.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"workflow-engine/store"
+)
+
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is one completion call.
+type Request struct {
+	Config   ModelConfig
+	Messages []Message
+	// OutputKeys are the keys the caller expects in the JSON object the model
+	// responds with. When empty the response is free text.
+	OutputKeys []string
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type Response struct {
+	Content      string
+	FinishReason string
+	Usage        Usage
+}
+
+// Provider is a model backend.
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, req Request) (*Response, error)
+}
+
+var ErrUnknownProvider = errors.New("unknown LLM provider")
+
+// Registry maps provider names to providers.
+type Registry struct {
+	providers       map[string]Provider
+	defaultProvider string
+}
+
+// NewRegistry returns a registry holding providers. Configs that name no
+// provider use defaultProvider.
+func NewRegistry(defaultProvider string, providers ...Provider) *Registry {
+	r := &Registry{
+		providers:       make(map[string]Provider),
+		defaultProvider: defaultProvider,
+	}
+	for _, provider := range providers {
+		r.Register(provider)
+	}
+	return r
+}
+
+// Register adds a provider, replacing any with the same name. It must be
+// called before the registry is used concurrently.
+func (r *Registry) Register(provider Provider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Provider returns the named provider, or the default one for an empty name.
+func (r *Registry) Provider(name string) (Provider, error) {
+	if name == "" {
+		name = r.defaultProvider
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (registered: %s)", ErrUnknownProvider, name, strings.Join(r.names(), ", "))
+	}
+	return provider, nil
+}
+
+// Complete sends req to the provider its config names.
+func (r *Registry) Complete(ctx context.Context, req Request) (*Response, error) {
+	provider, err := r.Provider(req.Config.Provider)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := provider.Complete(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s completion failed: %w", provider.Name(), err)
+	}
+	return resp, nil
+}
+
+// ValidateModelConfig parses raw and checks that its provider is registered.
+func (r *Registry) ValidateModelConfig(raw []byte) (*ModelConfig, error) {
+	cfg, err := ParseModelConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Provider(cfg.Provider); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ValidatePersona checks a persona's model config. It is registered with
+// PersonaStore.AddValidator.
+func (r *Registry) ValidatePersona(ctx context.Context, persona *store.Persona) error {
+	_, err := r.ValidateModelConfig(persona.ModelConfig)
+	return err
+}
+
+func (r *Registry) names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,79 +3,308 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"workflow-engine/api"
 	"workflow-engine/config"
+	"workflow-engine/contextbus"
+	"workflow-engine/events"
+	"workflow-engine/executor"
+	"workflow-engine/llm"
+	"workflow-engine/outbox"
+	"workflow-engine/prompt"
+	"workflow-engine/quality"
+	"workflow-engine/scheduler"
 	"workflow-engine/store"
+	"workflow-engine/workflow"
 
 	"github.com/go-redis/redis/v8" // Import Redis client
+	"github.com/google/uuid"
 )
 
-const (
-	ProjectCreatedChannel = "project_created_events"
-)
+// processedEventPruneInterval is how often processed events older than the
+// configured retention are forgotten.
+const processedEventPruneInterval = time.Hour
 
 type Orchestrator struct {
 	cfg         *config.Config
 	dbStore     *store.Store
 	redisClient *redis.Client
+	scheduler   *scheduler.Scheduler
+	executor    *executor.Pool
+	relay       *outbox.Relay
+	contextBus  *contextbus.Bus
+	api         *http.Server
 }
 
 func NewOrchestrator(cfg *config.Config, dbStore *store.Store, redisClient *redis.Client) *Orchestrator {
-	return &Orchestrator{
+	o := &Orchestrator{
 		cfg:         cfg,
 		dbStore:     dbStore,
 		redisClient: redisClient,
+		contextBus:  contextbus.New(dbStore.ContextEntries, redisClient, cfg.ContextCacheTTL),
+		relay:       outbox.NewRelay(dbStore.Outbox, redisClient, cfg.OutboxPollInterval, cfg.OutboxRetention),
+	}
+	prompts := prompt.NewEngine(dbStore.PromptPartials)
+	models := newModelRegistry(cfg)
+	dbStore.Personas.AddValidator(prompts.ValidatePersona)
+	dbStore.Personas.AddValidator(models.ValidatePersona)
+	advisor := quality.NewAdvisor(dbStore, quality.GuidelineSuggester{})
+	analyst := quality.NewModelAnalyst(dbStore.Personas, prompts, models, quality.HeuristicAnalyst{})
+	evaluator := quality.NewEvaluator(dbStore, analyst, advisor)
+	o.executor = executor.NewPool(dbStore.StageRuns, dbStore.Personas, models, cfg.InstanceID, cfg.ExecutorConcurrency, cfg.ExecutorPollInterval, cfg.ExecutorLeaseTTL)
+	o.scheduler = scheduler.New(dbStore, o.contextBus, prompts, evaluator, o.executor)
+	o.api = &http.Server{
+		Addr:              cfg.APIAddr,
+		Handler:           api.New(dbStore, o.scheduler, o.contextBus),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return o
+}
+
+// newModelRegistry registers the offline fake provider and, when an API key
+// is configured, the OpenAI-compatible one.
+func newModelRegistry(cfg *config.Config) *llm.Registry {
+	models := llm.NewRegistry(cfg.LLMProvider, &llm.Fake{})
+	if cfg.OpenAIAPIKey != "" {
+		models.Register(llm.NewOpenAI(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, cfg.LLMTimeout))
 	}
+	return models
 }
 
 func (o *Orchestrator) Run() {
 	log.Println("Orchestrator service starting...")
 
-	// Subscribe to project_created events
-	go o.subscribeToProjectCreatedEvents()
+	// Every background task runs under ctx and stops when it is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o.loadWorkflowDefinitions(ctx)
+	o.executor.Start(ctx, o.scheduler)
+	// Resume the projects and stage runs a previous run left behind.
+	go o.scheduler.RunRecovery(ctx, o.cfg.RecoveryInterval)
+	go o.pruneProcessedEvents(ctx)
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		o.relay.Run(ctx)
+	}()
+	if o.cfg.MetricsAddr != "" {
+		go o.serveMetrics()
+	}
+	if o.cfg.APIAddr != "" {
+		go o.serveAPI()
+	}
+
+	// Consume project_created events
+	consumer := o.projectCreatedConsumer()
+	go func() {
+		if err := consumer.Run(ctx); err != nil {
+			log.Printf("Error consuming %s: %v", events.ProjectCreatedStream, err)
+		}
+	}()
 
 	// Keep the service running until an interrupt signal is received
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 	<-stopChan
-	log.Println("Orchestrator service shutting down gracefully...")
+	log.Printf("Orchestrator service shutting down gracefully, draining for up to %s...", o.cfg.ShutdownTimeout)
+	o.shutdown(cancel, consumer, relayDone)
+}
+
+// shutdown stops taking on work, then waits until the drain deadline for the
+// API requests, event handlers and stage runs in flight. Stage runs still
+// executing at the deadline are returned to pending. Finally the remaining
+// background tasks are cancelled.
+func (o *Orchestrator) shutdown(cancel context.CancelFunc, consumer *events.Consumer, relayDone <-chan struct{}) {
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), o.cfg.ShutdownTimeout)
+	defer cancelDrain()
+
+	if err := o.api.Shutdown(drainCtx); err != nil {
+		log.Printf("Error draining API requests: %v", err)
+	}
+	if err := consumer.Shutdown(drainCtx); err != nil {
+		log.Printf("Error draining event handlers: %v", err)
+	}
+	if err := o.executor.Shutdown(drainCtx); err != nil {
+		log.Printf("Error draining stage executor: %v", err)
+	}
+	cancel()
+	<-relayDone
+	log.Println("Orchestrator service stopped.")
+}
+
+// serveMetrics exposes the expvar counters, such as the event consumers'
+// queue depths, at /debug/vars.
+func (o *Orchestrator) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	log.Printf("Serving metrics on %s/debug/vars", o.cfg.MetricsAddr)
+	if err := http.ListenAndServe(o.cfg.MetricsAddr, mux); err != nil {
+		log.Printf("Error serving metrics: %v", err)
+	}
 }
 
-func (o *Orchestrator) subscribeToProjectCreatedEvents() {
-	pubsub := o.redisClient.Subscribe(context.Background(), ProjectCreatedChannel)
-	defer pubsub.Close()
+// serveAPI serves the HTTP API under /api/v1 until shutdown.
+func (o *Orchestrator) serveAPI() {
+	log.Printf("Serving API on %s%s", o.cfg.APIAddr, api.BasePath)
+	if err := o.api.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Error serving API: %v", err)
+	}
+}
 
-	log.Printf("Subscribed to Redis channel: %s", ProjectCreatedChannel)
+// loadWorkflowDefinitions validates every workflow file in the configured
+// directory and saves it to the workflows table. Invalid files are logged and
+// skipped so one bad definition does not keep the service from starting.
+func (o *Orchestrator) loadWorkflowDefinitions(ctx context.Context) {
+	defs, err := workflow.LoadDir(o.cfg.WorkflowDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Workflow directory %s not found, skipping workflow loading", o.cfg.WorkflowDir)
+			return
+		}
+		log.Printf("Error loading workflow definitions: %v", err)
+		return
+	}
 
-	for msg := range pubsub.Channel() {
-		log.Printf("Received message on channel %s: %s", msg.Channel, msg.Payload)
-		// Process the event in a goroutine to avoid blocking the subscriber
-		go o.handleProjectCreatedEvent(context.Background(), msg.Payload)
+	for _, def := range defs {
+		if err := o.saveWorkflowDefinition(ctx, def); err != nil {
+			log.Printf("Error saving workflow %q: %v", def.Name, err)
+			continue
+		}
+		log.Printf("Workflow %q loaded with %d stages.", def.Name, len(def.Stages))
 	}
 }
 
-func (o *Orchestrator) handleProjectCreatedEvent(ctx context.Context, payload string) {
-	// Task 3.6: Implement project_created event handler
-	log.Printf("Handling project_created event: %s", payload)
+func (o *Orchestrator) saveWorkflowDefinition(ctx context.Context, def *workflow.Definition) error {
+	personas, err := o.dbStore.Personas.ExistingPersonaNames(ctx, def.PersonaNames())
+	if err != nil {
+		return err
+	}
+	if err := def.Validate(func(name string) bool { return personas[name] }); err != nil {
+		return err
+	}
 
-	// Placeholder for actual event parsing and database storage
-	// This will be fully implemented in Task 3.6
-	project := &store.Project{
-		Name:        fmt.Sprintf("Project from Event: %s", payload),
-		Description: sql.NullString{String: "Created via event bus", Valid: true},
+	definition, err := json.Marshal(def)
+	if err != nil {
+		return fmt.Errorf("failed to marshal workflow definition: %w", err)
+	}
+	return o.dbStore.Workflows.UpsertWorkflow(ctx, &store.Workflow{
+		Name:        def.Name,
+		Description: sql.NullString{String: def.Description, Valid: def.Description != ""},
+		Definition:  definition,
+	})
+}
+
+// pruneProcessedEvents forgets processed events older than the configured
+// retention, once at startup and then every processedEventPruneInterval,
+// until ctx is cancelled.
+func (o *Orchestrator) pruneProcessedEvents(ctx context.Context) {
+	ticker := time.NewTicker(processedEventPruneInterval)
+	defer ticker.Stop()
+	for {
+		pruned, err := o.dbStore.ProcessedEvents.PruneProcessedEvents(ctx, time.Now().Add(-o.cfg.ProcessedEventRetention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error pruning processed events: %v", err)
+		}
+		if pruned > 0 {
+			log.Printf("Pruned %d processed events.", pruned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-	err := o.dbStore.Projects.CreateProject(ctx, project)
+}
+
+// projectCreatedConsumer reads the project_created stream as a member of the
+// orchestrator consumer group, so events published while no replica was
+// running are handled once one starts.
+func (o *Orchestrator) projectCreatedConsumer() *events.Consumer {
+	consumer := events.NewConsumer(o.redisClient, events.ProjectCreatedStream, events.OrchestratorGroup, o.cfg.InstanceID, o.createProjectFromEvent)
+	consumer.MaxDeliveries = o.cfg.EventMaxDeliveries
+	consumer.ClaimIdle = o.cfg.EventClaimIdle
+	consumer.Workers = o.cfg.EventWorkers
+	consumer.HandlerTimeout = o.cfg.EventHandlerTimeout
+	return consumer
+}
+
+// createProjectFromEvent handles a project_created event. Redelivered events
+// are skipped once recorded as processed, and the handling itself is
+// idempotent: an event whose project already exists only makes sure the
+// project's workflow has started.
+func (o *Orchestrator) createProjectFromEvent(ctx context.Context, data []byte) error {
+	env, err := events.Decode(data)
 	if err != nil {
-		log.Printf("Error creating project from event payload %s: %v", payload, err)
-	} else {
-		log.Printf("Project %s (%s) created successfully from event.", project.Name, project.ID)
+		return err
+	}
+	processed, err := o.dbStore.ProcessedEvents.IsEventProcessed(ctx, events.OrchestratorGroup, env.ID)
+	if err != nil {
+		return err
+	}
+	if processed {
+		log.Printf("Skipping event %s, already processed.", env.ID)
+		return nil
+	}
+	event := &events.ProjectCreated{}
+	if err := env.DecodePayload(event); err != nil {
+		return err
 	}
+
+	log.Printf("Handling project_created event %s (schema v%d) for project %s", env.ID, env.SchemaVersion, event.ID)
+
+	project := &store.Project{
+		ID:          event.ID,
+		Name:        event.Name,
+		Description: sql.NullString{String: event.Description, Valid: event.Description != ""},
+	}
+	if event.Workflow != "" {
+		wf, err := o.dbStore.Workflows.GetWorkflowByName(ctx, event.Workflow)
+		if err != nil {
+			return err
+		}
+		if wf == nil {
+			return fmt.Errorf("%w: unknown workflow %q", events.ErrInvalidEvent, event.Workflow)
+		}
+		project.WorkflowID = uuid.NullUUID{UUID: wf.ID, Valid: true}
+	}
+	err = o.dbStore.Projects.CreateProject(ctx, project)
+	switch {
+	case errors.Is(err, store.ErrProjectExists):
+		// An earlier delivery got this far before failing.
+		project, err = o.dbStore.Projects.GetProject(ctx, event.ID)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return fmt.Errorf("project %s from event %s disappeared", event.ID, env.ID)
+		}
+		log.Printf("Project %s from event %s already exists.", project.ID, env.ID)
+	case err != nil:
+		return fmt.Errorf("failed to create project %s from event %s: %w", event.ID, env.ID, err)
+	default:
+		log.Printf("Project %s (%s) created successfully from event %s.", project.Name, project.ID, env.ID)
+	}
+
+	if project.WorkflowID.Valid {
+		if err := o.scheduler.StartProject(ctx, project.ID); err != nil {
+			return fmt.Errorf("failed to start workflow %q for project %s: %w", event.Workflow, project.ID, err)
+		}
+	}
+	if _, err := o.dbStore.ProcessedEvents.MarkEventProcessed(ctx, events.OrchestratorGroup, env.ID, string(env.Type)); err != nil {
+		return err
+	}
+	return nil
 }
 
 func main() {
@@ -111,4 +340,8 @@ func main() {
 
 	orchestrator := NewOrchestrator(cfg, dbStore, redisClient)
 	orchestrator.Run()
+
+	if err := redisClient.Close(); err != nil {
+		log.Printf("Error closing Redis connection: %v", err)
+	}
 }
@@ -0,0 +1,90 @@
+// Package outbox publishes the events the store writes to its outbox table to
+// the Redis event bus.
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"workflow-engine/events"
+	"workflow-engine/store"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultBatchSize is how many outbox messages a relay publishes per
+// transaction.
+const DefaultBatchSize = 100
+
+// pruneInterval is how often a relay deletes delivered messages older than
+// its retention.
+const pruneInterval = time.Hour
+
+// Relay moves outbox messages to their Redis streams. Several replicas may
+// run a relay at once; one of them publishes at a time, which keeps each
+// stream in order.
+type Relay struct {
+	outbox       *store.OutboxStore
+	client       redis.Cmdable
+	pollInterval time.Duration
+	retention    time.Duration
+	batchSize    int
+}
+
+// NewRelay returns a relay that checks the outbox every pollInterval and
+// keeps delivered messages for retention.
+func NewRelay(outbox *store.OutboxStore, client redis.Cmdable, pollInterval, retention time.Duration) *Relay {
+	return &Relay{
+		outbox:       outbox,
+		client:       client,
+		pollInterval: pollInterval,
+		retention:    retention,
+		batchSize:    DefaultBatchSize,
+	}
+}
+
+// Run relays messages until ctx is done. It drains the outbox batch by batch
+// and then checks again every pollInterval. Once every pruneInterval it
+// deletes messages delivered more than retention ago.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	var lastPruned time.Time
+	for {
+		delivered, err := r.outbox.RelayOutbox(ctx, r.batchSize, r.publish)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error relaying outbox: %v", err)
+		}
+		if err == nil && delivered == r.batchSize {
+			continue // More may be waiting
+		}
+		if time.Since(lastPruned) >= pruneInterval {
+			r.prune(ctx)
+			lastPruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) prune(ctx context.Context) {
+	pruned, err := r.outbox.PruneOutbox(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error pruning outbox: %v", err)
+		}
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d delivered outbox messages.", pruned)
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, msg *store.OutboxMessage) error {
+	_, err := events.PublishEncoded(ctx, r.client, msg.Stream, msg.Envelope)
+	return err
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"workflow-engine/config"
+	"workflow-engine/prompt"
+	"workflow-engine/quality"
+	"workflow-engine/store"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: personactl <command> [arguments]
+
+Commands:
+  drafts [-status pending|accepted|rejected]  list prompt drafts
+  diff <draft-id>                             show a draft against the current prompt
+  accept -by <name> <draft-id>                make a draft the persona's active prompt
+  reject -by <name> <draft-id>                discard a draft
+  versions <persona>                          list a persona's versions
+  rollback -version <n> <persona>             make an earlier version current again
+  partials                                    list shared prompt partials
+  set-partial <name> <file>                   create or replace a prompt partial
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	err := godotenv.Load("../../.env") // Load .env for database config
+	if err != nil {
+		log.Printf("No .env file found, using defaults or system env: %v", err)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	dbStore, err := store.NewStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize database store: %v", err)
+	}
+	defer dbStore.Close()
+	dbStore.Personas.AddValidator(prompt.NewEngine(dbStore.PromptPartials).ValidatePersona)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "drafts":
+		err = listDrafts(ctx, dbStore, args)
+	case "diff":
+		err = diffDraft(ctx, dbStore, args)
+	case "accept", "reject":
+		err = decideDraft(ctx, dbStore, command, args)
+	case "versions":
+		err = listVersions(ctx, dbStore, args)
+	case "rollback":
+		err = rollbackPersona(ctx, dbStore, args)
+	case "partials":
+		err = listPartials(ctx, dbStore)
+	case "set-partial":
+		err = setPartial(ctx, dbStore, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+func listDrafts(ctx context.Context, dbStore *store.Store, args []string) error {
+	fs := flag.NewFlagSet("drafts", flag.ExitOnError)
+	status := fs.String("status", string(store.PromptDraftStatusPending), "draft status to list")
+	fs.Parse(args)
+
+	drafts, err := dbStore.PromptDrafts.ListPromptDraftsByStatus(ctx, store.PromptDraftStatus(*status))
+	if err != nil {
+		return err
+	}
+	if len(drafts) == 0 {
+		fmt.Printf("No %s prompt drafts.\n", *status)
+		return nil
+	}
+	for _, draft := range drafts {
+		persona, err := dbStore.Personas.GetPersona(ctx, draft.PersonaID)
+		if err != nil {
+			return err
+		}
+		name := draft.PersonaID.String()
+		if persona != nil {
+			name = persona.Name
+		}
+		fmt.Printf("%s  %-24s  %s  %s\n", draft.ID, name, draft.CreatedAt.Format(time.RFC3339), draft.Rationale.String)
+	}
+	return nil
+}
+
+func diffDraft(ctx context.Context, dbStore *store.Store, args []string) error {
+	draft, err := loadDraft(ctx, dbStore, args)
+	if err != nil {
+		return err
+	}
+	persona, err := dbStore.Personas.GetPersona(ctx, draft.PersonaID)
+	if err != nil {
+		return err
+	}
+	if persona == nil {
+		return fmt.Errorf("persona %s not found", draft.PersonaID)
+	}
+
+	fmt.Printf("Draft %s for persona %s (%s)\n", draft.ID, persona.Name, draft.Status)
+	if draft.Rationale.Valid {
+		fmt.Printf("Rationale: %s\n", draft.Rationale.String)
+	}
+	if persona.PromptTemplate != draft.BasePromptTemplate {
+		fmt.Println("Warning: the persona prompt changed since this draft was proposed; it can no longer be accepted.")
+	}
+	fmt.Println()
+	fmt.Print(quality.Diff(persona.PromptTemplate, draft.ProposedPromptTemplate))
+	return nil
+}
+
+func decideDraft(ctx context.Context, dbStore *store.Store, command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	by := fs.String("by", "", "name of the maintainer making the decision")
+	fs.Parse(args)
+	if *by == "" {
+		return fmt.Errorf("-by is required")
+	}
+
+	draft, err := loadDraft(ctx, dbStore, fs.Args())
+	if err != nil {
+		return err
+	}
+	if command == "accept" {
+		err = dbStore.PromptDrafts.AcceptPromptDraft(ctx, draft.ID, *by)
+	} else {
+		err = dbStore.PromptDrafts.RejectPromptDraft(ctx, draft.ID, *by)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Draft %s %sed by %s.\n", draft.ID, command, *by)
+	return nil
+}
+
+func listVersions(ctx context.Context, dbStore *store.Store, args []string) error {
+	persona, err := loadPersona(ctx, dbStore, args)
+	if err != nil {
+		return err
+	}
+	versions, err := dbStore.Personas.ListPersonaVersions(ctx, persona.ID)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		marker := " "
+		if version.Version == persona.CurrentVersion {
+			marker = "*"
+		}
+		note := ""
+		if version.RolledBackFrom.Valid {
+			note = fmt.Sprintf("  (rollback to v%d)", version.RolledBackFrom.Int64)
+		}
+		fmt.Printf("%s v%-4d %s  %s%s\n", marker, version.Version, version.ID, version.CreatedAt.Format(time.RFC3339), note)
+	}
+	return nil
+}
+
+func rollbackPersona(ctx context.Context, dbStore *store.Store, args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	target := fs.Int("version", 0, "persona version to restore")
+	fs.Parse(args)
+	if *target <= 0 {
+		return fmt.Errorf("-version is required")
+	}
+
+	persona, err := loadPersona(ctx, dbStore, fs.Args())
+	if err != nil {
+		return err
+	}
+	version, err := dbStore.Personas.RollbackPersona(ctx, persona.ID, *target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Persona %s rolled back to v%d as v%d.\n", persona.Name, *target, version.Version)
+	return nil
+}
+
+func listPartials(ctx context.Context, dbStore *store.Store) error {
+	partials, err := dbStore.PromptPartials.ListPromptPartials(ctx)
+	if err != nil {
+		return err
+	}
+	if len(partials) == 0 {
+		fmt.Println("No prompt partials.")
+		return nil
+	}
+	for _, partial := range partials {
+		fmt.Printf("%-24s  %s  %d bytes\n", partial.Name, partial.UpdatedAt.Format(time.RFC3339), len(partial.Body))
+	}
+	return nil
+}
+
+func setPartial(ctx context.Context, dbStore *store.Store, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expected a partial name and a file")
+	}
+	body, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read partial: %w", err)
+	}
+	prompts := prompt.NewEngine(dbStore.PromptPartials)
+	if err := prompts.ValidatePartial(ctx, args[0], string(body)); err != nil {
+		return err
+	}
+	partial := &store.PromptPartial{Name: args[0], Body: string(body)}
+	if err := dbStore.PromptPartials.UpsertPromptPartial(ctx, partial); err != nil {
+		return err
+	}
+	fmt.Printf("Partial %s saved.\n", partial.Name)
+	return nil
+}
+
+// loadPersona resolves a persona by ID or by name.
+func loadPersona(ctx context.Context, dbStore *store.Store, args []string) (*store.Persona, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected exactly one persona ID or name")
+	}
+	var persona *store.Persona
+	var err error
+	if id, parseErr := uuid.Parse(args[0]); parseErr == nil {
+		persona, err = dbStore.Personas.GetPersona(ctx, id)
+	} else {
+		persona, err = dbStore.Personas.GetPersonaByName(ctx, args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil {
+		return nil, fmt.Errorf("persona %s not found", args[0])
+	}
+	return persona, nil
+}
+
+func loadDraft(ctx context.Context, dbStore *store.Store, args []string) (*store.PromptDraft, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected exactly one draft ID")
+	}
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid draft ID: %w", err)
+	}
+	draft, err := dbStore.PromptDrafts.GetPromptDraft(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if draft == nil {
+		return nil, fmt.Errorf("draft %s not found", id)
+	}
+	return draft, nil
+}
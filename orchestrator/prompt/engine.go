@@ -0,0 +1,78 @@
+package prompt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"workflow-engine/store"
+)
+
+// PartialSource supplies the partials templates may include.
+type PartialSource interface {
+	ListPromptPartials(ctx context.Context) ([]*store.PromptPartial, error)
+}
+
+// Engine compiles persona prompt templates against the stored partials.
+type Engine struct {
+	partials PartialSource
+}
+
+func NewEngine(partials PartialSource) *Engine {
+	return &Engine{partials: partials}
+}
+
+// Compile parses and validates a template, making every stored partial
+// available to it.
+func (e *Engine) Compile(ctx context.Context, name, text string) (*Template, error) {
+	partials, err := e.loadPartials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(name, text, partials)
+}
+
+// ValidatePersona checks a persona's prompt template. It is registered with
+// PersonaStore.AddValidator so broken templates are refused when a persona is
+// created or changed rather than when its first stage runs.
+func (e *Engine) ValidatePersona(ctx context.Context, persona *store.Persona) error {
+	_, err := e.Compile(ctx, persona.Name, persona.PromptTemplate)
+	return err
+}
+
+// ValidatePartial checks that a new or changed partial parses and references
+// only known variables when included with {{template "name" .}}.
+func (e *Engine) ValidatePartial(ctx context.Context, name, body string) error {
+	partials, err := e.loadPartials(ctx)
+	if err != nil {
+		return err
+	}
+	partials[name] = body
+	_, err = Compile("partial "+name, fmt.Sprintf("{{template %q .}}", name), partials)
+	return err
+}
+
+func (e *Engine) loadPartials(ctx context.Context) (map[string]string, error) {
+	stored, err := e.partials.ListPromptPartials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	partials := make(map[string]string, len(stored))
+	for _, partial := range stored {
+		partials[partial.Name] = partial.Body
+	}
+	return partials, nil
+}
+
+// DecodeValues decodes a JSON object, such as a stage run's input context,
+// into template data. A null or empty document yields an empty map.
+func DecodeValues(raw json.RawMessage) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if len(raw) == 0 || string(raw) == "null" {
+		return values, nil
+	}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode template values: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,113 @@
+package prompt
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompile_RendersInputProjectContextAndPartials(t *testing.T) {
+	partials := map[string]string{
+		"house-style": "Answer in Markdown for {{.Project.Name}}.",
+	}
+	text := `You are the {{.Stage.Persona}} for stage {{.Stage.Name}}.
+Requirements: {{.Input.requirements}}
+{{if .Context.tech_stack}}Stack: {{.Context.tech_stack.language}}{{end}}
+{{template "house-style" .}}`
+
+	tmpl, err := Compile("architect", text, partials)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if keys := tmpl.ContextKeys(); !reflect.DeepEqual(keys, []string{"tech_stack"}) {
+		t.Errorf("Expected context keys [tech_stack], got %v", keys)
+	}
+
+	rendered, err := tmpl.Render(Data{
+		Input:   map[string]interface{}{"requirements": "a todo app"},
+		Context: map[string]interface{}{"tech_stack": map[string]interface{}{"language": "Go"}},
+		Project: Project{Name: "Todo"},
+		Stage:   Stage{Name: "design", Persona: "architect"},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "You are the architect for stage design.\nRequirements: a todo app\nStack: Go\nAnswer in Markdown for Todo."
+	if rendered != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, rendered)
+	}
+}
+
+func TestCompile_ReportsProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		problem string
+	}{
+		{"syntax error", "Hello {{.Input.name", "unclosed action"},
+		{"unknown root", "{{.Inputs.name}}", "unknown variable .Inputs.name"},
+		{"unknown project field", "{{.Project.Owner}}", "unknown variable .Project.Owner"},
+		{"unknown partial", `{{template "missing" .}}`, `unknown partial "missing"`},
+		{"unknown variable in partial", `{{template "broken" .}}`, "unknown variable .Foo"},
+	}
+	partials := map[string]string{"broken": "{{.Foo}}"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile("persona", tt.text, partials)
+			var templateErr *TemplateError
+			if !errors.As(err, &templateErr) {
+				t.Fatalf("Expected *TemplateError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("Expected error to mention %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestRender_MissingVariables(t *testing.T) {
+	text := `{{.Input.requirements}} {{.Context.risks}}{{if .Input.notes}} {{.Input.notes}}{{end}}`
+	tmpl, err := Compile("analyst", text, nil)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	_, err = tmpl.Render(Data{})
+	var missingErr *MissingVariablesError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("Expected *MissingVariablesError, got %v", err)
+	}
+	if want := []string{"Context.risks", "Input.requirements"}; !reflect.DeepEqual(missingErr.Variables, want) {
+		t.Errorf("Expected missing %v, got %v", want, missingErr.Variables)
+	}
+
+	rendered, err := tmpl.Render(Data{
+		Input:   map[string]interface{}{"requirements": "reqs"},
+		Context: map[string]interface{}{"risks": "none"},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered != "reqs none" {
+		t.Errorf("Expected optional notes to be skipped, got %q", rendered)
+	}
+}
+
+func TestRender_RangeBodyUsesItsOwnDot(t *testing.T) {
+	text := `{{range .Input.risks}}- {{.title}}
+{{end}}`
+	tmpl, err := Compile("qa", text, nil)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	rendered, err := tmpl.Render(Data{Input: map[string]interface{}{
+		"risks": []interface{}{map[string]interface{}{"title": "scope creep"}},
+	}})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if rendered != "- scope creep\n" {
+		t.Errorf("Unexpected render %q", rendered)
+	}
+}
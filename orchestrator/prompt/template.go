@@ -0,0 +1,301 @@
+// Package prompt renders persona prompt templates.
+//
+// Templates use Go text/template syntax. The data available to a template is
+// fixed: .Input holds the stage run's input context, .Context the Context Bus
+// entries the template names, .Project the project's ID, Name and Description
+// and .Stage the stage's Name and Persona. Shared partials are included with
+// {{template "name" .}}.
+package prompt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Data is what a template is rendered against.
+type Data struct {
+	Input   map[string]interface{}
+	Context map[string]interface{}
+	Project Project
+	Stage   Stage
+}
+
+type Project struct {
+	ID          string
+	Name        string
+	Description string
+}
+
+type Stage struct {
+	Name    string
+	Persona string
+}
+
+// fields lists the variables a template may reference under each root. Input
+// and Context are maps whose keys are only known at render time.
+var fields = map[string]map[string]bool{
+	"Input":   nil,
+	"Context": nil,
+	"Project": {"ID": true, "Name": true, "Description": true},
+	"Stage":   {"Name": true, "Persona": true},
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+}
+
+// TemplateError lists every problem found in a prompt template.
+type TemplateError struct {
+	Template string
+	Problems []string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("invalid prompt template %q: %s", e.Template, strings.Join(e.Problems, "; "))
+}
+
+// MissingVariablesError is returned by Render when the data lacks input or
+// Context Bus keys the template needs.
+type MissingVariablesError struct {
+	Template  string
+	Variables []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("prompt template %q is missing variables: %s", e.Template, strings.Join(e.Variables, ", "))
+}
+
+// reference is one input or Context Bus key a template uses.
+type reference struct {
+	root string
+	key  string
+	// required is false when every use sits inside an if, with or range,
+	// where a missing key simply takes the other branch.
+	required bool
+}
+
+func (r reference) String() string {
+	return r.root + "." + r.key
+}
+
+// Template is a parsed and validated prompt template.
+type Template struct {
+	name string
+	tmpl *template.Template
+	refs []reference
+}
+
+// Compile parses text together with the given partials and validates it: the
+// syntax, every variable it references and every partial it includes. All
+// problems are reported together in a *TemplateError.
+func Compile(name, text string, partials map[string]string) (*Template, error) {
+	var problems []string
+	root := template.New(name).Funcs(funcs)
+	if _, err := root.Parse(text); err != nil {
+		return nil, &TemplateError{Template: name, Problems: []string{err.Error()}}
+	}
+	partialNames := make([]string, 0, len(partials))
+	for partialName := range partials {
+		partialNames = append(partialNames, partialName)
+	}
+	sort.Strings(partialNames)
+	for _, partialName := range partialNames {
+		if partialName == name {
+			continue
+		}
+		if _, err := root.New(partialName).Parse(partials[partialName]); err != nil {
+			problems = append(problems, fmt.Sprintf("partial %q: %v", partialName, err))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &TemplateError{Template: name, Problems: problems}
+	}
+
+	a := &analyzer{tmpl: root, refs: make(map[string]*reference), visiting: make(map[string]bool)}
+	a.walkTemplate(name, true, false)
+	if len(a.problems) > 0 {
+		return nil, &TemplateError{Template: name, Problems: a.problems}
+	}
+
+	t := &Template{name: name, tmpl: root}
+	for _, ref := range a.refs {
+		t.refs = append(t.refs, *ref)
+	}
+	sort.Slice(t.refs, func(i, j int) bool {
+		return t.refs[i].String() < t.refs[j].String()
+	})
+	return t, nil
+}
+
+// ContextKeys returns the Context Bus keys the template references.
+func (t *Template) ContextKeys() []string {
+	var keys []string
+	for _, ref := range t.refs {
+		if ref.root == "Context" {
+			keys = append(keys, ref.key)
+		}
+	}
+	return keys
+}
+
+// Render executes the template. It fails with a *MissingVariablesError, before
+// anything is rendered, when a required input or Context Bus key is absent.
+func (t *Template) Render(data Data) (string, error) {
+	var missing []string
+	for _, ref := range t.refs {
+		if !ref.required {
+			continue
+		}
+		values := data.Input
+		if ref.root == "Context" {
+			values = data.Context
+		}
+		if _, ok := values[ref.key]; !ok {
+			missing = append(missing, ref.String())
+		}
+	}
+	if len(missing) > 0 {
+		return "", &MissingVariablesError{Template: t.name, Variables: missing}
+	}
+
+	var out bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&out, t.name, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %q: %w", t.name, err)
+	}
+	return out.String(), nil
+}
+
+// analyzer walks a template's parse tree collecting the variables it
+// references and the problems it finds.
+type analyzer struct {
+	tmpl     *template.Template
+	refs     map[string]*reference
+	problems []string
+	visiting map[string]bool
+}
+
+func (a *analyzer) addf(format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	for _, p := range a.problems {
+		if p == problem {
+			return
+		}
+	}
+	a.problems = append(a.problems, problem)
+}
+
+// walkTemplate analyzes the named template. dotIsData reports whether dot is
+// the Data value; conditional whether the template is only reached through an
+// if, with or range.
+func (a *analyzer) walkTemplate(name string, dotIsData, conditional bool) {
+	t := a.tmpl.Lookup(name)
+	if t == nil || t.Tree == nil {
+		a.addf("unknown partial %q", name)
+		return
+	}
+	if a.visiting[name] {
+		a.addf("partial %q includes itself", name)
+		return
+	}
+	a.visiting[name] = true
+	defer delete(a.visiting, name)
+	a.walk(t.Tree.Root, dotIsData, conditional)
+}
+
+func (a *analyzer) walk(node parse.Node, dotIsData, conditional bool) {
+	switch n := node.(type) {
+	case nil:
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			a.walk(child, dotIsData, conditional)
+		}
+	case *parse.ActionNode:
+		a.walk(n.Pipe, dotIsData, conditional)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				a.walk(arg, dotIsData, conditional)
+			}
+		}
+	case *parse.IfNode:
+		a.walk(n.Pipe, dotIsData, true)
+		a.walk(n.List, dotIsData, true)
+		a.walk(n.ElseList, dotIsData, true)
+	case *parse.WithNode:
+		a.walk(n.Pipe, dotIsData, true)
+		a.walk(n.List, false, true)
+		a.walk(n.ElseList, dotIsData, true)
+	case *parse.RangeNode:
+		a.walk(n.Pipe, dotIsData, true)
+		a.walk(n.List, false, true)
+		a.walk(n.ElseList, dotIsData, true)
+	case *parse.TemplateNode:
+		a.walk(n.Pipe, dotIsData, conditional)
+		a.walkTemplate(n.Name, dotIsData && passesDot(n.Pipe), conditional)
+	case *parse.FieldNode:
+		if dotIsData {
+			a.reference(n.Ident, conditional)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			a.reference(n.Ident[1:], conditional)
+		}
+	case *parse.ChainNode:
+		a.walk(n.Node, dotIsData, conditional)
+	}
+}
+
+// passesDot reports whether a {{template}} call hands its own dot (or $) to
+// the partial.
+func passesDot(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return true
+	case *parse.VariableNode:
+		return len(arg.Ident) == 1 && arg.Ident[0] == "$"
+	}
+	return false
+}
+
+func (a *analyzer) reference(ident []string, conditional bool) {
+	root := ident[0]
+	allowed, ok := fields[root]
+	if !ok {
+		a.addf("unknown variable .%s", strings.Join(ident, "."))
+		return
+	}
+	if len(ident) < 2 {
+		return
+	}
+	if allowed != nil {
+		if !allowed[ident[1]] {
+			a.addf("unknown variable .%s", strings.Join(ident, "."))
+		}
+		return
+	}
+
+	ref := reference{root: root, key: ident[1]}
+	existing, ok := a.refs[ref.String()]
+	if !ok {
+		existing = &ref
+		a.refs[ref.String()] = existing
+	}
+	existing.required = existing.required || !conditional
+}
@@ -2,22 +2,23 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"time"
 
 	"workflow-engine/config"
+	"workflow-engine/events"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 )
 
-const (
-	ProjectCreatedChannel = "project_created_events"
-)
-
 func main() {
+	workflowName := flag.String("workflow", "", "name of the workflow the new project should run")
+	flag.Parse()
+
 	err := godotenv.Load("../../.env") // Load .env for Redis config
 	if err != nil {
 		log.Printf("No .env file found, using defaults or system env: %v", err)
@@ -44,15 +45,21 @@ func main() {
 	log.Println("Successfully connected to Redis!")
 
 	// Generate a mock project ID and name
-	mockProjectID := uuid.New().String()
-	mockProjectName := fmt.Sprintf("Auto-generated Project %s", mockProjectID[:8])
-	eventPayload := fmt.Sprintf(`{"id": "%s", "name": "%s", "description": "This project was created by a mock event publisher."}`, mockProjectID, mockProjectName)
-
-	err = redisClient.Publish(context.Background(), ProjectCreatedChannel, eventPayload).Err()
+	mockProjectID := uuid.New()
+	env, err := events.NewEnvelope(&events.ProjectCreated{
+		ID:          mockProjectID,
+		Name:        fmt.Sprintf("Auto-generated Project %s", mockProjectID.String()[:8]),
+		Description: "This project was created by a mock event publisher.",
+		Workflow:    *workflowName,
+	})
+	if err != nil {
+		log.Fatalf("Failed to build event: %v", err)
+	}
+	entryID, err := events.Publish(context.Background(), redisClient, events.ProjectCreatedStream, env)
 	if err != nil {
 		log.Fatalf("Failed to publish message: %v", err)
 	}
 
-	log.Printf("Published message to channel '%s': %s", ProjectCreatedChannel, eventPayload)
+	log.Printf("Published event %s to stream '%s' as entry %s", env.ID, events.ProjectCreatedStream, entryID)
 	log.Println("Mock event publisher finished.")
 }
@@ -0,0 +1,197 @@
+package quality
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"workflow-engine/store"
+)
+
+// RecurringProblem is a rubric criterion a persona keeps failing.
+type RecurringProblem struct {
+	Criterion Criterion
+	Failures  int
+	Comments  []string
+}
+
+// Suggester proposes a revised prompt template that addresses recurring problems.
+type Suggester interface {
+	SuggestRevision(ctx context.Context, persona *store.Persona, problems []RecurringProblem) (template string, rationale string, err error)
+}
+
+// Advisor closes the self-correction loop: when the same criteria keep
+// failing for a persona, it stores a suggested prompt revision as a pending
+// draft for a maintainer to accept or reject.
+type Advisor struct {
+	personas    *store.PersonaStore
+	evaluations *store.EvaluationStore
+	drafts      *store.PromptDraftStore
+	suggester   Suggester
+
+	// Window is how many of the persona's most recent evaluations are considered.
+	Window int
+	// MinFailures is how many of those must fail a criterion for it to count
+	// as recurring.
+	MinFailures int
+}
+
+func NewAdvisor(dbStore *store.Store, suggester Suggester) *Advisor {
+	return &Advisor{
+		personas:    dbStore.Personas,
+		evaluations: dbStore.Evaluations,
+		drafts:      dbStore.PromptDrafts,
+		suggester:   suggester,
+		Window:      5,
+		MinFailures: 3,
+	}
+}
+
+// ReviewPersona looks for recurring problems in the persona's recent
+// evaluations and, if there are any, stores a pending prompt draft. It returns
+// nil when there is nothing to suggest or a draft is already pending.
+func (a *Advisor) ReviewPersona(ctx context.Context, rubric *Rubric) (*store.PromptDraft, error) {
+	pending, err := a.drafts.GetPendingPromptDraft(ctx, rubric.PersonaID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, nil
+	}
+
+	evaluations, err := a.evaluations.ListRecentEvaluationsByPersona(ctx, rubric.PersonaID, a.Window)
+	if err != nil {
+		return nil, err
+	}
+	problems, err := FindRecurringProblems(rubric, evaluations, a.MinFailures)
+	if err != nil || len(problems) == 0 {
+		return nil, err
+	}
+
+	persona, err := a.personas.GetPersona(ctx, rubric.PersonaID)
+	if err != nil {
+		return nil, err
+	}
+	if persona == nil {
+		return nil, fmt.Errorf("persona %s not found", rubric.PersonaID)
+	}
+	proposed, rationale, err := a.suggester.SuggestRevision(ctx, persona, problems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest prompt revision for persona %s: %w", persona.Name, err)
+	}
+	if proposed == persona.PromptTemplate {
+		return nil, nil
+	}
+
+	draft := &store.PromptDraft{
+		PersonaID:              persona.ID,
+		BasePromptTemplate:     persona.PromptTemplate,
+		ProposedPromptTemplate: proposed,
+		Rationale:              sql.NullString{String: rationale, Valid: rationale != ""},
+	}
+	if err := a.drafts.CreatePromptDraft(ctx, draft); err != nil {
+		return nil, err
+	}
+	log.Printf("Proposed prompt draft %s for persona %s: %s", draft.ID, persona.Name, rationale)
+	return draft, nil
+}
+
+// FindRecurringProblems returns the rubric criteria scored below the rubric
+// threshold in at least minFailures of the given evaluations, most frequent first.
+func FindRecurringProblems(rubric *Rubric, evaluations []*store.Evaluation, minFailures int) ([]RecurringProblem, error) {
+	byName := make(map[string]*RecurringProblem)
+	for _, evaluation := range evaluations {
+		var scores []CriterionScore
+		if err := json.Unmarshal(evaluation.Scores, &scores); err != nil {
+			return nil, fmt.Errorf("evaluation %s has invalid scores: %w", evaluation.ID, err)
+		}
+		for _, score := range scores {
+			if score.Score >= rubric.Threshold {
+				continue
+			}
+			problem, ok := byName[score.Criterion]
+			if !ok {
+				problem = &RecurringProblem{}
+				byName[score.Criterion] = problem
+			}
+			problem.Failures++
+			if score.Comment != "" {
+				problem.Comments = append(problem.Comments, score.Comment)
+			}
+		}
+	}
+
+	var problems []RecurringProblem
+	for _, criterion := range rubric.Criteria {
+		problem, ok := byName[criterion.Name]
+		if !ok || problem.Failures < minFailures {
+			continue
+		}
+		problem.Criterion = criterion
+		problems = append(problems, *problem)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Failures > problems[j].Failures
+	})
+	return problems, nil
+}
+
+// guidelinesHeading marks the section GuidelineSuggester maintains at the end
+// of a prompt template.
+const guidelinesHeading = "## Quality guidelines"
+
+// GuidelineSuggester revises a prompt without calling a model: it appends, or
+// extends, a "Quality guidelines" section with one instruction per recurring
+// problem.
+type GuidelineSuggester struct{}
+
+func (GuidelineSuggester) SuggestRevision(ctx context.Context, persona *store.Persona, problems []RecurringProblem) (string, string, error) {
+	body := persona.PromptTemplate
+	var existing []string
+	if idx := strings.Index(body, guidelinesHeading); idx >= 0 {
+		for _, line := range strings.Split(body[idx+len(guidelinesHeading):], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				existing = append(existing, line)
+			}
+		}
+		body = body[:idx]
+	}
+
+	guidelines := existing
+	var names []string
+	for _, problem := range problems {
+		line := "- " + guideline(problem.Criterion)
+		if !containsLine(guidelines, line) {
+			guidelines = append(guidelines, line)
+		}
+		names = append(names, fmt.Sprintf("%s (failed %d times)", problem.Criterion.Name, problem.Failures))
+	}
+
+	revised := strings.TrimRight(body, "\n") + "\n\n" + guidelinesHeading + "\n" + strings.Join(guidelines, "\n") + "\n"
+	rationale := "Recurring Quality-Analyst findings: " + strings.Join(names, ", ")
+	return revised, rationale, nil
+}
+
+func guideline(criterion Criterion) string {
+	text := criterion.Name
+	if criterion.Description != "" {
+		text += ": " + criterion.Description
+	}
+	if len(criterion.RequiredKeys) > 0 {
+		text += " Always include non-empty " + strings.Join(criterion.RequiredKeys, ", ") + " in your output."
+	}
+	return text
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package quality
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"workflow-engine/store"
+)
+
+func evaluationWithScores(t *testing.T, scores ...CriterionScore) *store.Evaluation {
+	t.Helper()
+	data, err := json.Marshal(scores)
+	if err != nil {
+		t.Fatalf("Failed to marshal scores: %v", err)
+	}
+	return &store.Evaluation{Scores: data}
+}
+
+func TestFindRecurringProblems(t *testing.T) {
+	rubric := testRubric(t, `[
+		{"name": "completeness", "weight": 1, "required_keys": ["risks"]},
+		{"name": "clarity", "weight": 1}
+	]`, 0.8)
+	evaluations := []*store.Evaluation{
+		evaluationWithScores(t, CriterionScore{Criterion: "completeness", Score: 0, Comment: "missing or empty: risks"}, CriterionScore{Criterion: "clarity", Score: 0.5}),
+		evaluationWithScores(t, CriterionScore{Criterion: "completeness", Score: 0.5}, CriterionScore{Criterion: "clarity", Score: 1}),
+		evaluationWithScores(t, CriterionScore{Criterion: "completeness", Score: 0}, CriterionScore{Criterion: "clarity", Score: 1}),
+	}
+
+	problems, err := FindRecurringProblems(rubric, evaluations, 3)
+	if err != nil {
+		t.Fatalf("FindRecurringProblems failed: %v", err)
+	}
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 recurring problem, got %d", len(problems))
+	}
+	if problems[0].Criterion.Name != "completeness" || problems[0].Failures != 3 {
+		t.Errorf("Unexpected problem %+v", problems[0])
+	}
+	if len(problems[0].Comments) != 1 {
+		t.Errorf("Expected 1 comment, got %v", problems[0].Comments)
+	}
+}
+
+func TestGuidelineSuggester_AppendsAndExtendsSection(t *testing.T) {
+	persona := &store.Persona{Name: "architect", PromptTemplate: "You are an architect.\n"}
+	problems := []RecurringProblem{{
+		Criterion: Criterion{Name: "completeness", Description: "Cover every risk.", RequiredKeys: []string{"risks"}},
+		Failures:  3,
+	}}
+
+	revised, rationale, err := GuidelineSuggester{}.SuggestRevision(context.Background(), persona, problems)
+	if err != nil {
+		t.Fatalf("SuggestRevision failed: %v", err)
+	}
+	want := "You are an architect.\n\n## Quality guidelines\n- completeness: Cover every risk. Always include non-empty risks in your output.\n"
+	if revised != want {
+		t.Errorf("Expected revision:\n%s\ngot:\n%s", want, revised)
+	}
+	if !strings.Contains(rationale, "completeness (failed 3 times)") {
+		t.Errorf("Unexpected rationale %q", rationale)
+	}
+
+	persona.PromptTemplate = revised
+	problems = append(problems, RecurringProblem{Criterion: Criterion{Name: "clarity"}, Failures: 4})
+	again, _, err := GuidelineSuggester{}.SuggestRevision(context.Background(), persona, problems)
+	if err != nil {
+		t.Fatalf("SuggestRevision failed: %v", err)
+	}
+	if strings.Count(again, "- completeness") != 1 {
+		t.Errorf("Expected existing guideline to be kept once, got:\n%s", again)
+	}
+	if !strings.HasSuffix(again, "- clarity\n") {
+		t.Errorf("Expected new guideline appended, got:\n%s", again)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := Diff("a\nb\nc", "a\nc\nd")
+	want := "  a\n- b\n  c\n+ d\n"
+	if got != want {
+		t.Errorf("Expected diff:\n%s\ngot:\n%s", want, got)
+	}
+}
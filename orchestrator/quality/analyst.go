@@ -0,0 +1,110 @@
+package quality
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+// CriterionScore is the score one criterion received, between 0 and 1.
+type CriterionScore struct {
+	Criterion string  `json:"criterion"`
+	Score     float64 `json:"score"`
+	Comment   string  `json:"comment,omitempty"`
+}
+
+// Assessment is what an Analyst returns for one stage run.
+type Assessment struct {
+	Scores   []CriterionScore
+	Comments string
+}
+
+// Analyst scores a completed stage run against a rubric.
+type Analyst interface {
+	Assess(ctx context.Context, rubric *Rubric, stage workflow.Stage, run *store.StageRun) (*Assessment, error)
+}
+
+// HeuristicAnalyst scores output without calling a model: a criterion's score
+// is the fraction of its required keys present and non-empty in the run's
+// OutputContext. Criteria without required keys only need non-empty output.
+type HeuristicAnalyst struct{}
+
+func (HeuristicAnalyst) Assess(ctx context.Context, rubric *Rubric, stage workflow.Stage, run *store.StageRun) (*Assessment, error) {
+	output := make(map[string]json.RawMessage)
+	if len(run.OutputContext) > 0 && string(run.OutputContext) != "null" {
+		if err := json.Unmarshal(run.OutputContext, &output); err != nil {
+			return nil, fmt.Errorf("output of stage run %s is not a JSON object: %w", run.ID, err)
+		}
+	}
+
+	assessment := &Assessment{}
+	var findings []string
+	for _, criterion := range rubric.Criteria {
+		score := CriterionScore{Criterion: criterion.Name}
+		if len(criterion.RequiredKeys) == 0 {
+			if len(output) > 0 {
+				score.Score = 1
+			} else {
+				score.Comment = "stage produced no output"
+			}
+		} else {
+			var missing []string
+			for _, key := range criterion.RequiredKeys {
+				if isEmpty(output[key]) {
+					missing = append(missing, key)
+				}
+			}
+			present := len(criterion.RequiredKeys) - len(missing)
+			score.Score = float64(present) / float64(len(criterion.RequiredKeys))
+			if len(missing) > 0 {
+				score.Comment = "missing or empty: " + strings.Join(missing, ", ")
+			}
+		}
+		if score.Comment != "" {
+			findings = append(findings, fmt.Sprintf("%s: %s", criterion.Name, score.Comment))
+		}
+		assessment.Scores = append(assessment.Scores, score)
+	}
+	assessment.Comments = strings.Join(findings, "; ")
+	return assessment, nil
+}
+
+func isEmpty(value json.RawMessage) bool {
+	switch strings.TrimSpace(string(value)) {
+	case "", "null", `""`, "[]", "{}":
+		return true
+	}
+	return false
+}
+
+// OverallScore is the weight-averaged score of an assessment. Criteria the
+// assessment did not score count as zero.
+func OverallScore(rubric *Rubric, assessment *Assessment) float64 {
+	scores := make(map[string]float64, len(assessment.Scores))
+	for _, score := range assessment.Scores {
+		scores[score.Criterion] = clamp(score.Score)
+	}
+	var total, weights float64
+	for _, criterion := range rubric.Criteria {
+		total += criterion.Weight * scores[criterion.Name]
+		weights += criterion.Weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return total / weights
+}
+
+func clamp(score float64) float64 {
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
@@ -0,0 +1,98 @@
+package quality
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// Outcome is the persisted result of evaluating one stage run.
+type Outcome struct {
+	Evaluation *store.Evaluation
+	Rubric     *Rubric
+}
+
+// Passed reports whether the run met the rubric threshold.
+func (o *Outcome) Passed() bool {
+	return o.Evaluation.Verdict == store.EvaluationVerdictPass
+}
+
+// Evaluator runs the Quality-Analyst over completed stage runs and records
+// the result. When an advisor is set, failing evaluations also feed the
+// prompt-improvement loop.
+type Evaluator struct {
+	rubrics     *store.RubricStore
+	evaluations *store.EvaluationStore
+	analyst     Analyst
+	advisor     *Advisor
+}
+
+func NewEvaluator(dbStore *store.Store, analyst Analyst, advisor *Advisor) *Evaluator {
+	return &Evaluator{
+		rubrics:     dbStore.Rubrics,
+		evaluations: dbStore.Evaluations,
+		analyst:     analyst,
+		advisor:     advisor,
+	}
+}
+
+// EvaluateStageRun scores run against the rubric of the stage's persona and
+// persists the evaluation. It returns nil when the persona has no rubric.
+func (e *Evaluator) EvaluateStageRun(ctx context.Context, run *store.StageRun, stage workflow.Stage) (*Outcome, error) {
+	stored, err := e.rubrics.GetRubricByPersonaName(ctx, stage.Persona)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, nil
+	}
+	rubric, err := ParseRubric(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment, err := e.analyst.Assess(ctx, rubric, stage, run)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assess stage run %s: %w", run.ID, err)
+	}
+	evaluation, err := newEvaluation(run.ID, rubric, assessment)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.evaluations.CreateEvaluation(ctx, evaluation); err != nil {
+		return nil, err
+	}
+	if evaluation.Verdict == store.EvaluationVerdictFail && e.advisor != nil {
+		if _, err := e.advisor.ReviewPersona(ctx, rubric); err != nil {
+			log.Printf("Error reviewing persona %s for prompt improvements: %v", stage.Persona, err)
+		}
+	}
+	return &Outcome{Evaluation: evaluation, Rubric: rubric}, nil
+}
+
+func newEvaluation(stageRunID uuid.UUID, rubric *Rubric, assessment *Assessment) (*store.Evaluation, error) {
+	scores, err := json.Marshal(assessment.Scores)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal criterion scores: %w", err)
+	}
+	overall := OverallScore(rubric, assessment)
+	verdict := store.EvaluationVerdictFail
+	if overall >= rubric.Threshold {
+		verdict = store.EvaluationVerdictPass
+	}
+	return &store.Evaluation{
+		StageRunID:   stageRunID,
+		RubricID:     uuid.NullUUID{UUID: rubric.ID, Valid: true},
+		Scores:       scores,
+		OverallScore: overall,
+		Verdict:      verdict,
+		Comments:     sql.NullString{String: assessment.Comments, Valid: assessment.Comments != ""},
+	}, nil
+}
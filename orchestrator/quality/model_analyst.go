@@ -0,0 +1,181 @@
+package quality
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"workflow-engine/llm"
+	"workflow-engine/prompt"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+// PersonaSource looks up the current version of a persona by name.
+// *store.PersonaStore implements it.
+type PersonaSource interface {
+	GetCurrentPersonaVersionByName(ctx context.Context, name string) (*store.PersonaVersion, error)
+}
+
+// PromptCompiler compiles persona prompt templates. *prompt.Engine implements it.
+type PromptCompiler interface {
+	Compile(ctx context.Context, name, text string) (*prompt.Template, error)
+}
+
+// Completer sends a request to a model provider. *llm.Registry implements it.
+type Completer interface {
+	Complete(ctx context.Context, req llm.Request) (*llm.Response, error)
+}
+
+// analystOutputKeys are the keys of the JSON object the analyst model answers
+// with: scores holds a CriterionScore per rubric criterion and comments a
+// summary of its findings.
+var analystOutputKeys = []string{"scores", "comments"}
+
+// ModelAnalyst has the model of the AnalystPersonaName persona score stage
+// runs. The persona's prompt template is rendered with .Input.stage,
+// .Input.rubric and .Input.output, the same input is sent as the user message,
+// and the model must answer with a JSON object holding a score between 0 and
+// 1 for each criterion. While the persona does not exist, runs are assessed by
+// the fallback analyst instead.
+type ModelAnalyst struct {
+	personas PersonaSource
+	prompts  PromptCompiler
+	models   Completer
+	fallback Analyst
+}
+
+func NewModelAnalyst(personas PersonaSource, prompts PromptCompiler, models Completer, fallback Analyst) *ModelAnalyst {
+	return &ModelAnalyst{
+		personas: personas,
+		prompts:  prompts,
+		models:   models,
+		fallback: fallback,
+	}
+}
+
+func (a *ModelAnalyst) Assess(ctx context.Context, rubric *Rubric, stage workflow.Stage, run *store.StageRun) (*Assessment, error) {
+	version, err := a.personas.GetCurrentPersonaVersionByName(ctx, AnalystPersonaName)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return a.fallback.Assess(ctx, rubric, stage, run)
+	}
+	cfg, err := llm.ParseModelConfig(version.ModelConfig)
+	if err != nil {
+		return nil, fmt.Errorf("persona %s: %w", AnalystPersonaName, err)
+	}
+
+	input, err := analystInput(rubric, stage, run)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := a.prompts.Compile(ctx, AnalystPersonaName, version.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+	values, err := prompt.DecodeValues(input)
+	if err != nil {
+		return nil, err
+	}
+	system, err := tmpl.Render(prompt.Data{
+		Input:   values,
+		Context: make(map[string]interface{}),
+		Project: prompt.Project{ID: run.ProjectID.String()},
+		Stage:   prompt.Stage{Name: stage.Name, Persona: stage.Persona},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var user bytes.Buffer
+	user.WriteString("Input context:\n")
+	if err := json.Indent(&user, input, "", "  "); err != nil {
+		return nil, fmt.Errorf("failed to format analyst input: %w", err)
+	}
+	fmt.Fprintf(&user, "\n\nScore each rubric criterion from 0 to 1. Respond with a single JSON object containing exactly these keys: %s. "+
+		"scores is a list of objects with the keys criterion, score and comment.", strings.Join(analystOutputKeys, ", "))
+
+	resp, err := a.models.Complete(ctx, llm.Request{
+		Config: *cfg,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: system},
+			{Role: llm.RoleUser, Content: user.String()},
+		},
+		OutputKeys: analystOutputKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAssessment(rubric, resp.Content)
+}
+
+// analystInput is the input the analyst persona is rendered against: the
+// stage, the rubric without its storage details and the run's output.
+func analystInput(rubric *Rubric, stage workflow.Stage, run *store.StageRun) (json.RawMessage, error) {
+	type criterion struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description,omitempty"`
+		Weight      float64 `json:"weight"`
+	}
+	criteria := make([]criterion, 0, len(rubric.Criteria))
+	for _, c := range rubric.Criteria {
+		criteria = append(criteria, criterion{Name: c.Name, Description: c.Description, Weight: c.Weight})
+	}
+	output := run.OutputContext
+	if len(output) == 0 {
+		output = json.RawMessage("null")
+	}
+	input := map[string]interface{}{
+		"stage": stage.Name,
+		"rubric": map[string]interface{}{
+			"name":      rubric.Name,
+			"threshold": rubric.Threshold,
+			"criteria":  criteria,
+		},
+		"output": output,
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal analyst input: %w", err)
+	}
+	return data, nil
+}
+
+// ParseAssessment decodes an analyst model's response, optionally wrapped in
+// a Markdown code fence. Every score must name a criterion of the rubric;
+// criteria left unscored count as zero.
+func ParseAssessment(rubric *Rubric, content string) (*Assessment, error) {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	var response struct {
+		Scores   []CriterionScore `json:"scores"`
+		Comments string           `json:"comments"`
+	}
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		return nil, fmt.Errorf("analyst response is not a valid assessment: %w", err)
+	}
+
+	known := make(map[string]bool, len(rubric.Criteria))
+	for _, criterion := range rubric.Criteria {
+		known[criterion.Name] = true
+	}
+	scored := make(map[string]bool, len(response.Scores))
+	for _, score := range response.Scores {
+		if !known[score.Criterion] {
+			return nil, fmt.Errorf("analyst scored unknown criterion %q", score.Criterion)
+		}
+		if scored[score.Criterion] {
+			return nil, fmt.Errorf("analyst scored criterion %q more than once", score.Criterion)
+		}
+		scored[score.Criterion] = true
+	}
+	return &Assessment{Scores: response.Scores, Comments: strings.TrimSpace(response.Comments)}, nil
+}
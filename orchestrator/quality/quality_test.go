@@ -0,0 +1,237 @@
+package quality
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"workflow-engine/llm"
+	"workflow-engine/prompt"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+func testRubric(t *testing.T, criteria string, threshold float64) *Rubric {
+	t.Helper()
+	rubric, err := ParseRubric(&store.Rubric{
+		Name:      "architecture-review",
+		Criteria:  json.RawMessage(criteria),
+		Threshold: threshold,
+		OnFailure: string(FailureActionRerun),
+		MaxReruns: 1,
+	})
+	if err != nil {
+		t.Fatalf("ParseRubric failed: %v", err)
+	}
+	return rubric
+}
+
+func TestParseRubric_Validation(t *testing.T) {
+	cases := map[string]*store.Rubric{
+		"no criteria":        {Name: "r", Criteria: json.RawMessage(`[]`), Threshold: 0.5, OnFailure: "fail"},
+		"zero weight":        {Name: "r", Criteria: json.RawMessage(`[{"name": "c", "weight": 0}]`), Threshold: 0.5, OnFailure: "fail"},
+		"bad threshold":      {Name: "r", Criteria: json.RawMessage(`[{"name": "c", "weight": 1}]`), Threshold: 2, OnFailure: "fail"},
+		"unknown action":     {Name: "r", Criteria: json.RawMessage(`[{"name": "c", "weight": 1}]`), Threshold: 0.5, OnFailure: "shrug"},
+		"invalid criteria":   {Name: "r", Criteria: json.RawMessage(`{"name": "c"}`), Threshold: 0.5, OnFailure: "fail"},
+		"duplicate criteria": {Name: "r", Criteria: json.RawMessage(`[{"name": "c", "weight": 1}, {"name": "c", "weight": 1}]`), Threshold: 0.5, OnFailure: "fail"},
+	}
+	for name, stored := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseRubric(stored); err == nil {
+				t.Error("Expected rubric to be rejected")
+			}
+		})
+	}
+}
+
+func TestHeuristicAnalyst_ScoresRequiredKeys(t *testing.T) {
+	rubric := testRubric(t, `[
+		{"name": "completeness", "weight": 3, "required_keys": ["tech_stack", "risks"]},
+		{"name": "has_output", "weight": 1}
+	]`, 0.8)
+	run := &store.StageRun{OutputContext: json.RawMessage(`{"tech_stack": {"languages": ["Go"]}, "risks": []}`)}
+
+	assessment, err := HeuristicAnalyst{}.Assess(context.Background(), rubric, workflow.Stage{Name: "plan"}, run)
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	if len(assessment.Scores) != 2 {
+		t.Fatalf("Expected 2 scores, got %d", len(assessment.Scores))
+	}
+	if assessment.Scores[0].Score != 0.5 {
+		t.Errorf("Expected completeness 0.5 with empty risks, got %v", assessment.Scores[0].Score)
+	}
+	if !strings.Contains(assessment.Comments, "risks") {
+		t.Errorf("Expected comments to mention risks, got %q", assessment.Comments)
+	}
+
+	overall := OverallScore(rubric, assessment)
+	if math.Abs(overall-0.625) > 1e-9 {
+		t.Errorf("Expected weighted score 0.625, got %v", overall)
+	}
+
+	evaluation, err := newEvaluation(run.ID, rubric, assessment)
+	if err != nil {
+		t.Fatalf("newEvaluation failed: %v", err)
+	}
+	if evaluation.Verdict != store.EvaluationVerdictFail {
+		t.Errorf("Expected fail verdict below threshold, got %s", evaluation.Verdict)
+	}
+}
+
+func TestHeuristicAnalyst_PassingOutput(t *testing.T) {
+	rubric := testRubric(t, `[{"name": "completeness", "weight": 1, "required_keys": ["summary"]}]`, 1)
+	run := &store.StageRun{OutputContext: json.RawMessage(`{"summary": "all good"}`)}
+
+	assessment, err := HeuristicAnalyst{}.Assess(context.Background(), rubric, workflow.Stage{Name: "plan"}, run)
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	evaluation, err := newEvaluation(run.ID, rubric, assessment)
+	if err != nil {
+		t.Fatalf("newEvaluation failed: %v", err)
+	}
+	if evaluation.Verdict != store.EvaluationVerdictPass {
+		t.Errorf("Expected pass verdict, got %s", evaluation.Verdict)
+	}
+	if evaluation.Comments.Valid {
+		t.Errorf("Expected no comments, got %q", evaluation.Comments.String)
+	}
+}
+
+// analystPersona serves one version of the Quality-Analyst persona, or none.
+type analystPersona struct {
+	version *store.PersonaVersion
+}
+
+func (p analystPersona) GetCurrentPersonaVersionByName(ctx context.Context, name string) (*store.PersonaVersion, error) {
+	if name != AnalystPersonaName {
+		return nil, nil
+	}
+	return p.version, nil
+}
+
+type compiler struct{}
+
+func (compiler) Compile(ctx context.Context, name, text string) (*prompt.Template, error) {
+	return prompt.Compile(name, text, nil)
+}
+
+// cannedModel answers every request with content and records the requests.
+type cannedModel struct {
+	content  string
+	requests []llm.Request
+}
+
+func (m *cannedModel) Complete(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	m.requests = append(m.requests, req)
+	return &llm.Response{Content: m.content}, nil
+}
+
+func TestModelAnalyst_ScoresWithAnalystPersona(t *testing.T) {
+	rubric := testRubric(t, `[
+		{"name": "completeness", "description": "covers every component", "weight": 3},
+		{"name": "clarity", "weight": 1}
+	]`, 0.8)
+	persona := analystPersona{version: &store.PersonaVersion{
+		PromptTemplate: `Review stage {{.Input.stage}} against rubric {{.Input.rubric.name}}.`,
+		ModelConfig:    json.RawMessage(`{"provider": "fake", "model": "critic"}`),
+	}}
+	model := &cannedModel{content: "```json\n" + `{
+		"scores": [
+			{"criterion": "completeness", "score": 0.5, "comment": "no deployment plan"},
+			{"criterion": "clarity", "score": 1}
+		],
+		"comments": "Solid, but incomplete."
+	}` + "\n```"}
+	analyst := NewModelAnalyst(persona, compiler{}, model, HeuristicAnalyst{})
+	run := &store.StageRun{OutputContext: json.RawMessage(`{"architecture": "a monolith"}`)}
+
+	assessment, err := analyst.Assess(context.Background(), rubric, workflow.Stage{Name: "design", Persona: "architect"}, run)
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	if len(model.requests) != 1 {
+		t.Fatalf("Expected one model call, got %d", len(model.requests))
+	}
+	req := model.requests[0]
+	if req.Config.Model != "critic" || len(req.Messages) != 2 {
+		t.Fatalf("Expected the analyst persona's model and two messages, got %+v", req)
+	}
+	if req.Messages[0].Content != "Review stage design against rubric architecture-review." {
+		t.Errorf("Unexpected system prompt %q", req.Messages[0].Content)
+	}
+	for _, want := range []string{"a monolith", "covers every component", "completeness"} {
+		if !strings.Contains(req.Messages[1].Content, want) {
+			t.Errorf("Expected the user message to contain %q, got %q", want, req.Messages[1].Content)
+		}
+	}
+
+	if math.Abs(OverallScore(rubric, assessment)-0.625) > 1e-9 {
+		t.Errorf("Expected weighted score 0.625, got %v", OverallScore(rubric, assessment))
+	}
+	if assessment.Comments != "Solid, but incomplete." || assessment.Scores[0].Comment != "no deployment plan" {
+		t.Errorf("Unexpected comments %+v", assessment)
+	}
+}
+
+func TestModelAnalyst_ScoresWithFakeModel(t *testing.T) {
+	rubric := testRubric(t, `[
+		{"name": "completeness", "weight": 3},
+		{"name": "clarity", "weight": 1}
+	]`, 0.8)
+	persona := analystPersona{version: &store.PersonaVersion{
+		PromptTemplate: `Review stage {{.Input.stage}}.`,
+		ModelConfig:    json.RawMessage(`{"provider": "fake", "model": "critic"}`),
+	}}
+	analyst := NewModelAnalyst(persona, compiler{}, &llm.Fake{}, HeuristicAnalyst{})
+	run := &store.StageRun{OutputContext: json.RawMessage(`{"architecture": "a monolith"}`)}
+
+	assessment, err := analyst.Assess(context.Background(), rubric, workflow.Stage{Name: "design", Persona: "architect"}, run)
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	if len(assessment.Scores) != 2 || assessment.Comments == "" {
+		t.Errorf("Expected both criteria scored and a summary, got %+v", assessment)
+	}
+	if OverallScore(rubric, assessment) != 1 {
+		t.Errorf("Expected the fake model to pass the run, got %v", OverallScore(rubric, assessment))
+	}
+}
+
+func TestModelAnalyst_FallsBackWithoutAnalystPersona(t *testing.T) {
+	rubric := testRubric(t, `[{"name": "completeness", "weight": 1, "required_keys": ["summary"]}]`, 1)
+	model := &cannedModel{}
+	analyst := NewModelAnalyst(analystPersona{}, compiler{}, model, HeuristicAnalyst{})
+	run := &store.StageRun{OutputContext: json.RawMessage(`{"summary": "all good"}`)}
+
+	assessment, err := analyst.Assess(context.Background(), rubric, workflow.Stage{Name: "plan"}, run)
+	if err != nil {
+		t.Fatalf("Assess failed: %v", err)
+	}
+	if len(model.requests) != 0 {
+		t.Errorf("Expected no model call, got %d", len(model.requests))
+	}
+	if OverallScore(rubric, assessment) != 1 {
+		t.Errorf("Expected the heuristic score of 1, got %v", OverallScore(rubric, assessment))
+	}
+}
+
+func TestParseAssessment_RejectsInvalidResponses(t *testing.T) {
+	rubric := testRubric(t, `[{"name": "completeness", "weight": 1}]`, 0.5)
+	cases := map[string]string{
+		"not json":          "looks great to me",
+		"scores not a list": `{"scores": "high", "comments": ""}`,
+		"unknown criterion": `{"scores": [{"criterion": "style", "score": 1}]}`,
+		"scored twice":      `{"scores": [{"criterion": "completeness", "score": 1}, {"criterion": "completeness", "score": 0}]}`,
+	}
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseAssessment(rubric, content); err == nil {
+				t.Errorf("Expected %q to be rejected", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"workflow-engine/store"
+)
+
+// AnalystPersonaName is the meta-persona ModelAnalyst has critique other
+// personas' output.
+const AnalystPersonaName = "Quality-Analyst"
+
+// FailureAction decides what happens to a stage whose output scores below the
+// rubric threshold.
+type FailureAction string
+
+const (
+	// FailureActionFail rejects the stage run, which fails the project.
+	FailureActionFail FailureAction = "fail"
+	// FailureActionRerun rejects the stage run and schedules a new attempt,
+	// up to the rubric's MaxReruns.
+	FailureActionRerun FailureAction = "rerun"
+)
+
+// Criterion is one scored aspect of a rubric.
+type Criterion struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+	// RequiredKeys lists output keys that must be present and non-empty for
+	// the criterion to be met.
+	RequiredKeys []string `json:"required_keys,omitempty"`
+}
+
+// Rubric is the typed form of a stored rubric.
+type Rubric struct {
+	*store.Rubric
+	Criteria  []Criterion
+	OnFailure FailureAction
+}
+
+// ParseRubric decodes and validates a stored rubric.
+func ParseRubric(stored *store.Rubric) (*Rubric, error) {
+	var criteria []Criterion
+	if err := json.Unmarshal(stored.Criteria, &criteria); err != nil {
+		return nil, fmt.Errorf("rubric %q: invalid criteria: %w", stored.Name, err)
+	}
+	rubric := &Rubric{
+		Rubric:    stored,
+		Criteria:  criteria,
+		OnFailure: FailureAction(stored.OnFailure),
+	}
+	if err := rubric.Validate(); err != nil {
+		return nil, err
+	}
+	return rubric, nil
+}
+
+// Validate checks that the rubric can be scored.
+func (r *Rubric) Validate() error {
+	var problems []string
+	if len(r.Criteria) == 0 {
+		problems = append(problems, "at least one criterion is required")
+	}
+	seen := make(map[string]bool)
+	for i, criterion := range r.Criteria {
+		if strings.TrimSpace(criterion.Name) == "" {
+			problems = append(problems, fmt.Sprintf("criterion #%d has no name", i+1))
+			continue
+		}
+		if seen[criterion.Name] {
+			problems = append(problems, fmt.Sprintf("criterion %q is defined more than once", criterion.Name))
+		}
+		seen[criterion.Name] = true
+		if criterion.Weight <= 0 {
+			problems = append(problems, fmt.Sprintf("criterion %q must have a positive weight", criterion.Name))
+		}
+	}
+	if r.Threshold < 0 || r.Threshold > 1 {
+		problems = append(problems, "threshold must be between 0 and 1")
+	}
+	switch r.OnFailure {
+	case FailureActionFail, FailureActionRerun:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown on_failure action %q", r.OnFailure))
+	}
+	if r.MaxReruns < 0 {
+		problems = append(problems, "max_reruns must not be negative")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid rubric %q: %s", r.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
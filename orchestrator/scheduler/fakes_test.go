@@ -0,0 +1,366 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"workflow-engine/prompt"
+	"workflow-engine/quality"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// memStore keeps projects, stage runs, workflows and persona versions in
+// memory. It implements Projects, StageRuns, Workflows and Personas with the
+// semantics of the database store the scheduler relies on, and hands out
+// copies so the scheduler never shares a run with the test.
+type memStore struct {
+	mu        sync.Mutex
+	projects  map[uuid.UUID]*store.Project
+	runs      []*store.StageRun // oldest first
+	workflows map[uuid.UUID]*store.Workflow
+	personas  map[string]*store.PersonaVersion
+	// markPublishedErr is returned by MarkStageRunOutputsPublished.
+	markPublishedErr error
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		projects:  make(map[uuid.UUID]*store.Project),
+		workflows: make(map[uuid.UUID]*store.Workflow),
+		personas:  make(map[string]*store.PersonaVersion),
+	}
+}
+
+func (m *memStore) GetProject(ctx context.Context, id uuid.UUID) (*store.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	project, ok := m.projects[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *project
+	return &copied, nil
+}
+
+func (m *memStore) ListProjectsByStatus(ctx context.Context, status store.ProjectStatus) ([]*store.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var projects []*store.Project
+	for _, project := range m.projects {
+		if project.Status == status {
+			copied := *project
+			projects = append(projects, &copied)
+		}
+	}
+	return projects, nil
+}
+
+func (m *memStore) UpdateProjectStatus(ctx context.Context, id uuid.UUID, status store.ProjectStatus, actor, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	project, ok := m.projects[id]
+	if !ok {
+		return fmt.Errorf("project %s not found", id)
+	}
+	project.Status = status
+	project.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memStore) CreateStageRun(ctx context.Context, stageRun *store.StageRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stageRun.ID = uuid.New()
+	stageRun.Status = store.StageRunStatusPending
+	stageRun.Attempt = 1
+	stageRun.CreatedAt = time.Now()
+	stageRun.UpdatedAt = stageRun.CreatedAt
+	copied := *stageRun
+	m.runs = append(m.runs, &copied)
+	return nil
+}
+
+// run returns the stored run; the caller must hold m.mu.
+func (m *memStore) run(id uuid.UUID) (*store.StageRun, error) {
+	for _, run := range m.runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return nil, fmt.Errorf("stage run %s: %w", id, store.ErrStageRunNotFound)
+}
+
+func (m *memStore) GetStageRun(ctx context.Context, id uuid.UUID) (*store.StageRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, err := m.run(id)
+	if err != nil {
+		return nil, nil
+	}
+	copied := *run
+	return &copied, nil
+}
+
+func (m *memStore) listRuns(match func(run *store.StageRun) bool) []*store.StageRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var runs []*store.StageRun
+	for _, run := range m.runs {
+		if match(run) {
+			copied := *run
+			runs = append(runs, &copied)
+		}
+	}
+	return runs
+}
+
+func (m *memStore) ListStageRunsByProject(ctx context.Context, projectID uuid.UUID) ([]*store.StageRun, error) {
+	return m.listRuns(func(run *store.StageRun) bool { return run.ProjectID == projectID }), nil
+}
+
+func (m *memStore) ListUncheckedStageRuns(ctx context.Context, completedBefore time.Time) ([]*store.StageRun, error) {
+	return m.listRuns(func(run *store.StageRun) bool {
+		return run.Status == store.StageRunStatusCompleted && !run.QualityCheckedAt.Valid &&
+			run.CompletedAt.Time.Before(completedBefore) && m.projects[run.ProjectID].Status == store.ProjectStatusRunning
+	}), nil
+}
+
+func (m *memStore) ListUnpublishedStageRuns(ctx context.Context, changedBefore time.Time) ([]*store.StageRun, error) {
+	return m.listRuns(func(run *store.StageRun) bool {
+		succeeded := run.Status == store.StageRunStatusApproved || (run.Status == store.StageRunStatusCompleted && !run.ReviewRequired)
+		return succeeded && run.QualityCheckedAt.Valid && !run.OutputsPublishedAt.Valid &&
+			run.UpdatedAt.Before(changedBefore) && m.projects[run.ProjectID].Status == store.ProjectStatusRunning
+	}), nil
+}
+
+// update applies change to a stored run and bumps its updated_at.
+func (m *memStore) update(id uuid.UUID, change func(run *store.StageRun) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, err := m.run(id)
+	if err != nil {
+		return err
+	}
+	if err := change(run); err != nil {
+		return err
+	}
+	run.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *memStore) MarkStageRunQualityChecked(ctx context.Context, id uuid.UUID) error {
+	return m.update(id, func(run *store.StageRun) error {
+		run.QualityCheckedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		return nil
+	})
+}
+
+func (m *memStore) MarkStageRunOutputsPublished(ctx context.Context, id uuid.UUID) error {
+	if m.markPublishedErr != nil {
+		return m.markPublishedErr
+	}
+	return m.update(id, func(run *store.StageRun) error {
+		run.OutputsPublishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		return nil
+	})
+}
+
+func (m *memStore) UpdateStageRunStatus(ctx context.Context, id uuid.UUID, status store.StageRunStatus, startedAt, completedAt sql.NullTime) error {
+	return m.update(id, func(run *store.StageRun) error {
+		run.Status = status
+		run.StartedAt = startedAt
+		run.CompletedAt = completedAt
+		return nil
+	})
+}
+
+func (m *memStore) RecordStageRunError(ctx context.Context, id uuid.UUID, class, message string) error {
+	return m.update(id, func(run *store.StageRun) error {
+		run.ErrorClass = sql.NullString{String: class, Valid: true}
+		run.LastError = sql.NullString{String: message, Valid: true}
+		return nil
+	})
+}
+
+func (m *memStore) RequeueStageRun(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) error {
+	return m.update(id, func(run *store.StageRun) error {
+		if run.Status != store.StageRunStatusFailed {
+			return &store.IllegalTransitionError{StageRunID: id, From: run.Status, To: store.StageRunStatusPending}
+		}
+		run.Status = store.StageRunStatusPending
+		run.Attempt++
+		run.NextAttemptAt = sql.NullTime{Time: nextAttemptAt, Valid: true}
+		run.StartedAt = sql.NullTime{}
+		run.CompletedAt = sql.NullTime{}
+		return nil
+	})
+}
+
+func (m *memStore) ReviewStageRun(ctx context.Context, id uuid.UUID, decision store.StageRunStatus, reviewer, comment string, rerun *store.StageRun) error {
+	err := m.update(id, func(run *store.StageRun) error {
+		if run.Status != store.StageRunStatusCompleted || !run.ReviewRequired || !run.QualityCheckedAt.Valid {
+			return fmt.Errorf("stage run %s is %s: %w", id, run.Status, store.ErrReviewNotPending)
+		}
+		run.Status = decision
+		run.ReviewedBy = sql.NullString{String: reviewer, Valid: true}
+		run.ReviewComment = sql.NullString{String: comment, Valid: comment != ""}
+		run.ReviewedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		return nil
+	})
+	if err != nil || rerun == nil {
+		return err
+	}
+	rerun.PreviousRunID = uuid.NullUUID{UUID: id, Valid: true}
+	return m.CreateStageRun(ctx, rerun)
+}
+
+func (m *memStore) GetWorkflow(ctx context.Context, id uuid.UUID) (*store.Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.workflows[id], nil
+}
+
+func (m *memStore) GetCurrentPersonaVersionByName(ctx context.Context, name string) (*store.PersonaVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.personas[name], nil
+}
+
+// addProject stores a running project of a workflow with the given JSON
+// definition, and a persona for every stage of it rendering template.
+func (m *memStore) addProject(t *testing.T, definition, template string) *store.Project {
+	t.Helper()
+	def, err := workflow.Parse([]byte(definition), workflow.FormatJSON)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	wf := &store.Workflow{ID: uuid.New(), Name: def.Name, Definition: json.RawMessage(definition)}
+	project := &store.Project{
+		ID:         uuid.New(),
+		Name:       "Test Project",
+		Status:     store.ProjectStatusRunning,
+		WorkflowID: uuid.NullUUID{UUID: wf.ID, Valid: true},
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.workflows[wf.ID] = wf
+	m.projects[project.ID] = project
+	for _, stage := range def.Stages {
+		m.personas[stage.Persona] = &store.PersonaVersion{ID: uuid.New(), Version: 1, PromptTemplate: template}
+	}
+	return project
+}
+
+// finish moves a stored run through running to status with output, as an
+// executor finishing it would.
+func (m *memStore) finish(t *testing.T, id uuid.UUID, status store.StageRunStatus, output string) {
+	t.Helper()
+	err := m.update(id, func(run *store.StageRun) error {
+		now := time.Now()
+		run.Status = status
+		run.StartedAt = sql.NullTime{Time: now, Valid: true}
+		run.CompletedAt = sql.NullTime{Time: now, Valid: true}
+		if output != "" {
+			run.OutputContext = json.RawMessage(output)
+		}
+		if status == store.StageRunStatusFailed {
+			run.ErrorClass = sql.NullString{String: string(workflow.ErrorClassProvider), Valid: true}
+			run.LastError = sql.NullString{String: "rate limited", Valid: true}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("finish failed: %v", err)
+	}
+}
+
+// latest returns a copy of the most recent run of a stage, or nil.
+func (m *memStore) latest(projectID uuid.UUID, stageName string) *store.StageRun {
+	runs := m.listRuns(func(run *store.StageRun) bool {
+		return run.ProjectID == projectID && run.StageName == stageName
+	})
+	if len(runs) == 0 {
+		return nil
+	}
+	return runs[len(runs)-1]
+}
+
+func (m *memStore) projectStatus(id uuid.UUID) store.ProjectStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.projects[id].Status
+}
+
+// recordingDispatcher records the runs handed to it.
+type recordingDispatcher struct {
+	mu         sync.Mutex
+	dispatched []*store.StageRun
+}
+
+func (d *recordingDispatcher) Dispatch(ctx context.Context, run *store.StageRun) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dispatched = append(d.dispatched, run)
+}
+
+// scriptedEvaluator answers evaluations with outcomes in order, then with
+// nil, meaning no rubric, and counts the calls.
+type scriptedEvaluator struct {
+	outcomes []*quality.Outcome
+	calls    int
+}
+
+func (e *scriptedEvaluator) EvaluateStageRun(ctx context.Context, run *store.StageRun, stage workflow.Stage) (*quality.Outcome, error) {
+	e.calls++
+	if len(e.outcomes) == 0 {
+		return nil, nil
+	}
+	outcome := e.outcomes[0]
+	e.outcomes = e.outcomes[1:]
+	return outcome, nil
+}
+
+// failingOutcome is an evaluation below the threshold of a rubric that allows
+// maxReruns quality reruns.
+func failingOutcome(maxReruns int) *quality.Outcome {
+	return &quality.Outcome{
+		Evaluation: &store.Evaluation{OverallScore: 0.2, Verdict: store.EvaluationVerdictFail},
+		Rubric: &quality.Rubric{
+			Rubric:    &store.Rubric{Name: "completeness", Threshold: 0.8, MaxReruns: maxReruns},
+			OnFailure: quality.FailureActionRerun,
+		},
+	}
+}
+
+type compiler struct{}
+
+func (compiler) Compile(ctx context.Context, name, text string) (*prompt.Template, error) {
+	return prompt.Compile(name, text, nil)
+}
+
+// newTestScheduler returns a scheduler over fakes.
+func newTestScheduler(evaluator Evaluator) (*Scheduler, *memStore, *recordingBus, *recordingDispatcher) {
+	mem := newMemStore()
+	bus := &recordingBus{}
+	dispatcher := &recordingDispatcher{}
+	s := &Scheduler{
+		projects:   mem,
+		stageRuns:  mem,
+		workflows:  mem,
+		personas:   mem,
+		context:    bus,
+		prompts:    compiler{},
+		evaluator:  evaluator,
+		dispatcher: dispatcher,
+		locks:      make(map[uuid.UUID]*sync.Mutex),
+	}
+	return s, mem, bus, dispatcher
+}
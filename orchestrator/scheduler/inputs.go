@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"workflow-engine/contextbus"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// ContextBus reads the Context Bus entries stages take as input and publishes
+// the outputs they declare. *contextbus.Bus implements it.
+type ContextBus interface {
+	Latest(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error)
+	Publish(ctx context.Context, projectID uuid.UUID, key string, kind contextbus.Kind, value interface{}, stageRunID uuid.NullUUID) (*store.ContextEntry, error)
+}
+
+// AssembleInput builds a stage's InputContext.
+//
+// Without explicit stage inputs, the outputs of all direct parents are merged
+// in depends_on order and keys published by more than one parent are resolved
+// with the stage's conflict policy. With explicit stage inputs, only the
+// mapped keys are taken from upstream outputs. Context Bus inputs are read
+// through readContext and take precedence over merged keys.
+func AssembleInput(stage workflow.Stage, latest map[string]*store.StageRun, readContext func(key string) (json.RawMessage, bool, error)) (json.RawMessage, error) {
+	outputs := make(map[string]map[string]json.RawMessage)
+	outputOf := func(stageName string) (map[string]json.RawMessage, error) {
+		if output, ok := outputs[stageName]; ok {
+			return output, nil
+		}
+		output, err := decodeOutput(latest[stageName])
+		if err != nil {
+			return nil, fmt.Errorf("output of stage %q: %w", stageName, err)
+		}
+		outputs[stageName] = output
+		return output, nil
+	}
+
+	input := make(map[string]json.RawMessage)
+
+	if stage.HasStageInputs() {
+		for _, mapping := range stage.Inputs {
+			if mapping.FromContextBus() {
+				continue
+			}
+			output, err := outputOf(mapping.Stage)
+			if err != nil {
+				return nil, err
+			}
+			value, ok := output[mapping.Key]
+			if !ok {
+				if mapping.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("stage %q did not publish required input %q", mapping.Stage, mapping.Key)
+			}
+			input[mapping.Name()] = value
+		}
+	} else {
+		publishers := make(map[string][]string)
+		values := make(map[string]map[string]json.RawMessage)
+		for _, parent := range stage.DependsOn {
+			output, err := outputOf(parent)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range output {
+				publishers[key] = append(publishers[key], parent)
+				if values[key] == nil {
+					values[key] = make(map[string]json.RawMessage)
+				}
+				values[key][parent] = value
+			}
+		}
+		if err := mergeParents(stage, input, publishers, values); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mapping := range stage.Inputs {
+		if !mapping.FromContextBus() {
+			continue
+		}
+		value, ok, err := readContext(mapping.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Context Bus key %q: %w", mapping.Key, err)
+		}
+		if !ok {
+			if mapping.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("required Context Bus key %q has not been published", mapping.Key)
+		}
+		input[mapping.Name()] = value
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input context: %w", err)
+	}
+	return data, nil
+}
+
+func mergeParents(stage workflow.Stage, input map[string]json.RawMessage, publishers map[string][]string, values map[string]map[string]json.RawMessage) error {
+	var conflicts []string
+	for key, parents := range publishers {
+		if len(parents) == 1 {
+			input[key] = values[key][parents[0]]
+			continue
+		}
+		switch stage.OnConflict {
+		case workflow.ConflictFirstWins:
+			input[key] = values[key][parents[0]]
+		case workflow.ConflictLastWins:
+			input[key] = values[key][parents[len(parents)-1]]
+		case workflow.ConflictNamespace:
+			namespaced, err := json.Marshal(values[key])
+			if err != nil {
+				return fmt.Errorf("failed to namespace input %q: %w", key, err)
+			}
+			input[key] = namespaced
+		default:
+			conflicts = append(conflicts, fmt.Sprintf("%q (from %s)", key, strings.Join(parents, ", ")))
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("conflicting inputs for stage %q: %s", stage.Name, strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// decodeOutput returns a stage run's OutputContext as a map. A run without
+// output contributes nothing.
+func decodeOutput(run *store.StageRun) (map[string]json.RawMessage, error) {
+	output := make(map[string]json.RawMessage)
+	if run == nil || len(run.OutputContext) == 0 || string(run.OutputContext) == "null" {
+		return output, nil
+	}
+	if err := json.Unmarshal(run.OutputContext, &output); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	return output, nil
+}
+
+// RevisionKey is the input key under which a rerun requested by a reviewer
+// finds the output the reviewer rejected and their feedback on it.
+const RevisionKey = "revision"
+
+// Revision is the value of RevisionKey in a rerun's input.
+type Revision struct {
+	PreviousOutput json.RawMessage `json:"previous_output"`
+	Reviewer       string          `json:"reviewer"`
+	Feedback       string          `json:"feedback"`
+}
+
+// RevisionInput builds the InputContext of a rerun of a rejected stage run:
+// the rejected run's input with a Revision added under RevisionKey, replacing
+// the revision of any earlier rejection.
+func RevisionInput(rejected *store.StageRun, reviewer, feedback string) (json.RawMessage, error) {
+	input := make(map[string]json.RawMessage)
+	if len(rejected.InputContext) > 0 && string(rejected.InputContext) != "null" {
+		if err := json.Unmarshal(rejected.InputContext, &input); err != nil {
+			return nil, fmt.Errorf("input of stage run %s is not a JSON object: %w", rejected.ID, err)
+		}
+	}
+	previous := rejected.OutputContext
+	if len(previous) == 0 {
+		previous = json.RawMessage("null")
+	}
+	revision, err := json.Marshal(Revision{PreviousOutput: previous, Reviewer: reviewer, Feedback: feedback})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode revision: %w", err)
+	}
+	input[RevisionKey] = revision
+	return json.Marshal(input)
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+func outputs(byStage map[string]string) map[string]*store.StageRun {
+	latest := make(map[string]*store.StageRun)
+	for stage, output := range byStage {
+		latest[stage] = &store.StageRun{
+			StageName:     stage,
+			Status:        store.StageRunStatusCompleted,
+			OutputContext: json.RawMessage(output),
+		}
+	}
+	return latest
+}
+
+func noContext(key string) (json.RawMessage, bool, error) {
+	return nil, false, nil
+}
+
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("Invalid expected JSON %s: %v", want, err)
+	}
+	gotNorm, _ := json.Marshal(gotValue)
+	wantNorm, _ := json.Marshal(wantValue)
+	if string(gotNorm) != string(wantNorm) {
+		t.Errorf("Expected %s, got %s", wantNorm, gotNorm)
+	}
+}
+
+func TestAssembleInput_MergesParentOutputs(t *testing.T) {
+	latest := outputs(map[string]string{
+		"backend":  `{"api_spec": "openapi", "shared": "from backend"}`,
+		"frontend": `{"ui_spec": "figma", "shared": "from frontend"}`,
+	})
+
+	cases := []struct {
+		policy workflow.ConflictPolicy
+		want   string
+	}{
+		{workflow.ConflictFirstWins, `{"api_spec": "openapi", "ui_spec": "figma", "shared": "from backend"}`},
+		{workflow.ConflictLastWins, `{"api_spec": "openapi", "ui_spec": "figma", "shared": "from frontend"}`},
+		{workflow.ConflictNamespace, `{"api_spec": "openapi", "ui_spec": "figma", "shared": {"backend": "from backend", "frontend": "from frontend"}}`},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			stage := workflow.Stage{Name: "review", DependsOn: []string{"backend", "frontend"}, OnConflict: tc.policy}
+			input, err := AssembleInput(stage, latest, noContext)
+			if err != nil {
+				t.Fatalf("AssembleInput failed: %v", err)
+			}
+			assertJSON(t, input, tc.want)
+		})
+	}
+}
+
+func TestAssembleInput_ConflictErrorsByDefault(t *testing.T) {
+	latest := outputs(map[string]string{
+		"backend":  `{"shared": 1}`,
+		"frontend": `{"shared": 2}`,
+	})
+	stage := workflow.Stage{Name: "review", DependsOn: []string{"backend", "frontend"}}
+	_, err := AssembleInput(stage, latest, noContext)
+	if err == nil || !strings.Contains(err.Error(), `"shared" (from backend, frontend)`) {
+		t.Errorf("Expected conflict error naming both parents, got %v", err)
+	}
+}
+
+func TestAssembleInput_ExplicitMappingsAndContextBus(t *testing.T) {
+	latest := outputs(map[string]string{
+		"plan":    `{"tech_stack": {"languages": ["Go"]}, "risks": [], "notes": "ignored"}`,
+		"backend": `{"api_spec": "openapi"}`,
+	})
+	stage := workflow.Stage{
+		Name:      "review",
+		DependsOn: []string{"backend"},
+		Inputs: []workflow.Input{
+			{Stage: "backend", Key: "api_spec"},
+			{Stage: "plan", Key: "tech_stack", As: "stack"},
+			{Stage: "plan", Key: "budget", Optional: true},
+			{Source: workflow.InputSourceContextBus, Key: "milestone", As: "last_milestone"},
+		},
+	}
+	readContext := func(key string) (json.RawMessage, bool, error) {
+		if key == "milestone" {
+			return json.RawMessage(`{"milestone": "m1", "summary": "done"}`), true, nil
+		}
+		return nil, false, nil
+	}
+
+	input, err := AssembleInput(stage, latest, readContext)
+	if err != nil {
+		t.Fatalf("AssembleInput failed: %v", err)
+	}
+	assertJSON(t, input, `{"api_spec": "openapi", "stack": {"languages": ["Go"]}, "last_milestone": {"milestone": "m1", "summary": "done"}}`)
+}
+
+func TestAssembleInput_MissingRequiredInputs(t *testing.T) {
+	latest := outputs(map[string]string{"plan": `{}`})
+
+	stage := workflow.Stage{Name: "build", DependsOn: []string{"plan"}, Inputs: []workflow.Input{{Stage: "plan", Key: "tech_stack"}}}
+	if _, err := AssembleInput(stage, latest, noContext); err == nil {
+		t.Error("Expected error for missing upstream key")
+	}
+
+	stage = workflow.Stage{Name: "build", DependsOn: []string{"plan"}, Inputs: []workflow.Input{{Source: workflow.InputSourceContextBus, Key: "risks"}}}
+	if _, err := AssembleInput(stage, latest, noContext); err == nil {
+		t.Error("Expected error for missing Context Bus key")
+	}
+
+	latest = outputs(map[string]string{"plan": `["not", "an", "object"]`})
+	stage = workflow.Stage{Name: "build", DependsOn: []string{"plan"}}
+	if _, err := AssembleInput(stage, latest, noContext); err == nil {
+		t.Error("Expected error for non-object parent output")
+	}
+}
+
+func TestRevisionInput(t *testing.T) {
+	rejected := &store.StageRun{
+		StageName:     "design",
+		InputContext:  json.RawMessage(`{"requirements": "a todo app", "revision": {"feedback": "older"}}`),
+		OutputContext: json.RawMessage(`{"architecture": "monolith"}`),
+	}
+	input, err := RevisionInput(rejected, "ana", "Split out the sync service.")
+	if err != nil {
+		t.Fatalf("RevisionInput failed: %v", err)
+	}
+	assertJSON(t, input, `{
+		"requirements": "a todo app",
+		"revision": {
+			"previous_output": {"architecture": "monolith"},
+			"reviewer": "ana",
+			"feedback": "Split out the sync service."
+		}
+	}`)
+
+	input, err = RevisionInput(&store.StageRun{StageName: "design"}, "ana", "Try again.")
+	if err != nil {
+		t.Fatalf("RevisionInput failed: %v", err)
+	}
+	assertJSON(t, input, `{"revision": {"previous_output": null, "reviewer": "ana", "feedback": "Try again."}}`)
+}
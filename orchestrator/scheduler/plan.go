@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+// Outcome is the overall state of a project's DAG as seen by the planner.
+type Outcome int
+
+const (
+	// OutcomeInProgress means stages are still pending, running or ready.
+	OutcomeInProgress Outcome = iota
+	// OutcomeCompleted means every stage finished successfully.
+	OutcomeCompleted
+	// OutcomeFailed means at least one stage failed terminally.
+	OutcomeFailed
+)
+
+// Plan is the result of evaluating a workflow against its current stage runs.
+type Plan struct {
+	Outcome Outcome
+	// Ready lists stages whose dependencies have all succeeded and that have
+	// no stage run yet, in definition order.
+	Ready []workflow.Stage
+	// Retry lists stages whose latest run failed but whose retry policy
+	// allows another attempt, in definition order.
+	Retry []workflow.Stage
+	// FailedStage names the first failed stage when Outcome is OutcomeFailed.
+	FailedStage string
+}
+
+// LatestRuns indexes stage runs by stage name, keeping the most recently
+// created run for each stage. runs must be ordered oldest first.
+func LatestRuns(runs []*store.StageRun) map[string]*store.StageRun {
+	latest := make(map[string]*store.StageRun, len(runs))
+	for _, run := range runs {
+		latest[run.StageName] = run
+	}
+	return latest
+}
+
+// Succeeded reports whether a stage run lets downstream stages proceed. A
+// completed run only does once it has passed the quality gate, and one that
+// requires review only once approved.
+func Succeeded(run *store.StageRun) bool {
+	if run == nil {
+		return false
+	}
+	switch run.Status {
+	case store.StageRunStatusApproved:
+		return true
+	case store.StageRunStatusCompleted:
+		return !run.ReviewRequired && run.QualityCheckedAt.Valid
+	}
+	return false
+}
+
+func failed(run *store.StageRun) bool {
+	return run != nil && (run.Status == store.StageRunStatusFailed || run.Status == store.StageRunStatusRejected)
+}
+
+// QualityRejections counts the runs of a stage the quality gate rejected.
+// Runs a reviewer rejected do not count: they have a reviewer recorded.
+func QualityRejections(runs []*store.StageRun, stageName string) int {
+	rejected := 0
+	for _, run := range runs {
+		if run.StageName == stageName && run.Status == store.StageRunStatusRejected && !run.ReviewedBy.Valid {
+			rejected++
+		}
+	}
+	return rejected
+}
+
+// Retryable reports whether a failed run may be attempted again under its
+// stage's retry policy. A run failed without a recorded class counts as an
+// internal error.
+func Retryable(stage workflow.Stage, run *store.StageRun) bool {
+	if run == nil || run.Status != store.StageRunStatusFailed {
+		return false
+	}
+	class := workflow.ErrorClass(run.ErrorClass.String)
+	if class == "" {
+		class = workflow.ErrorClassInternal
+	}
+	return stage.Retry.Allows(run.Attempt, class)
+}
+
+// PlanProject decides which stages are ready to run and whether the project
+// as a whole has completed or failed.
+func PlanProject(def *workflow.Definition, latest map[string]*store.StageRun) Plan {
+	plan := Plan{Outcome: OutcomeInProgress}
+
+	for _, stage := range def.Stages {
+		run := latest[stage.Name]
+		if Retryable(stage, run) {
+			plan.Retry = append(plan.Retry, stage)
+			continue
+		}
+		if failed(run) {
+			plan.Outcome = OutcomeFailed
+			plan.Retry = nil
+			plan.FailedStage = stage.Name
+			return plan
+		}
+	}
+
+	allSucceeded := true
+	for _, stage := range def.Stages {
+		run := latest[stage.Name]
+		if !Succeeded(run) {
+			allSucceeded = false
+		}
+		if run != nil {
+			continue
+		}
+		ready := true
+		for _, dep := range stage.DependsOn {
+			if !Succeeded(latest[dep]) {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			plan.Ready = append(plan.Ready, stage)
+		}
+	}
+
+	if allSucceeded {
+		plan.Outcome = OutcomeCompleted
+	}
+	return plan
+}
@@ -0,0 +1,216 @@
+package scheduler
+
+import (
+	"database/sql"
+	"testing"
+
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+)
+
+func diamond() *workflow.Definition {
+	return &workflow.Definition{
+		Name: "diamond",
+		Stages: []workflow.Stage{
+			{Name: "plan", Persona: "architect"},
+			{Name: "backend", Persona: "developer", DependsOn: []string{"plan"}},
+			{Name: "frontend", Persona: "developer", DependsOn: []string{"plan"}},
+			{Name: "review", Persona: "reviewer", DependsOn: []string{"backend", "frontend"}},
+		},
+	}
+}
+
+func runs(statuses map[string]store.StageRunStatus) map[string]*store.StageRun {
+	latest := make(map[string]*store.StageRun)
+	for stage, status := range statuses {
+		latest[stage] = &store.StageRun{StageName: stage, Status: status, QualityCheckedAt: sql.NullTime{Valid: true}}
+	}
+	return latest
+}
+
+func stageNames(stages []workflow.Stage) []string {
+	names := make([]string, 0, len(stages))
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	return names
+}
+
+func TestPlanProject(t *testing.T) {
+	cases := []struct {
+		name    string
+		runs    map[string]store.StageRunStatus
+		outcome Outcome
+		ready   []string
+	}{
+		{
+			name:    "fresh project starts at the root",
+			runs:    nil,
+			outcome: OutcomeInProgress,
+			ready:   []string{"plan"},
+		},
+		{
+			name:    "root running blocks everything",
+			runs:    map[string]store.StageRunStatus{"plan": store.StageRunStatusRunning},
+			outcome: OutcomeInProgress,
+		},
+		{
+			name:    "independent stages are ready together",
+			runs:    map[string]store.StageRunStatus{"plan": store.StageRunStatusCompleted},
+			outcome: OutcomeInProgress,
+			ready:   []string{"backend", "frontend"},
+		},
+		{
+			name: "join waits for every parent",
+			runs: map[string]store.StageRunStatus{
+				"plan":     store.StageRunStatusApproved,
+				"backend":  store.StageRunStatusCompleted,
+				"frontend": store.StageRunStatusRunning,
+			},
+			outcome: OutcomeInProgress,
+		},
+		{
+			name: "join is ready once parents succeed",
+			runs: map[string]store.StageRunStatus{
+				"plan":     store.StageRunStatusCompleted,
+				"backend":  store.StageRunStatusCompleted,
+				"frontend": store.StageRunStatusApproved,
+			},
+			outcome: OutcomeInProgress,
+			ready:   []string{"review"},
+		},
+		{
+			name: "failed stage fails the project",
+			runs: map[string]store.StageRunStatus{
+				"plan":    store.StageRunStatusCompleted,
+				"backend": store.StageRunStatusFailed,
+			},
+			outcome: OutcomeFailed,
+		},
+		{
+			name: "all stages succeeded",
+			runs: map[string]store.StageRunStatus{
+				"plan":     store.StageRunStatusCompleted,
+				"backend":  store.StageRunStatusCompleted,
+				"frontend": store.StageRunStatusCompleted,
+				"review":   store.StageRunStatusApproved,
+			},
+			outcome: OutcomeCompleted,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := PlanProject(diamond(), runs(tc.runs))
+			if plan.Outcome != tc.outcome {
+				t.Errorf("Expected outcome %d, got %d", tc.outcome, plan.Outcome)
+			}
+			got := stageNames(plan.Ready)
+			if len(got) != len(tc.ready) {
+				t.Fatalf("Expected ready stages %v, got %v", tc.ready, got)
+			}
+			for i := range got {
+				if got[i] != tc.ready[i] {
+					t.Errorf("Expected ready stages %v, got %v", tc.ready, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanProject_RetriesFailedRunWithinPolicy(t *testing.T) {
+	def := diamond()
+	def.Stages[1].Retry = &workflow.RetryPolicy{MaxAttempts: 2, RetryOn: []workflow.ErrorClass{workflow.ErrorClassProvider}}
+
+	latest := runs(map[string]store.StageRunStatus{
+		"plan":     store.StageRunStatusCompleted,
+		"backend":  store.StageRunStatusFailed,
+		"frontend": store.StageRunStatusCompleted,
+	})
+	latest["backend"].Attempt = 1
+	latest["backend"].ErrorClass = sql.NullString{String: string(workflow.ErrorClassProvider), Valid: true}
+
+	plan := PlanProject(def, latest)
+	if plan.Outcome != OutcomeInProgress {
+		t.Fatalf("Expected a retryable failure to keep the project in progress, got %d", plan.Outcome)
+	}
+	if got := stageNames(plan.Retry); len(got) != 1 || got[0] != "backend" {
+		t.Errorf("Expected backend to be retried, got %v", got)
+	}
+	if len(plan.Ready) != 0 {
+		t.Errorf("Expected review to wait for the retry, got %v", stageNames(plan.Ready))
+	}
+
+	latest["backend"].Attempt = 2
+	if plan := PlanProject(def, latest); plan.Outcome != OutcomeFailed || len(plan.Retry) != 0 {
+		t.Errorf("Expected the project to fail once attempts are exhausted, got %+v", plan)
+	}
+
+	latest["backend"].Attempt = 1
+	latest["backend"].ErrorClass = sql.NullString{String: string(workflow.ErrorClassInvalidOutput), Valid: true}
+	if plan := PlanProject(def, latest); plan.Outcome != OutcomeFailed {
+		t.Errorf("Expected a non-retryable error class to fail the project, got %d", plan.Outcome)
+	}
+}
+
+func TestPlanProject_WaitsForQualityGate(t *testing.T) {
+	latest := runs(map[string]store.StageRunStatus{"plan": store.StageRunStatusCompleted})
+	latest["plan"].QualityCheckedAt = sql.NullTime{}
+
+	plan := PlanProject(diamond(), latest)
+	if plan.Outcome != OutcomeInProgress || len(plan.Ready) != 0 {
+		t.Errorf("Expected an unchecked plan run to hold back its dependants, got %+v", plan)
+	}
+}
+
+func TestLatestRuns_KeepsNewestAttempt(t *testing.T) {
+	latest := LatestRuns([]*store.StageRun{
+		{StageName: "plan", Status: store.StageRunStatusFailed},
+		{StageName: "plan", Status: store.StageRunStatusCompleted},
+	})
+	if latest["plan"].Status != store.StageRunStatusCompleted {
+		t.Errorf("Expected newest run to win, got %s", latest["plan"].Status)
+	}
+}
+
+func TestPlanProject_WaitsForReview(t *testing.T) {
+	latest := runs(map[string]store.StageRunStatus{"plan": store.StageRunStatusCompleted})
+	latest["plan"].ReviewRequired = true
+
+	plan := PlanProject(diamond(), latest)
+	if plan.Outcome != OutcomeInProgress || len(plan.Ready) != 0 {
+		t.Fatalf("Expected the project to wait for review of plan, got %+v", plan)
+	}
+
+	latest["plan"].Status = store.StageRunStatusApproved
+	plan = PlanProject(diamond(), latest)
+	if got := stageNames(plan.Ready); len(got) != 2 {
+		t.Errorf("Expected backend and frontend to be ready after approval, got %v", got)
+	}
+
+	latest["plan"].Status = store.StageRunStatusRejected
+	plan = PlanProject(diamond(), latest)
+	if plan.Outcome != OutcomeFailed || plan.FailedStage != "plan" {
+		t.Errorf("Expected the rejection to fail the project at plan, got %+v", plan)
+	}
+}
+
+func TestQualityRejections_IgnoresReviewerRejections(t *testing.T) {
+	reviewer := sql.NullString{String: "ana", Valid: true}
+	history := []*store.StageRun{
+		{StageName: "design", Status: store.StageRunStatusRejected},
+		{StageName: "design", Status: store.StageRunStatusRejected, ReviewedBy: reviewer},
+		{StageName: "design", Status: store.StageRunStatusRejected, ReviewedBy: reviewer},
+		{StageName: "design", Status: store.StageRunStatusRejected},
+		{StageName: "design", Status: store.StageRunStatusFailed},
+		{StageName: "build", Status: store.StageRunStatusRejected},
+		{StageName: "design", Status: store.StageRunStatusCompleted},
+	}
+
+	if got := QualityRejections(history, "design"); got != 2 {
+		t.Errorf("Expected 2 quality rejections of design, got %d", got)
+	}
+	if got := QualityRejections(history, "build"); got != 1 {
+		t.Errorf("Expected 1 quality rejection of build, got %d", got)
+	}
+}
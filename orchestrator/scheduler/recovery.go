@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"workflow-engine/store"
+)
+
+// Recover resumes work an orchestrator left behind when it stopped without
+// draining. Runs that completed at least settle ago but were never evaluated
+// go through the quality gate, as their executor stopped before handing them
+// to the scheduler; runs completed more recently are still being handed over.
+// Runs that succeeded at least settle ago without their outputs reaching the
+// Context Bus have them published. Then every running project's DAG is
+// re-evaluated, so failed runs are re-queued where their stage's retry policy
+// allows and fail the project otherwise, and stages whose dependencies
+// succeeded are scheduled. Runs left running are failed by the executor once
+// their lease expires. Errors for one run or project are logged so the others
+// are still recovered.
+func (s *Scheduler) Recover(ctx context.Context, settle time.Duration) error {
+	unchecked, err := s.stageRuns.ListUncheckedStageRuns(ctx, time.Now().Add(-settle))
+	if err != nil {
+		return err
+	}
+	for _, run := range unchecked {
+		log.Printf("Evaluating stage %s (run %s) of project %s, which completed without a quality check.", run.StageName, run.ID, run.ProjectID)
+		if err := s.StageRunFinished(ctx, run.ID); err != nil {
+			log.Printf("Error evaluating stage run %s: %v", run.ID, err)
+		}
+	}
+
+	unpublished, err := s.stageRuns.ListUnpublishedStageRuns(ctx, time.Now().Add(-settle))
+	if err != nil {
+		return err
+	}
+	for _, run := range unpublished {
+		log.Printf("Publishing outputs of stage %s (run %s) of project %s, which succeeded without publishing them.", run.StageName, run.ID, run.ProjectID)
+		if err := s.republish(ctx, run.ID); err != nil {
+			log.Printf("Error publishing outputs of stage run %s: %v", run.ID, err)
+		}
+	}
+
+	projects, err := s.projects.ListProjectsByStatus(ctx, store.ProjectStatusRunning)
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if err := s.Advance(ctx, project.ID); err != nil {
+			log.Printf("Error resuming project %s: %v", project.ID, err)
+		}
+	}
+	return nil
+}
+
+// RunRecovery calls Recover once and then every interval until ctx is
+// cancelled. Runs completed within the last interval are left to the
+// executor that finished them.
+func (s *Scheduler) RunRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Recover(ctx, interval); err != nil && ctx.Err() == nil {
+			log.Printf("Error recovering orphaned work: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
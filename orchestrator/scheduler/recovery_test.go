@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"workflow-engine/store"
+)
+
+// startDesign starts a project of deliveryWorkflow and finishes its design run
+// with status without handing it to the scheduler, as an executor stopping at
+// that point would.
+func startDesign(t *testing.T, s *Scheduler, mem *memStore, status store.StageRunStatus) (*store.Project, *store.StageRun) {
+	t.Helper()
+	project := mem.addProject(t, deliveryWorkflow, "Work on {{.Stage.Name}}.")
+	if err := s.StartProject(context.Background(), project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+	design := mem.latest(project.ID, "design")
+	mem.finish(t, design.ID, status, `{"design": "layers"}`)
+	return project, design
+}
+
+func TestRecover_EvaluatesRunsCompletedWithoutHandoff(t *testing.T) {
+	ctx := context.Background()
+	evaluator := &scriptedEvaluator{}
+	s, mem, bus, _ := newTestScheduler(evaluator)
+	project, design := startDesign(t, s, mem, store.StageRunStatusCompleted)
+
+	if err := s.Recover(ctx, time.Hour); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if evaluator.calls != 0 || mem.latest(project.ID, "build") != nil {
+		t.Fatal("Expected a run completed within the settle time to be left to its executor")
+	}
+
+	if err := s.Recover(ctx, 0); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	design = mem.latest(project.ID, "design")
+	if evaluator.calls != 1 || !design.QualityCheckedAt.Valid {
+		t.Errorf("Expected the design run to be evaluated once, got %d evaluations", evaluator.calls)
+	}
+	if len(bus.published) != 1 || !design.OutputsPublishedAt.Valid {
+		t.Errorf("Expected the design output to be published, got %+v", bus.published)
+	}
+	if build := mem.latest(project.ID, "build"); build == nil {
+		t.Error("Expected the build stage to be scheduled")
+	}
+}
+
+func TestRecover_RetriesFailedPublication(t *testing.T) {
+	ctx := context.Background()
+	s, mem, bus, _ := newTestScheduler(&scriptedEvaluator{})
+	project, design := startDesign(t, s, mem, store.StageRunStatusCompleted)
+
+	bus.fail = map[string]error{"design": errors.New("connection refused")}
+	if err := s.StageRunFinished(ctx, design.ID); err == nil {
+		t.Fatal("Expected the publication failure to be returned")
+	}
+	design = mem.latest(project.ID, "design")
+	if !design.QualityCheckedAt.Valid || design.OutputsPublishedAt.Valid {
+		t.Fatalf("Expected the run to be checked but unpublished, got %+v", design)
+	}
+	if err := s.Recover(ctx, 0); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if mem.latest(project.ID, "design").OutputsPublishedAt.Valid {
+		t.Fatal("Expected publication to keep failing while the bus does")
+	}
+
+	bus.fail = nil
+	if err := s.Recover(ctx, 0); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if len(bus.published) != 1 || !mem.latest(project.ID, "design").OutputsPublishedAt.Valid {
+		t.Errorf("Expected the design output to be published once, got %+v", bus.published)
+	}
+	if build := mem.latest(project.ID, "build"); build == nil {
+		t.Error("Expected the build stage to be scheduled")
+	}
+}
+
+func TestRecover_AdvancesRunningProjects(t *testing.T) {
+	ctx := context.Background()
+	s, mem, _, _ := newTestScheduler(&scriptedEvaluator{})
+	project, _ := startDesign(t, s, mem, store.StageRunStatusFailed)
+
+	if err := s.Recover(ctx, time.Hour); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusFailed {
+		t.Errorf("Expected the project to fail on its failed stage, got %s", status)
+	}
+}
+
+func TestRunRecovery_RecoversUntilCancelled(t *testing.T) {
+	evaluator := &scriptedEvaluator{}
+	s, mem, _, _ := newTestScheduler(evaluator)
+	project, _ := startDesign(t, s, mem, store.StageRunStatusCompleted)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunRecovery(ctx, 10*time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mem.latest(project.ID, "build") == nil {
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatal("Timed out waiting for the build stage to be scheduled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected RunRecovery to return once cancelled")
+	}
+	if !mem.latest(project.ID, "design").QualityCheckedAt.Valid {
+		t.Error("Expected the design run to be evaluated")
+	}
+}
@@ -0,0 +1,606 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"workflow-engine/contextbus"
+	"workflow-engine/prompt"
+	"workflow-engine/quality"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// Dispatcher hands newly created stage runs to whatever executes them.
+// Dispatch must not block: executors run stages concurrently and report back
+// through Scheduler.StageRunFinished once a run reaches a terminal status.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, run *store.StageRun)
+}
+
+// Evaluator runs the Quality-Analyst over a completed stage run. It returns a
+// nil outcome when the stage's persona has no rubric.
+type Evaluator interface {
+	EvaluateStageRun(ctx context.Context, run *store.StageRun, stage workflow.Stage) (*quality.Outcome, error)
+}
+
+// PromptCompiler compiles persona prompt templates.
+type PromptCompiler interface {
+	Compile(ctx context.Context, name, text string) (*prompt.Template, error)
+}
+
+// Projects is the part of the project store the scheduler uses.
+// *store.ProjectStore implements it.
+type Projects interface {
+	GetProject(ctx context.Context, id uuid.UUID) (*store.Project, error)
+	ListProjectsByStatus(ctx context.Context, status store.ProjectStatus) ([]*store.Project, error)
+	UpdateProjectStatus(ctx context.Context, id uuid.UUID, status store.ProjectStatus, actor, reason string) error
+}
+
+// StageRuns is the part of the stage run store the scheduler uses.
+// *store.StageRunStore implements it.
+type StageRuns interface {
+	CreateStageRun(ctx context.Context, stageRun *store.StageRun) error
+	GetStageRun(ctx context.Context, id uuid.UUID) (*store.StageRun, error)
+	ListStageRunsByProject(ctx context.Context, projectID uuid.UUID) ([]*store.StageRun, error)
+	ListUncheckedStageRuns(ctx context.Context, completedBefore time.Time) ([]*store.StageRun, error)
+	ListUnpublishedStageRuns(ctx context.Context, changedBefore time.Time) ([]*store.StageRun, error)
+	MarkStageRunQualityChecked(ctx context.Context, id uuid.UUID) error
+	MarkStageRunOutputsPublished(ctx context.Context, id uuid.UUID) error
+	UpdateStageRunStatus(ctx context.Context, id uuid.UUID, status store.StageRunStatus, startedAt, completedAt sql.NullTime) error
+	RecordStageRunError(ctx context.Context, id uuid.UUID, class, message string) error
+	RequeueStageRun(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) error
+	ReviewStageRun(ctx context.Context, id uuid.UUID, decision store.StageRunStatus, reviewer, comment string, rerun *store.StageRun) error
+}
+
+// Workflows looks up workflow definitions. *store.WorkflowStore implements it.
+type Workflows interface {
+	GetWorkflow(ctx context.Context, id uuid.UUID) (*store.Workflow, error)
+}
+
+// Personas looks up the current version of a persona by name.
+// *store.PersonaStore implements it.
+type Personas interface {
+	GetCurrentPersonaVersionByName(ctx context.Context, name string) (*store.PersonaVersion, error)
+}
+
+// Actor is recorded in the project history for transitions the scheduler makes.
+const Actor = "scheduler"
+
+// Scheduler walks each project's workflow DAG, creating stage runs as their
+// dependencies complete and moving the project to completed or failed.
+type Scheduler struct {
+	projects   Projects
+	stageRuns  StageRuns
+	workflows  Workflows
+	personas   Personas
+	context    ContextBus
+	prompts    PromptCompiler
+	evaluator  Evaluator
+	dispatcher Dispatcher
+
+	mu    sync.Mutex
+	locks map[uuid.UUID]*sync.Mutex // serializes Advance per project
+}
+
+func New(dbStore *store.Store, contextBus ContextBus, prompts PromptCompiler, evaluator Evaluator, dispatcher Dispatcher) *Scheduler {
+	return &Scheduler{
+		projects:   dbStore.Projects,
+		stageRuns:  dbStore.StageRuns,
+		workflows:  dbStore.Workflows,
+		personas:   dbStore.Personas,
+		context:    contextBus,
+		prompts:    prompts,
+		evaluator:  evaluator,
+		dispatcher: dispatcher,
+		locks:      make(map[uuid.UUID]*sync.Mutex),
+	}
+}
+
+// StartProject moves a created project to running and schedules its root stages.
+func (s *Scheduler) StartProject(ctx context.Context, projectID uuid.UUID) error {
+	project, err := s.projects.GetProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return fmt.Errorf("project %s not found", projectID)
+	}
+	if !project.WorkflowID.Valid {
+		return fmt.Errorf("project %s has no workflow", projectID)
+	}
+	if project.Status == store.ProjectStatusCreated {
+		if err := s.projects.UpdateProjectStatus(ctx, projectID, store.ProjectStatusRunning, Actor, "workflow started"); err != nil {
+			return err
+		}
+	}
+	return s.Advance(ctx, projectID)
+}
+
+// StageRunFinished is called once a stage run reaches a terminal status. A
+// completed run first goes through the Quality-Analyst, unless it already
+// has, and once it passes and needs no review its declared outputs are
+// published to the Context Bus; then the project's downstream stages are
+// scheduled. A run is marked quality checked only after the gate has run, so
+// calling StageRunFinished again after a crash evaluates it then.
+func (s *Scheduler) StageRunFinished(ctx context.Context, stageRunID uuid.UUID) error {
+	run, err := s.stageRuns.GetStageRun(ctx, stageRunID)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return fmt.Errorf("stage run %s not found", stageRunID)
+	}
+
+	lock := s.projectLock(run.ProjectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Re-read the run now that no other caller can be evaluating it.
+	run, err = s.stageRuns.GetStageRun(ctx, stageRunID)
+	if err != nil {
+		return err
+	}
+	if run.Status == store.StageRunStatusCompleted && !run.QualityCheckedAt.Valid {
+		project, stage, err := s.stageOf(ctx, run)
+		if err != nil {
+			return err
+		}
+		rejected, err := s.applyQualityGate(ctx, project, stage, run)
+		if err != nil {
+			// An unavailable analyst should not stall the workflow.
+			log.Printf("Error evaluating stage run %s, letting it through: %v", run.ID, err)
+		}
+		if err := s.stageRuns.MarkStageRunQualityChecked(ctx, run.ID); err != nil {
+			return err
+		}
+		switch {
+		case rejected:
+			// Nothing to publish; a rerun, if any, publishes once it passes.
+		case run.ReviewRequired:
+			log.Printf("Stage %s (run %s) of project %s is awaiting review.", run.StageName, run.ID, run.ProjectID)
+		default:
+			if err := s.publishStageRun(ctx, stage, run); err != nil {
+				return err
+			}
+		}
+	}
+	return s.advance(ctx, run.ProjectID)
+}
+
+// Review is a reviewer's decision on a completed run of a stage that requires
+// review.
+type Review struct {
+	// Decision is StageRunStatusApproved, which lets downstream stages start,
+	// or StageRunStatusRejected, which fails the project unless Rerun is set.
+	Decision store.StageRunStatus
+	Reviewer string
+	Comment  string
+	// Rerun schedules a new attempt of a rejected stage whose input carries
+	// the rejected output and the comment under RevisionKey.
+	Rerun bool
+}
+
+// ReviewStageRun records a review of a run awaiting one, publishes the
+// declared outputs of an approved run to the Context Bus and advances the
+// run's project. If publishing fails the approval stands and Recover
+// publishes the outputs later. Only runs of running projects can be reviewed.
+func (s *Scheduler) ReviewStageRun(ctx context.Context, stageRunID uuid.UUID, review Review) error {
+	if review.Rerun && review.Decision != store.StageRunStatusRejected {
+		return errors.New("only a rejected stage run can be rerun")
+	}
+	run, err := s.stageRuns.GetStageRun(ctx, stageRunID)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return fmt.Errorf("stage run %s: %w", stageRunID, store.ErrStageRunNotFound)
+	}
+
+	lock := s.projectLock(run.ProjectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	project, stage, err := s.stageOf(ctx, run)
+	if err != nil {
+		return err
+	}
+	if project.Status != store.ProjectStatusRunning {
+		return fmt.Errorf("project %s is %s: %w", project.ID, project.Status, store.ErrReviewNotPending)
+	}
+
+	var rerun *store.StageRun
+	if review.Rerun {
+		input, err := RevisionInput(run, review.Reviewer, review.Comment)
+		if err != nil {
+			return err
+		}
+		rerun = &store.StageRun{
+			ProjectID:      run.ProjectID,
+			StageName:      run.StageName,
+			ReviewRequired: stage.RequiresReview,
+			InputContext:   input,
+		}
+		if err := s.prepareStageRun(ctx, project, stage, rerun); err != nil {
+			return err
+		}
+	}
+	if err := s.stageRuns.ReviewStageRun(ctx, run.ID, review.Decision, review.Reviewer, review.Comment, rerun); err != nil {
+		return err
+	}
+	log.Printf("Stage %s (run %s) of project %s was %s by %s.", run.StageName, run.ID, run.ProjectID, review.Decision, review.Reviewer)
+	if review.Decision == store.StageRunStatusApproved {
+		if err := s.publishStageRun(ctx, stage, run); err != nil {
+			return err
+		}
+	}
+	if rerun != nil {
+		log.Printf("Re-running stage %s (run %s) for project %s with the reviewer's feedback.", rerun.StageName, rerun.ID, run.ProjectID)
+		s.dispatcher.Dispatch(ctx, rerun)
+	}
+	return s.advance(ctx, run.ProjectID)
+}
+
+// Advance re-evaluates a running project's DAG: it creates and dispatches a
+// stage run for every stage whose dependencies have succeeded, and completes or
+// fails the project once the outcome is known. It is safe to call repeatedly.
+func (s *Scheduler) Advance(ctx context.Context, projectID uuid.UUID) error {
+	lock := s.projectLock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+	return s.advance(ctx, projectID)
+}
+
+// advance does the work of Advance. The caller must hold the project lock.
+func (s *Scheduler) advance(ctx context.Context, projectID uuid.UUID) error {
+	project, err := s.projects.GetProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		return fmt.Errorf("project %s not found", projectID)
+	}
+	if project.Status != store.ProjectStatusRunning {
+		return nil
+	}
+
+	def, err := s.loadDefinition(ctx, project)
+	if err != nil {
+		return err
+	}
+	runs, err := s.stageRuns.ListStageRunsByProject(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestRuns(runs)
+	plan := PlanProject(def, latest)
+	switch plan.Outcome {
+	case OutcomeCompleted:
+		log.Printf("Project %s completed all %d stages.", projectID, len(def.Stages))
+		s.releaseProjectLock(projectID)
+		return s.projects.UpdateProjectStatus(ctx, projectID, store.ProjectStatusCompleted, Actor,
+			fmt.Sprintf("all %d stages succeeded", len(def.Stages)))
+	case OutcomeFailed:
+		log.Printf("Project %s failed at stage %s.", projectID, plan.FailedStage)
+		s.releaseProjectLock(projectID)
+		return s.projects.UpdateProjectStatus(ctx, projectID, store.ProjectStatusFailed, Actor,
+			fmt.Sprintf("stage %s failed", plan.FailedStage))
+	}
+
+	for _, stage := range plan.Retry {
+		if err := s.retryStageRun(ctx, stage, latest[stage.Name]); err != nil {
+			return err
+		}
+	}
+
+	created := make([]*store.StageRun, 0, len(plan.Ready))
+	for _, stage := range plan.Ready {
+		input, startErr := AssembleInput(stage, latest, s.contextLookup(ctx, projectID))
+		run := &store.StageRun{
+			ProjectID:      projectID,
+			StageName:      stage.Name,
+			ReviewRequired: stage.RequiresReview,
+			InputContext:   input,
+		}
+		if startErr == nil {
+			startErr = s.prepareStageRun(ctx, project, stage, run)
+			if startErr != nil && !cannotStart(startErr) {
+				return startErr
+			}
+		}
+		if err := s.stageRuns.CreateStageRun(ctx, run); err != nil {
+			if errors.Is(err, store.ErrStageRunExists) {
+				// Another replica scheduled the stage first.
+				log.Printf("Stage %s of project %s is already scheduled, skipping.", stage.Name, projectID)
+				continue
+			}
+			return err
+		}
+		if startErr != nil {
+			log.Printf("Stage %s of project %s cannot start: %v", stage.Name, projectID, startErr)
+			if err := s.stageRuns.RecordStageRunError(ctx, run.ID, string(workflow.ErrorClassInternal), startErr.Error()); err != nil {
+				return err
+			}
+			completedAt := sql.NullTime{Time: time.Now(), Valid: true}
+			if err := s.stageRuns.UpdateStageRunStatus(ctx, run.ID, store.StageRunStatusFailed, sql.NullTime{}, completedAt); err != nil {
+				return err
+			}
+			s.releaseProjectLock(projectID)
+			return s.projects.UpdateProjectStatus(ctx, projectID, store.ProjectStatusFailed, Actor,
+				fmt.Sprintf("stage %s cannot start: %v", stage.Name, startErr))
+		}
+		created = append(created, run)
+	}
+	for _, run := range created {
+		log.Printf("Dispatching stage %s (run %s) for project %s.", run.StageName, run.ID, projectID)
+		s.dispatcher.Dispatch(ctx, run)
+	}
+	return nil
+}
+
+// retryStageRun re-queues a failed run for its next attempt after the backoff
+// its stage's retry policy prescribes. Executors polling for due runs pick it
+// up once the backoff has passed. The caller must hold the project lock.
+func (s *Scheduler) retryStageRun(ctx context.Context, stage workflow.Stage, run *store.StageRun) error {
+	delay := stage.Retry.Backoff(run.Attempt, rand.Float64)
+	if err := s.stageRuns.RequeueStageRun(ctx, run.ID, time.Now().Add(delay)); err != nil {
+		return err
+	}
+	log.Printf("Retrying stage %s (run %s) of project %s in %s after attempt %d failed: %s",
+		stage.Name, run.ID, run.ProjectID, delay, run.Attempt, run.LastError.String)
+	return nil
+}
+
+// applyQualityGate evaluates a completed run and, when it scores below the
+// rubric threshold, rejects it and optionally schedules a new attempt. It
+// reports whether the run was rejected. The caller must hold the project lock.
+func (s *Scheduler) applyQualityGate(ctx context.Context, project *store.Project, stage workflow.Stage, run *store.StageRun) (bool, error) {
+	outcome, err := s.evaluator.EvaluateStageRun(ctx, run, stage)
+	if err != nil {
+		return false, err
+	}
+	if outcome == nil || outcome.Passed() {
+		return false, nil
+	}
+
+	log.Printf("Stage run %s scored %.2f, below the %.2f threshold of rubric %q.",
+		run.ID, outcome.Evaluation.OverallScore, outcome.Rubric.Threshold, outcome.Rubric.Name)
+	if err := s.stageRuns.UpdateStageRunStatus(ctx, run.ID, store.StageRunStatusRejected, run.StartedAt, run.CompletedAt); err != nil {
+		return false, err
+	}
+	if outcome.Rubric.OnFailure != quality.FailureActionRerun {
+		return true, nil
+	}
+
+	runs, err := s.stageRuns.ListStageRunsByProject(ctx, run.ProjectID)
+	if err != nil {
+		return true, err
+	}
+	rejected := QualityRejections(runs, run.StageName)
+	if rejected > outcome.Rubric.MaxReruns {
+		log.Printf("Stage %s of project %s exhausted its %d quality reruns.", run.StageName, run.ProjectID, outcome.Rubric.MaxReruns)
+		return true, nil
+	}
+
+	rerun := &store.StageRun{
+		ProjectID:      run.ProjectID,
+		StageName:      run.StageName,
+		ReviewRequired: stage.RequiresReview,
+		InputContext:   run.InputContext,
+	}
+	if err := s.prepareStageRun(ctx, project, stage, rerun); err != nil {
+		return true, err
+	}
+	if err := s.stageRuns.CreateStageRun(ctx, rerun); err != nil {
+		return true, err
+	}
+	log.Printf("Re-running stage %s (run %s, rerun %d of %d) for project %s.", rerun.StageName, rerun.ID, rejected, outcome.Rubric.MaxReruns, run.ProjectID)
+	s.dispatcher.Dispatch(ctx, rerun)
+	return true, nil
+}
+
+// publishStageRun publishes the declared outputs of a run that succeeded and
+// marks the run published. A run left unmarked because publishing failed is
+// published again by Recover; outputs published just before a failure to
+// mark the run are then published again as new versions.
+func (s *Scheduler) publishStageRun(ctx context.Context, stage workflow.Stage, run *store.StageRun) error {
+	if err := s.publishOutputs(ctx, stage, run); err != nil {
+		return fmt.Errorf("failed to publish outputs of stage run %s: %w", run.ID, err)
+	}
+	return s.stageRuns.MarkStageRunOutputsPublished(ctx, run.ID)
+}
+
+// republish publishes the outputs of a run that succeeded without having
+// them published, unless another caller published them first.
+func (s *Scheduler) republish(ctx context.Context, stageRunID uuid.UUID) error {
+	run, err := s.stageRuns.GetStageRun(ctx, stageRunID)
+	if err != nil || run == nil {
+		return err
+	}
+
+	lock := s.projectLock(run.ProjectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	run, err = s.stageRuns.GetStageRun(ctx, stageRunID)
+	if err != nil || run == nil || run.OutputsPublishedAt.Valid {
+		return err
+	}
+	_, stage, err := s.stageOf(ctx, run)
+	if err != nil {
+		return err
+	}
+	return s.publishStageRun(ctx, stage, run)
+}
+
+// publishOutputs publishes the outputs a stage declares, taken from the
+// output of a run that succeeded, to the Context Bus as generic entries
+// attributed to the run. Declared outputs the run did not produce are
+// skipped, and so are values the bus rejects, which are logged.
+func (s *Scheduler) publishOutputs(ctx context.Context, stage workflow.Stage, run *store.StageRun) error {
+	if len(stage.Outputs) == 0 {
+		return nil
+	}
+	output, err := decodeOutput(run)
+	if err != nil {
+		return fmt.Errorf("output of stage run %s: %w", run.ID, err)
+	}
+	stageRunID := uuid.NullUUID{UUID: run.ID, Valid: true}
+	for _, key := range stage.Outputs {
+		value, ok := output[key]
+		if !ok {
+			continue
+		}
+		entry, err := s.context.Publish(ctx, run.ProjectID, key, contextbus.KindGeneric, value, stageRunID)
+		if errors.Is(err, contextbus.ErrInvalidEntry) {
+			log.Printf("Not publishing output %s of stage run %s to the Context Bus: %v", key, run.ID, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Published %s v%d to the Context Bus for project %s.", key, entry.Version, run.ProjectID)
+	}
+	return nil
+}
+
+// StageFor returns the workflow stage a run executes.
+func (s *Scheduler) StageFor(ctx context.Context, run *store.StageRun) (workflow.Stage, error) {
+	_, stage, err := s.stageOf(ctx, run)
+	return stage, err
+}
+
+func (s *Scheduler) stageOf(ctx context.Context, run *store.StageRun) (*store.Project, workflow.Stage, error) {
+	project, err := s.projects.GetProject(ctx, run.ProjectID)
+	if err != nil {
+		return nil, workflow.Stage{}, err
+	}
+	if project == nil {
+		return nil, workflow.Stage{}, fmt.Errorf("project %s not found", run.ProjectID)
+	}
+	def, err := s.loadDefinition(ctx, project)
+	if err != nil {
+		return nil, workflow.Stage{}, err
+	}
+	stage, ok := def.Stage(run.StageName)
+	if !ok {
+		return nil, workflow.Stage{}, fmt.Errorf("stage %s is not part of workflow %s", run.StageName, def.Name)
+	}
+	return project, stage, nil
+}
+
+// prepareStageRun pins a new run to the current version of the stage's
+// persona and renders that version's prompt against the run's input context.
+// Errors for which cannotStart reports true mean the stage cannot run with
+// its current inputs; any other error is a failure to look something up.
+func (s *Scheduler) prepareStageRun(ctx context.Context, project *store.Project, stage workflow.Stage, run *store.StageRun) error {
+	version, err := s.personas.GetCurrentPersonaVersionByName(ctx, stage.Persona)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return fmt.Errorf("persona %s of stage %s not found", stage.Persona, stage.Name)
+	}
+	run.PersonaVersionID = uuid.NullUUID{UUID: version.ID, Valid: true}
+
+	tmpl, err := s.prompts.Compile(ctx, stage.Persona, version.PromptTemplate)
+	if err != nil {
+		return err
+	}
+	input, err := prompt.DecodeValues(run.InputContext)
+	if err != nil {
+		return err
+	}
+	data := prompt.Data{
+		Input:   input,
+		Context: make(map[string]interface{}),
+		Project: prompt.Project{ID: project.ID.String(), Name: project.Name, Description: project.Description.String},
+		Stage:   prompt.Stage{Name: stage.Name, Persona: stage.Persona},
+	}
+	for _, key := range tmpl.ContextKeys() {
+		entry, err := s.context.Latest(ctx, project.ID, key)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(entry.Value, &value); err != nil {
+			return fmt.Errorf("context entry %s of project %s is not valid JSON: %w", key, project.ID, err)
+		}
+		data.Context[key] = value
+	}
+
+	rendered, err := tmpl.Render(data)
+	if err != nil {
+		return err
+	}
+	run.Prompt = sql.NullString{String: rendered, Valid: true}
+	return nil
+}
+
+// cannotStart reports whether err is a problem with the persona's prompt
+// template or the data it needs, rather than an infrastructure failure.
+func cannotStart(err error) bool {
+	var templateErr *prompt.TemplateError
+	var missingErr *prompt.MissingVariablesError
+	return errors.As(err, &templateErr) || errors.As(err, &missingErr)
+}
+
+func (s *Scheduler) contextLookup(ctx context.Context, projectID uuid.UUID) func(string) (json.RawMessage, bool, error) {
+	return func(key string) (json.RawMessage, bool, error) {
+		entry, err := s.context.Latest(ctx, projectID, key)
+		if err != nil || entry == nil {
+			return nil, false, err
+		}
+		return entry.Value, true, nil
+	}
+}
+
+func (s *Scheduler) loadDefinition(ctx context.Context, project *store.Project) (*workflow.Definition, error) {
+	if !project.WorkflowID.Valid {
+		return nil, fmt.Errorf("project %s has no workflow", project.ID)
+	}
+	wf, err := s.workflows.GetWorkflow(ctx, project.WorkflowID.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if wf == nil {
+		return nil, fmt.Errorf("workflow %s of project %s not found", project.WorkflowID.UUID, project.ID)
+	}
+	def, err := workflow.Parse(wf.Definition, workflow.FormatJSON)
+	if err != nil {
+		return nil, fmt.Errorf("workflow %s: %w", wf.Name, err)
+	}
+	return def, nil
+}
+
+func (s *Scheduler) projectLock(projectID uuid.UUID) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.locks[projectID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[projectID] = lock
+	}
+	return lock
+}
+
+// releaseProjectLock forgets the lock of a finished project. The caller must
+// hold it.
+func (s *Scheduler) releaseProjectLock(projectID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, projectID)
+}
@@ -0,0 +1,314 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"workflow-engine/contextbus"
+	"workflow-engine/prompt"
+	"workflow-engine/quality"
+	"workflow-engine/store"
+	"workflow-engine/workflow"
+
+	"github.com/google/uuid"
+)
+
+// recordingBus is a ContextBus that records what is published to it.
+type recordingBus struct {
+	published []*store.ContextEntry
+	// fail makes publishing key fail with the mapped error.
+	fail map[string]error
+}
+
+func (b *recordingBus) Latest(ctx context.Context, projectID uuid.UUID, key string) (*store.ContextEntry, error) {
+	return nil, nil
+}
+
+func (b *recordingBus) Publish(ctx context.Context, projectID uuid.UUID, key string, kind contextbus.Kind, value interface{}, stageRunID uuid.NullUUID) (*store.ContextEntry, error) {
+	if err := b.fail[key]; err != nil {
+		return nil, err
+	}
+	entry := &store.ContextEntry{
+		ProjectID:  projectID,
+		Key:        key,
+		Version:    len(b.published) + 1,
+		Kind:       string(kind),
+		Value:      value.(json.RawMessage),
+		StageRunID: stageRunID,
+	}
+	b.published = append(b.published, entry)
+	return entry, nil
+}
+
+func TestPublishOutputs(t *testing.T) {
+	bus := &recordingBus{fail: map[string]error{
+		"bad key": fmt.Errorf("%w: key %q is invalid", contextbus.ErrInvalidEntry, "bad key"),
+	}}
+	s := &Scheduler{context: bus}
+	stage := workflow.Stage{Name: "architecture", Outputs: []string{"tech_stack", "bad key", "risks"}}
+	run := &store.StageRun{
+		ID:            uuid.New(),
+		ProjectID:     uuid.New(),
+		StageName:     "architecture",
+		Status:        store.StageRunStatusCompleted,
+		OutputContext: json.RawMessage(`{"tech_stack": {"languages": ["go"]}, "bad key": 1, "notes": "not declared"}`),
+	}
+
+	if err := s.publishOutputs(context.Background(), stage, run); err != nil {
+		t.Fatalf("publishOutputs failed: %v", err)
+	}
+	if len(bus.published) != 1 {
+		t.Fatalf("Expected only the declared, valid output to be published, got %d entries", len(bus.published))
+	}
+	entry := bus.published[0]
+	if entry.Key != "tech_stack" || entry.ProjectID != run.ProjectID || entry.Kind != string(contextbus.KindGeneric) {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if !entry.StageRunID.Valid || entry.StageRunID.UUID != run.ID {
+		t.Errorf("Expected the entry to be attributed to run %s, got %v", run.ID, entry.StageRunID)
+	}
+	assertJSON(t, entry.Value, `{"languages": ["go"]}`)
+
+	bus.fail["tech_stack"] = errors.New("connection refused")
+	if err := s.publishOutputs(context.Background(), stage, run); err == nil {
+		t.Error("Expected a store failure to be returned")
+	}
+}
+
+func TestPublishOutputs_NothingDeclared(t *testing.T) {
+	bus := &recordingBus{}
+	s := &Scheduler{context: bus}
+	run := &store.StageRun{ID: uuid.New(), OutputContext: json.RawMessage(`{"plan": "ship it"}`)}
+
+	if err := s.publishOutputs(context.Background(), workflow.Stage{Name: "plan"}, run); err != nil {
+		t.Fatalf("publishOutputs failed: %v", err)
+	}
+	if len(bus.published) != 0 {
+		t.Errorf("Expected nothing to be published, got %d entries", len(bus.published))
+	}
+}
+
+const deliveryWorkflow = `{"name": "delivery", "stages": [
+	{"name": "design", "persona": "architect", "outputs": ["design"]},
+	{"name": "build", "persona": "developer", "depends_on": ["design"], "outputs": ["code"],
+	 "retry": {"max_attempts": 2}}
+]}`
+
+func TestStageRunFinished_AdvancesProject(t *testing.T) {
+	ctx := context.Background()
+	s, mem, bus, dispatcher := newTestScheduler(&scriptedEvaluator{})
+	project := mem.addProject(t, deliveryWorkflow, "Work on {{.Stage.Name}}.")
+
+	if err := s.StartProject(ctx, project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+	design := mem.latest(project.ID, "design")
+	if design == nil || len(dispatcher.dispatched) != 1 || dispatcher.dispatched[0].ID != design.ID {
+		t.Fatalf("Expected the design stage to be scheduled and dispatched, got %+v", dispatcher.dispatched)
+	}
+	if mem.latest(project.ID, "build") != nil {
+		t.Fatal("Expected the build stage to wait for design")
+	}
+
+	mem.finish(t, design.ID, store.StageRunStatusCompleted, `{"design": "layers"}`)
+	if err := s.StageRunFinished(ctx, design.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	design = mem.latest(project.ID, "design")
+	if !design.QualityCheckedAt.Valid || !design.OutputsPublishedAt.Valid {
+		t.Errorf("Expected the design run to be quality checked and published, got %+v", design)
+	}
+	if len(bus.published) != 1 || bus.published[0].Key != "design" {
+		t.Fatalf("Expected the design output to be published, got %+v", bus.published)
+	}
+	build := mem.latest(project.ID, "build")
+	if build == nil || build.Status != store.StageRunStatusPending {
+		t.Fatalf("Expected a pending build run, got %+v", build)
+	}
+	if build.Prompt.String != "Work on build." || !build.PersonaVersionID.Valid {
+		t.Errorf("Expected the build run to be pinned and rendered, got %+v", build)
+	}
+	assertJSON(t, build.InputContext, `{"design": "layers"}`)
+	if len(dispatcher.dispatched) != 2 || dispatcher.dispatched[1].ID != build.ID {
+		t.Errorf("Expected the build run to be dispatched, got %d dispatches", len(dispatcher.dispatched))
+	}
+
+	mem.finish(t, build.ID, store.StageRunStatusCompleted, `{"code": "main.go"}`)
+	if err := s.StageRunFinished(ctx, build.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusCompleted {
+		t.Errorf("Expected the project to be completed, got %s", status)
+	}
+}
+
+func TestStageRunFinished_EvaluatesOnce(t *testing.T) {
+	ctx := context.Background()
+	evaluator := &scriptedEvaluator{}
+	s, mem, bus, _ := newTestScheduler(evaluator)
+	project := mem.addProject(t, deliveryWorkflow, "Work on {{.Stage.Name}}.")
+	if err := s.StartProject(ctx, project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+	design := mem.latest(project.ID, "design")
+	mem.finish(t, design.ID, store.StageRunStatusCompleted, `{"design": "layers"}`)
+
+	for i := 0; i < 2; i++ {
+		if err := s.StageRunFinished(ctx, design.ID); err != nil {
+			t.Fatalf("StageRunFinished failed: %v", err)
+		}
+	}
+	if evaluator.calls != 1 || len(bus.published) != 1 {
+		t.Errorf("Expected one evaluation and one publication, got %d and %d", evaluator.calls, len(bus.published))
+	}
+	if runs, _ := mem.ListStageRunsByProject(ctx, project.ID); len(runs) != 2 {
+		t.Errorf("Expected the build stage to be scheduled once, got %d runs", len(runs))
+	}
+}
+
+func TestStageRunFinished_RetriesThenFailsProject(t *testing.T) {
+	ctx := context.Background()
+	s, mem, _, dispatcher := newTestScheduler(&scriptedEvaluator{})
+	project := mem.addProject(t, deliveryWorkflow, "Work on {{.Stage.Name}}.")
+	if err := s.StartProject(ctx, project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+	design := mem.latest(project.ID, "design")
+	mem.finish(t, design.ID, store.StageRunStatusCompleted, `{"design": "layers"}`)
+	if err := s.StageRunFinished(ctx, design.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+
+	build := mem.latest(project.ID, "build")
+	mem.finish(t, build.ID, store.StageRunStatusFailed, "")
+	if err := s.StageRunFinished(ctx, build.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	build = mem.latest(project.ID, "build")
+	if build.Status != store.StageRunStatusPending || build.Attempt != 2 || !build.NextAttemptAt.Valid {
+		t.Fatalf("Expected the build run to be re-queued for a second attempt, got %s attempt %d", build.Status, build.Attempt)
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusRunning {
+		t.Errorf("Expected the project to keep running while the stage is retried, got %s", status)
+	}
+	if len(dispatcher.dispatched) != 2 {
+		t.Errorf("Expected the re-queued run to be left to polling executors, got %d dispatches", len(dispatcher.dispatched))
+	}
+
+	mem.finish(t, build.ID, store.StageRunStatusFailed, "")
+	if err := s.StageRunFinished(ctx, build.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusFailed {
+		t.Errorf("Expected the project to fail once the retries are used up, got %s", status)
+	}
+}
+
+const reviewedWorkflow = `{"name": "reviewed", "stages": [
+	{"name": "design", "persona": "architect", "outputs": ["design"], "requires_review": true}
+]}`
+
+// startReviewedDesign starts a project of reviewedWorkflow and completes its
+// design run, which then awaits review.
+func startReviewedDesign(t *testing.T, s *Scheduler, mem *memStore) (*store.Project, *store.StageRun) {
+	t.Helper()
+	ctx := context.Background()
+	project := mem.addProject(t, reviewedWorkflow, "Design it.")
+	if err := s.StartProject(ctx, project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+	design := mem.latest(project.ID, "design")
+	mem.finish(t, design.ID, store.StageRunStatusCompleted, `{"design": "layers"}`)
+	if err := s.StageRunFinished(ctx, design.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	return project, mem.latest(project.ID, "design")
+}
+
+func TestReviewStageRun_DispatchesRerunWithFeedback(t *testing.T) {
+	ctx := context.Background()
+	s, mem, bus, dispatcher := newTestScheduler(&scriptedEvaluator{})
+	project, design := startReviewedDesign(t, s, mem)
+	if len(bus.published) != 0 {
+		t.Fatalf("Expected nothing to be published before the review, got %+v", bus.published)
+	}
+
+	review := Review{Decision: store.StageRunStatusRejected, Reviewer: "ana", Comment: "Add a cache.", Rerun: true}
+	if err := s.ReviewStageRun(ctx, design.ID, review); err != nil {
+		t.Fatalf("ReviewStageRun failed: %v", err)
+	}
+	rerun := mem.latest(project.ID, "design")
+	if rerun.ID == design.ID || rerun.Status != store.StageRunStatusPending || rerun.PreviousRunID.UUID != design.ID {
+		t.Fatalf("Expected a pending rerun linked to %s, got %+v", design.ID, rerun)
+	}
+	assertJSON(t, rerun.InputContext, `{"revision": {"previous_output": {"design": "layers"}, "reviewer": "ana", "feedback": "Add a cache."}}`)
+	if !rerun.ReviewRequired || rerun.Prompt.String != "Design it." {
+		t.Errorf("Expected the rerun to be reviewed and rendered like the first run, got %+v", rerun)
+	}
+	if len(dispatcher.dispatched) != 2 || dispatcher.dispatched[1].ID != rerun.ID {
+		t.Errorf("Expected the rerun to be dispatched, got %d dispatches", len(dispatcher.dispatched))
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusRunning {
+		t.Errorf("Expected the project to keep running, got %s", status)
+	}
+}
+
+func TestReviewStageRun_RerunPromptMustRender(t *testing.T) {
+	ctx := context.Background()
+	s, mem, _, dispatcher := newTestScheduler(&scriptedEvaluator{})
+	project, design := startReviewedDesign(t, s, mem)
+	mem.personas["architect"].PromptTemplate = "Design {{.Input.requirements}}."
+
+	review := Review{Decision: store.StageRunStatusRejected, Reviewer: "ana", Comment: "Add a cache.", Rerun: true}
+	err := s.ReviewStageRun(ctx, design.ID, review)
+	var missing *prompt.MissingVariablesError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Expected a MissingVariablesError, got %v", err)
+	}
+	if run := mem.latest(project.ID, "design"); run.ID != design.ID || run.Status != store.StageRunStatusCompleted {
+		t.Errorf("Expected the review not to be recorded, got %+v", run)
+	}
+	if len(dispatcher.dispatched) != 1 {
+		t.Errorf("Expected no rerun to be dispatched, got %d dispatches", len(dispatcher.dispatched))
+	}
+}
+
+func TestQualityGate_RerunsUntilBudgetIsUsedUp(t *testing.T) {
+	ctx := context.Background()
+	evaluator := &scriptedEvaluator{outcomes: []*quality.Outcome{failingOutcome(1), failingOutcome(1)}}
+	s, mem, bus, dispatcher := newTestScheduler(evaluator)
+	project := mem.addProject(t, deliveryWorkflow, "Work on {{.Stage.Name}}.")
+	if err := s.StartProject(ctx, project.ID); err != nil {
+		t.Fatalf("StartProject failed: %v", err)
+	}
+
+	design := mem.latest(project.ID, "design")
+	mem.finish(t, design.ID, store.StageRunStatusCompleted, `{"design": "thin"}`)
+	if err := s.StageRunFinished(ctx, design.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	rerun := mem.latest(project.ID, "design")
+	if rerun.ID == design.ID || rerun.Status != store.StageRunStatusPending {
+		t.Fatalf("Expected a rerun of the rejected design run, got %+v", rerun)
+	}
+	if len(dispatcher.dispatched) != 2 || dispatcher.dispatched[1].ID != rerun.ID {
+		t.Errorf("Expected the rerun to be dispatched, got %d dispatches", len(dispatcher.dispatched))
+	}
+	if len(bus.published) != 0 {
+		t.Errorf("Expected a rejected run's outputs not to be published, got %+v", bus.published)
+	}
+
+	mem.finish(t, rerun.ID, store.StageRunStatusCompleted, `{"design": "still thin"}`)
+	if err := s.StageRunFinished(ctx, rerun.ID); err != nil {
+		t.Fatalf("StageRunFinished failed: %v", err)
+	}
+	if latest := mem.latest(project.ID, "design"); latest.ID != rerun.ID || latest.Status != store.StageRunStatusRejected {
+		t.Errorf("Expected no rerun once the budget is used up, got %+v", latest)
+	}
+	if status := mem.projectStatus(project.ID); status != store.ProjectStatusFailed {
+		t.Errorf("Expected the project to fail, got %s", status)
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ContextEntry is one immutable version of a Context Bus key within a project.
+type ContextEntry struct {
+	ProjectID  uuid.UUID       `json:"project_id"`
+	Key        string          `json:"key"`
+	Version    int             `json:"version"`
+	Kind       string          `json:"kind"`
+	Value      json.RawMessage `json:"value"` // JSONB type
+	StageRunID uuid.NullUUID   `json:"stage_run_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type ContextEntryStore struct {
+	db *sql.DB
+}
+
+func NewContextEntryStore(db *sql.DB) *ContextEntryStore {
+	return &ContextEntryStore{db: db}
+}
+
+// maxVersionAttempts bounds retries when concurrent writers race for the
+// same version number.
+const maxVersionAttempts = 5
+
+// AppendContextEntry stores entry as the next version of its key. The assigned
+// Version and CreatedAt are written back to entry.
+func (s *ContextEntryStore) AppendContextEntry(ctx context.Context, entry *ContextEntry) error {
+	query := `
+		INSERT INTO context_entries (project_id, key, version, kind, value, stage_run_id, created_at)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+		FROM context_entries
+		WHERE project_id = $1 AND key = $2
+		RETURNING version
+	`
+	var err error
+	for attempt := 0; attempt < maxVersionAttempts; attempt++ {
+		entry.CreatedAt = time.Now()
+		err = s.db.QueryRowContext(ctx, query,
+			entry.ProjectID,
+			entry.Key,
+			entry.Kind,
+			entry.Value,
+			entry.StageRunID,
+			entry.CreatedAt,
+		).Scan(&entry.Version)
+		if !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append context entry: %w", err)
+	}
+	return nil
+}
+
+func (s *ContextEntryStore) GetContextEntry(ctx context.Context, projectID uuid.UUID, key string, version int) (*ContextEntry, error) {
+	query := `
+		SELECT ` + contextEntryColumns + `
+		FROM context_entries
+		WHERE project_id = $1 AND key = $2 AND version = $3
+	`
+	return s.getContextEntry(ctx, query, projectID, key, version)
+}
+
+func (s *ContextEntryStore) GetLatestContextEntry(ctx context.Context, projectID uuid.UUID, key string) (*ContextEntry, error) {
+	query := `
+		SELECT ` + contextEntryColumns + `
+		FROM context_entries
+		WHERE project_id = $1 AND key = $2
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	return s.getContextEntry(ctx, query, projectID, key)
+}
+
+// ListLatestContextEntries returns the latest version of every key in a
+// project, ordered by key.
+func (s *ContextEntryStore) ListLatestContextEntries(ctx context.Context, projectID uuid.UUID) ([]*ContextEntry, error) {
+	query := `
+		SELECT DISTINCT ON (key) ` + contextEntryColumns + `
+		FROM context_entries
+		WHERE project_id = $1
+		ORDER BY key, version DESC
+	`
+	return s.queryContextEntries(ctx, query, projectID)
+}
+
+// ListContextEntryVersions returns every version of a key, oldest first.
+func (s *ContextEntryStore) ListContextEntryVersions(ctx context.Context, projectID uuid.UUID, key string) ([]*ContextEntry, error) {
+	query := `
+		SELECT ` + contextEntryColumns + `
+		FROM context_entries
+		WHERE project_id = $1 AND key = $2
+		ORDER BY version
+	`
+	return s.queryContextEntries(ctx, query, projectID, key)
+}
+
+func (s *ContextEntryStore) getContextEntry(ctx context.Context, query string, args ...interface{}) (*ContextEntry, error) {
+	entry, err := scanContextEntry(s.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Context entry not found
+		}
+		return nil, fmt.Errorf("failed to get context entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (s *ContextEntryStore) queryContextEntries(ctx context.Context, query string, args ...interface{}) ([]*ContextEntry, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list context entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*ContextEntry
+	for rows.Next() {
+		entry, err := scanContextEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan context entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list context entries: %w", err)
+	}
+	return entries, nil
+}
+
+const contextEntryColumns = `project_id, key, version, kind, value, stage_run_id, created_at`
+
+func scanContextEntry(row rowScanner) (*ContextEntry, error) {
+	entry := &ContextEntry{}
+	err := row.Scan(
+		&entry.ProjectID,
+		&entry.Key,
+		&entry.Version,
+		&entry.Kind,
+		&entry.Value,
+		&entry.StageRunID,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
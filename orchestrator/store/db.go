@@ -12,10 +12,18 @@ import (
 )
 
 type Store struct {
-	db        *sql.DB
-	Projects  *ProjectStore
-	Personas  *PersonaStore
-	StageRuns *StageRunStore
+	db              *sql.DB
+	Projects        *ProjectStore
+	Personas        *PersonaStore
+	StageRuns       *StageRunStore
+	Workflows       *WorkflowStore
+	ContextEntries  *ContextEntryStore
+	Rubrics         *RubricStore
+	Evaluations     *EvaluationStore
+	PromptDrafts    *PromptDraftStore
+	PromptPartials  *PromptPartialStore
+	Outbox          *OutboxStore
+	ProcessedEvents *ProcessedEventStore
 }
 
 func NewStore(cfg *config.Config) (*Store, error) {
@@ -36,11 +44,20 @@ func NewStore(cfg *config.Config) (*Store, error) {
 
 	log.Println("Successfully connected to PostgreSQL database!")
 
+	personas := NewPersonaStore(db)
 	return &Store{
-		db:        db,
-		Projects:  NewProjectStore(db),
-		Personas:  NewPersonaStore(db),
-		StageRuns: NewStageRunStore(db),
+		db:              db,
+		Projects:        NewProjectStore(db),
+		Personas:        personas,
+		StageRuns:       NewStageRunStore(db),
+		Workflows:       NewWorkflowStore(db),
+		ContextEntries:  NewContextEntryStore(db),
+		Rubrics:         NewRubricStore(db),
+		Evaluations:     NewEvaluationStore(db),
+		PromptDrafts:    NewPromptDraftStore(db, personas),
+		PromptPartials:  NewPromptPartialStore(db),
+		Outbox:          NewOutboxStore(db),
+		ProcessedEvents: NewProcessedEventStore(db),
 	}, nil
 }
 
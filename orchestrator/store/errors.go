@@ -0,0 +1,46 @@
+package store
+
+import "errors"
+
+var (
+	// ErrDraftNotPending is returned when deciding on a prompt draft that was
+	// already accepted or rejected.
+	ErrDraftNotPending = errors.New("prompt draft is not pending")
+	// ErrDraftOutdated is returned when accepting a prompt draft whose persona
+	// prompt changed after the draft was proposed.
+	ErrDraftOutdated = errors.New("persona prompt changed since the draft was proposed")
+	// ErrPersonaNotFound is returned when changing a persona that does not exist.
+	ErrPersonaNotFound = errors.New("persona not found")
+	// ErrIllegalTransition matches every *IllegalTransitionError and
+	// *IllegalProjectTransitionError.
+	ErrIllegalTransition = errors.New("illegal status transition")
+	// ErrProjectExists is returned when creating a project whose ID is taken.
+	ErrProjectExists = errors.New("project already exists")
+	// ErrStageRunExists is returned when creating a stage run for a stage
+	// that already has a pending or running run in the project.
+	ErrStageRunExists = errors.New("stage already has an active run")
+	// ErrProjectNotFound is returned when changing a project that does not exist.
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrStageRunNotFound is returned when changing a stage run that does not exist.
+	ErrStageRunNotFound = errors.New("stage run not found")
+	// ErrReviewNotPending is returned when reviewing a stage run that is not
+	// awaiting review.
+	ErrReviewNotPending = errors.New("stage run is not awaiting review")
+	// ErrLeaseLost is returned when renewing or finishing a stage run whose
+	// lease expired or was taken over by another orchestrator.
+	ErrLeaseLost = errors.New("stage run lease lost")
+	// ErrInvalidPersona is returned when a registered PersonaValidator rejects
+	// a persona.
+	ErrInvalidPersona = errors.New("invalid persona")
+	// ErrPersonaConflict is returned when updating a persona that was changed
+	// since it was read.
+	ErrPersonaConflict = errors.New("persona was modified concurrently")
+	// ErrPersonaExists is returned when a persona name is already taken.
+	ErrPersonaExists = errors.New("persona name already exists")
+	// ErrPersonaInUse is returned when deleting or renaming a persona that
+	// active workflows still reference.
+	ErrPersonaInUse = errors.New("persona is referenced by active workflows")
+	// ErrPersonaVersionNotFound is returned when rolling back to a version
+	// the persona never had.
+	ErrPersonaVersionNotFound = errors.New("persona version not found")
+)
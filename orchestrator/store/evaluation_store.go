@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type EvaluationVerdict string
+
+const (
+	EvaluationVerdictPass EvaluationVerdict = "pass"
+	EvaluationVerdictFail EvaluationVerdict = "fail"
+)
+
+// Evaluation is the Quality-Analyst's assessment of one stage run.
+type Evaluation struct {
+	ID           uuid.UUID         `json:"id"`
+	StageRunID   uuid.UUID         `json:"stage_run_id"`
+	RubricID     uuid.NullUUID     `json:"rubric_id"`
+	Scores       json.RawMessage   `json:"scores"` // JSONB type
+	OverallScore float64           `json:"overall_score"`
+	Verdict      EvaluationVerdict `json:"verdict"`
+	Comments     sql.NullString    `json:"comments"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+type EvaluationStore struct {
+	db *sql.DB
+}
+
+func NewEvaluationStore(db *sql.DB) *EvaluationStore {
+	return &EvaluationStore{db: db}
+}
+
+func (s *EvaluationStore) CreateEvaluation(ctx context.Context, evaluation *Evaluation) error {
+	evaluation.ID = uuid.New()
+	evaluation.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO stage_run_evaluations (evaluation_id, stage_run_id, rubric_id, scores, overall_score, verdict, comments, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		evaluation.ID,
+		evaluation.StageRunID,
+		evaluation.RubricID,
+		evaluation.Scores,
+		evaluation.OverallScore,
+		evaluation.Verdict,
+		evaluation.Comments,
+		evaluation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create evaluation: %w", err)
+	}
+	return nil
+}
+
+// ListEvaluationsByStageRun returns a stage run's evaluations, oldest first.
+func (s *EvaluationStore) ListEvaluationsByStageRun(ctx context.Context, stageRunID uuid.UUID) ([]*Evaluation, error) {
+	query := `
+		SELECT ` + evaluationColumns + `
+		FROM stage_run_evaluations
+		WHERE stage_run_id = $1
+		ORDER BY created_at
+	`
+	return s.queryEvaluations(ctx, query, stageRunID)
+}
+
+// ListRecentEvaluationsByPersona returns up to limit of the newest
+// evaluations scored against the persona's rubric, newest first.
+func (s *EvaluationStore) ListRecentEvaluationsByPersona(ctx context.Context, personaID uuid.UUID, limit int) ([]*Evaluation, error) {
+	query := `
+		SELECT e.evaluation_id, e.stage_run_id, e.rubric_id, e.scores, e.overall_score, e.verdict, e.comments, e.created_at
+		FROM stage_run_evaluations e
+		JOIN rubrics r ON r.rubric_id = e.rubric_id
+		WHERE r.persona_id = $1
+		ORDER BY e.created_at DESC
+		LIMIT $2
+	`
+	return s.queryEvaluations(ctx, query, personaID, limit)
+}
+
+func (s *EvaluationStore) queryEvaluations(ctx context.Context, query string, args ...interface{}) ([]*Evaluation, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list evaluations: %w", err)
+	}
+	defer rows.Close()
+
+	var evaluations []*Evaluation
+	for rows.Next() {
+		evaluation := &Evaluation{}
+		err := rows.Scan(
+			&evaluation.ID,
+			&evaluation.StageRunID,
+			&evaluation.RubricID,
+			&evaluation.Scores,
+			&evaluation.OverallScore,
+			&evaluation.Verdict,
+			&evaluation.Comments,
+			&evaluation.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan evaluation: %w", err)
+		}
+		evaluations = append(evaluations, evaluation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list evaluations: %w", err)
+	}
+	return evaluations, nil
+}
+
+const evaluationColumns = `evaluation_id, stage_run_id, rubric_id, scores, overall_score, verdict, comments, created_at`
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"workflow-engine/events"
+
+	"github.com/google/uuid"
+)
+
+// OutboxMessage is an event waiting in the outbox to be published.
+type OutboxMessage struct {
+	ID          int64           `json:"id"`
+	EventID     uuid.UUID       `json:"event_id"`
+	Stream      string          `json:"stream"`
+	EventType   string          `json:"event_type"`
+	Envelope    json.RawMessage `json:"envelope"` // JSONB type
+	Attempts    int             `json:"attempts"`
+	LastError   sql.NullString  `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeliveredAt sql.NullTime    `json:"delivered_at"`
+}
+
+// OutboxStore hands outbox messages to the relay that publishes them.
+type OutboxStore struct {
+	db *sql.DB
+}
+
+func NewOutboxStore(db *sql.DB) *OutboxStore {
+	return &OutboxStore{db: db}
+}
+
+// outboxRelayLock is the key of the transaction-scoped advisory lock a relay
+// holds while it publishes, so only one replica relays at a time.
+const outboxRelayLock = 7_402_861_155
+
+// RelayOutbox passes up to limit undelivered messages, oldest first, to
+// publish and marks each one delivered once publish succeeds. It stops at the
+// first failure, recording it on the message, so events from one stream are
+// never published out of order. Relays on other replicas wait their turn:
+// while one holds the relay lock, RelayOutbox returns 0 without publishing.
+// It returns how many messages were delivered.
+//
+// Delivery is at least once: a message published just before the marking
+// fails to commit is published again, so consumers must tolerate duplicate
+// event IDs.
+func (s *OutboxStore) RelayOutbox(ctx context.Context, limit int, publish func(ctx context.Context, msg *OutboxMessage) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("failed to take outbox relay lock: %w", err)
+	}
+	if !locked {
+		return 0, nil // Another relay is publishing
+	}
+
+	query := `
+		SELECT outbox_id, event_id, stream, event_type, envelope, attempts, last_error, created_at, delivered_at
+		FROM outbox
+		WHERE delivered_at IS NULL
+		ORDER BY outbox_id
+		LIMIT $1
+	`
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list outbox messages: %w", err)
+	}
+	var messages []*OutboxMessage
+	for rows.Next() {
+		msg := &OutboxMessage{}
+		err := rows.Scan(
+			&msg.ID,
+			&msg.EventID,
+			&msg.Stream,
+			&msg.EventType,
+			&msg.Envelope,
+			&msg.Attempts,
+			&msg.LastError,
+			&msg.CreatedAt,
+			&msg.DeliveredAt,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list outbox messages: %w", err)
+	}
+
+	delivered := 0
+	var publishErr error
+	for _, msg := range messages {
+		if publishErr = publish(ctx, msg); publishErr != nil {
+			_, err := tx.ExecContext(ctx,
+				`UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE outbox_id = $2`,
+				publishErr.Error(), msg.ID)
+			if err != nil {
+				return delivered, fmt.Errorf("failed to record outbox delivery failure: %w", err)
+			}
+			break
+		}
+		_, err := tx.ExecContext(ctx,
+			`UPDATE outbox SET attempts = attempts + 1, delivered_at = $1 WHERE outbox_id = $2`,
+			time.Now(), msg.ID)
+		if err != nil {
+			return delivered, fmt.Errorf("failed to mark outbox message delivered: %w", err)
+		}
+		delivered++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox delivery: %w", err)
+	}
+	if publishErr != nil {
+		return delivered, fmt.Errorf("failed to publish outbox message: %w", publishErr)
+	}
+	return delivered, nil
+}
+
+// PruneOutbox deletes messages delivered before cutoff and returns how many
+// were removed. Undelivered messages are kept however old they are.
+func (s *OutboxStore) PruneOutbox(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE delivered_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+	return pruned, nil
+}
+
+// enqueueEvent writes payload to the outbox as part of tx, to be published to
+// stream once tx commits.
+func enqueueEvent(ctx context.Context, tx *sql.Tx, stream string, payload events.Payload) error {
+	env, err := events.NewEnvelope(payload)
+	if err != nil {
+		return err
+	}
+	data, err := env.Encode()
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO outbox (event_id, stream, event_type, envelope, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = tx.ExecContext(ctx, query, env.ID, stream, env.Type, data, env.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", env.Type, err)
+	}
+	return nil
+}
+
+// enqueueProjectEvent writes a project_status_changed event for a recorded
+// transition to the outbox as part of tx.
+func enqueueProjectEvent(ctx context.Context, tx *sql.Tx, event *ProjectEvent) error {
+	return enqueueEvent(ctx, tx, events.ProjectStatusStream, &events.ProjectStatusChanged{
+		ProjectID: event.ProjectID,
+		From:      event.FromStatus.String,
+		To:        string(event.ToStatus),
+		Actor:     event.Actor,
+		Reason:    event.Reason.String,
+	})
+}
+
+// enqueueStageRunEvent writes a stage_run_status_changed event to the outbox
+// as part of tx.
+func enqueueStageRunEvent(ctx context.Context, tx *sql.Tx, run *StageRun, from StageRunStatus) error {
+	return enqueueEvent(ctx, tx, events.StageRunStatusStream, &events.StageRunStatusChanged{
+		StageRunID: run.ID,
+		ProjectID:  run.ProjectID,
+		StageName:  run.StageName,
+		Attempt:    run.Attempt,
+		From:       string(from),
+		To:         string(run.Status),
+	})
+}
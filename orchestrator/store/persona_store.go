@@ -4,11 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"encoding/json"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Persona struct {
@@ -17,63 +19,375 @@ type Persona struct {
 	Description    sql.NullString  `json:"description"`
 	PromptTemplate string          `json:"prompt_template"`
 	ModelConfig    json.RawMessage `json:"model_config"` // JSONB type
+	CurrentVersion int             `json:"current_version"`
 	CreatedAt      time.Time       `json:"created_at"`
 	UpdatedAt      time.Time       `json:"updated_at"`
 }
 
+// PersonaValidator checks a persona before it is created or its prompt
+// template or model config changes.
+type PersonaValidator func(ctx context.Context, persona *Persona) error
+
 type PersonaStore struct {
-	db *sql.DB
+	db         *sql.DB
+	validators []PersonaValidator
 }
 
 func NewPersonaStore(db *sql.DB) *PersonaStore {
 	return &PersonaStore{db: db}
 }
 
+// AddValidator registers a check run by CreatePersona, UpdatePersona and
+// RevisePersona. It must be called before the store is used concurrently.
+func (s *PersonaStore) AddValidator(validator PersonaValidator) {
+	s.validators = append(s.validators, validator)
+}
+
+func (s *PersonaStore) validate(ctx context.Context, persona *Persona) error {
+	for _, validator := range s.validators {
+		if err := validator(ctx, persona); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPersona, err)
+		}
+	}
+	return nil
+}
+
+// CreatePersona stores a new persona together with its first version.
 func (s *PersonaStore) CreatePersona(ctx context.Context, persona *Persona) error {
+	if err := s.validate(ctx, persona); err != nil {
+		return err
+	}
 	persona.ID = uuid.New()
-	persona.CreatedAt = time.Now()
-	persona.UpdatedAt = time.Now()
+	persona.CurrentVersion = 1
+	persona.CreatedAt = persistedNow()
+	persona.UpdatedAt = persona.CreatedAt
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	query := `
-		INSERT INTO personas (persona_id, name, description, prompt_template, model_config, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO personas (persona_id, name, description, prompt_template, model_config, current_version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
-	_, err := s.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		persona.ID,
 		persona.Name,
 		persona.Description,
 		persona.PromptTemplate,
 		persona.ModelConfig,
+		persona.CurrentVersion,
 		persona.CreatedAt,
 		persona.UpdatedAt,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("persona name %q: %w", persona.Name, ErrPersonaExists)
+		}
 		return fmt.Errorf("failed to create persona: %w", err)
 	}
+	version := &PersonaVersion{
+		PersonaID:      persona.ID,
+		Version:        persona.CurrentVersion,
+		PromptTemplate: persona.PromptTemplate,
+		ModelConfig:    persona.ModelConfig,
+		CreatedAt:      persona.CreatedAt,
+	}
+	if err := insertPersonaVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit persona creation: %w", err)
+	}
 	return nil
 }
 
 func (s *PersonaStore) GetPersona(ctx context.Context, id uuid.UUID) (*Persona, error) {
-	persona := &Persona{}
 	query := `
-		SELECT persona_id, name, description, prompt_template, model_config, created_at, updated_at
+		SELECT ` + personaColumns + `
 		FROM personas
 		WHERE persona_id = $1
 	`
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	persona, err := scanPersona(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Persona not found
+		}
+		return nil, fmt.Errorf("failed to get persona: %w", err)
+	}
+	return persona, nil
+}
+
+func (s *PersonaStore) GetPersonaByName(ctx context.Context, name string) (*Persona, error) {
+	query := `
+		SELECT ` + personaColumns + `
+		FROM personas
+		WHERE name = $1
+	`
+	persona, err := scanPersona(s.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Persona not found
+		}
+		return nil, fmt.Errorf("failed to get persona by name: %w", err)
+	}
+	return persona, nil
+}
+
+// PersonaFilter narrows and pages ListPersonas.
+type PersonaFilter struct {
+	// NameContains matches personas whose name contains it, ignoring case.
+	NameContains string
+	// Model matches personas whose model_config names this model.
+	Model string
+	// Limit caps the number of personas returned; zero means DefaultPersonaPageSize.
+	Limit  int
+	Offset int
+}
+
+const (
+	DefaultPersonaPageSize = 50
+	MaxPersonaPageSize     = 500
+)
+
+// ListPersonas returns the personas matching filter, ordered by name.
+func (s *PersonaStore) ListPersonas(ctx context.Context, filter PersonaFilter) ([]*Persona, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPersonaPageSize
+	}
+	if limit > MaxPersonaPageSize {
+		limit = MaxPersonaPageSize
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + personaColumns + `
+		FROM personas
+		WHERE ($1 = '' OR name ILIKE '%' || $1 || '%')
+		  AND ($2 = '' OR model_config->>'model' = $2)
+		ORDER BY name
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := s.db.QueryContext(ctx, query, escapeLike(filter.NameContains), filter.Model, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", err)
+	}
+	defer rows.Close()
+
+	var personas []*Persona
+	for rows.Next() {
+		persona, err := scanPersona(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan persona: %w", err)
+		}
+		personas = append(personas, persona)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list personas: %w", err)
+	}
+	return personas, nil
+}
+
+// UpdatePersona saves persona's name, description, prompt template and model
+// config. persona.UpdatedAt must be the value last read; if the persona was
+// changed since, ErrPersonaConflict is returned and nothing is written. A
+// changed prompt template or model config is recorded as a new persona
+// version. A persona cannot be renamed while a workflow with unfinished
+// projects uses it; ErrPersonaInUse is returned instead. On success persona is
+// refreshed with the stored state.
+func (s *PersonaStore) UpdatePersona(ctx context.Context, persona *Persona) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := lockPersona(ctx, tx, persona.ID)
+	if err != nil {
+		return err
+	}
+	if !current.UpdatedAt.Equal(persona.UpdatedAt) {
+		return fmt.Errorf("persona %s: %w", persona.ID, ErrPersonaConflict)
+	}
+	if persona.Name != current.Name {
+		workflows, err := workflowsUsingPersona(ctx, tx, current.Name)
+		if err != nil {
+			return err
+		}
+		if len(workflows) > 0 {
+			return fmt.Errorf("persona %s cannot be renamed while used by active workflows %s: %w", current.Name, strings.Join(workflows, ", "), ErrPersonaInUse)
+		}
+	}
+
+	var unchanged bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT prompt_template = $1 AND model_config IS NOT DISTINCT FROM $2::jsonb FROM personas WHERE persona_id = $3`,
+		persona.PromptTemplate, persona.ModelConfig, persona.ID,
+	).Scan(&unchanged)
+	if err != nil {
+		return fmt.Errorf("failed to compare persona versions: %w", err)
+	}
+	if !unchanged {
+		if err := s.validate(ctx, persona); err != nil {
+			return err
+		}
+		if _, err := appendPersonaVersion(ctx, tx, current, persona.PromptTemplate, persona.ModelConfig, sql.NullInt64{}); err != nil {
+			return err
+		}
+	}
+
+	updatedAt := persistedNow()
+	query := `
+		UPDATE personas
+		SET name = $1, description = $2, updated_at = $3
+		WHERE persona_id = $4
+	`
+	_, err = tx.ExecContext(ctx, query, persona.Name, persona.Description, updatedAt, persona.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("persona name %q: %w", persona.Name, ErrPersonaExists)
+		}
+		return fmt.Errorf("failed to update persona: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit persona update: %w", err)
+	}
+	persona.CurrentVersion = current.CurrentVersion
+	persona.CreatedAt = current.CreatedAt
+	persona.UpdatedAt = updatedAt
+	return nil
+}
+
+// DeletePersona removes a persona with its versions, rubric and prompt drafts.
+// It fails with ErrPersonaInUse while a workflow with unfinished projects has
+// a stage run by the persona.
+func (s *PersonaStore) DeletePersona(ctx context.Context, id uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	persona, err := lockPersona(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	workflows, err := workflowsUsingPersona(ctx, tx, persona.Name)
+	if err != nil {
+		return err
+	}
+	if len(workflows) > 0 {
+		return fmt.Errorf("persona %s is used by active workflows %s: %w", persona.Name, strings.Join(workflows, ", "), ErrPersonaInUse)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM personas WHERE persona_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete persona: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit persona deletion: %w", err)
+	}
+	return nil
+}
+
+// workflowsUsingPersona returns the names of the workflows with unfinished
+// projects that have a stage run by the named persona.
+func workflowsUsingPersona(ctx context.Context, tx *sql.Tx, name string) ([]string, error) {
+	query := `
+		SELECT w.name
+		FROM workflows w
+		WHERE EXISTS (
+			SELECT 1 FROM jsonb_array_elements(w.definition->'stages') stage
+			WHERE stage->>'persona' = $1
+		)
+		AND EXISTS (
+			SELECT 1 FROM projects p
+			WHERE p.workflow_id = w.workflow_id AND p.status IN ('created', 'running')
+		)
+		ORDER BY w.name
+	`
+	rows, err := tx.QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workflows using persona: %w", err)
+	}
+	var workflows []string
+	for rows.Next() {
+		var workflow string
+		if err := rows.Scan(&workflow); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan workflow name: %w", err)
+		}
+		workflows = append(workflows, workflow)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find workflows using persona: %w", err)
+	}
+	return workflows, nil
+}
+
+// ExistingPersonaNames reports which of the given persona names exist.
+func (s *PersonaStore) ExistingPersonaNames(ctx context.Context, names []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(names))
+	if len(names) == 0 {
+		return existing, nil
+	}
+	query := `
+		SELECT name
+		FROM personas
+		WHERE name = ANY($1)
+	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up persona names: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan persona name: %w", err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up persona names: %w", err)
+	}
+	return existing, nil
+}
+
+const personaColumns = `persona_id, name, description, prompt_template, model_config, current_version, created_at, updated_at`
+
+func scanPersona(row rowScanner) (*Persona, error) {
+	persona := &Persona{}
+	err := row.Scan(
 		&persona.ID,
 		&persona.Name,
 		&persona.Description,
 		&persona.PromptTemplate,
 		&persona.ModelConfig,
+		&persona.CurrentVersion,
 		&persona.CreatedAt,
 		&persona.UpdatedAt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // Persona not found
-		}
-		return nil, fmt.Errorf("failed to get persona: %w", err)
+		return nil, err
 	}
 	return persona, nil
 }
+
+// persistedNow returns the current time at the microsecond precision Postgres
+// stores, so a persona's UpdatedAt compares equal after a round trip.
+func persistedNow() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// PersonaVersion is an immutable snapshot of a persona's prompt template and
+// model config. Every change to either creates a new version; the personas row
+// mirrors the current one.
+type PersonaVersion struct {
+	ID             uuid.UUID       `json:"id"`
+	PersonaID      uuid.UUID       `json:"persona_id"`
+	Version        int             `json:"version"`
+	PromptTemplate string          `json:"prompt_template"`
+	ModelConfig    json.RawMessage `json:"model_config"` // JSONB type
+	RolledBackFrom sql.NullInt64   `json:"rolled_back_from"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// RevisePersona records a new version of the persona with the given prompt
+// template and model config and makes it current. If neither differs from the
+// current version, the current version is returned and nothing is written.
+func (s *PersonaStore) RevisePersona(ctx context.Context, personaID uuid.UUID, promptTemplate string, modelConfig json.RawMessage) (*PersonaVersion, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	persona, err := lockPersona(ctx, tx, personaID)
+	if err != nil {
+		return nil, err
+	}
+	var unchanged bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT prompt_template = $1 AND model_config IS NOT DISTINCT FROM $2::jsonb FROM personas WHERE persona_id = $3`,
+		promptTemplate, modelConfig, personaID,
+	).Scan(&unchanged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare persona versions: %w", err)
+	}
+	if unchanged {
+		return getPersonaVersionByNumber(ctx, tx, personaID, persona.CurrentVersion)
+	}
+	revised := *persona
+	revised.PromptTemplate = promptTemplate
+	revised.ModelConfig = modelConfig
+	if err := s.validate(ctx, &revised); err != nil {
+		return nil, err
+	}
+
+	version, err := appendPersonaVersion(ctx, tx, persona, promptTemplate, modelConfig, sql.NullInt64{})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit persona revision: %w", err)
+	}
+	return version, nil
+}
+
+// RollbackPersona makes an earlier version current again by copying it into a
+// new version, so history is never rewritten. The earlier version must still
+// pass the persona validators, as the partials and models it refers to may
+// have changed since.
+func (s *PersonaStore) RollbackPersona(ctx context.Context, personaID uuid.UUID, version int) (*PersonaVersion, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	persona, err := lockPersona(ctx, tx, personaID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := getPersonaVersionByNumber(ctx, tx, personaID, version)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("version %d of persona %s: %w", version, personaID, ErrPersonaVersionNotFound)
+	}
+	revised := *persona
+	revised.PromptTemplate = target.PromptTemplate
+	revised.ModelConfig = target.ModelConfig
+	if err := s.validate(ctx, &revised); err != nil {
+		return nil, err
+	}
+
+	rolledBack, err := appendPersonaVersion(ctx, tx, persona, target.PromptTemplate, target.ModelConfig,
+		sql.NullInt64{Int64: int64(target.Version), Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit persona rollback: %w", err)
+	}
+	return rolledBack, nil
+}
+
+func (s *PersonaStore) GetPersonaVersion(ctx context.Context, id uuid.UUID) (*PersonaVersion, error) {
+	query := `
+		SELECT ` + personaVersionColumns + `
+		FROM persona_versions
+		WHERE persona_version_id = $1
+	`
+	version, err := scanPersonaVersion(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Persona version not found
+		}
+		return nil, fmt.Errorf("failed to get persona version: %w", err)
+	}
+	return version, nil
+}
+
+// GetPersonaVersionByNumber returns the given version of a persona, or nil if
+// it does not exist.
+func (s *PersonaStore) GetPersonaVersionByNumber(ctx context.Context, personaID uuid.UUID, version int) (*PersonaVersion, error) {
+	return getPersonaVersionByNumber(ctx, s.db, personaID, version)
+}
+
+// GetCurrentPersonaVersionByName returns the current version of the named
+// persona, or nil if there is no such persona.
+func (s *PersonaStore) GetCurrentPersonaVersionByName(ctx context.Context, name string) (*PersonaVersion, error) {
+	query := `
+		SELECT v.persona_version_id, v.persona_id, v.version, v.prompt_template, v.model_config, v.rolled_back_from, v.created_at
+		FROM personas p
+		JOIN persona_versions v ON v.persona_id = p.persona_id AND v.version = p.current_version
+		WHERE p.name = $1
+	`
+	version, err := scanPersonaVersion(s.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Persona not found
+		}
+		return nil, fmt.Errorf("failed to get current persona version: %w", err)
+	}
+	return version, nil
+}
+
+// ListPersonaVersions returns every version of a persona, oldest first.
+func (s *PersonaStore) ListPersonaVersions(ctx context.Context, personaID uuid.UUID) ([]*PersonaVersion, error) {
+	query := `
+		SELECT ` + personaVersionColumns + `
+		FROM persona_versions
+		WHERE persona_id = $1
+		ORDER BY version
+	`
+	rows, err := s.db.QueryContext(ctx, query, personaID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persona versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*PersonaVersion
+	for rows.Next() {
+		version, err := scanPersonaVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan persona version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list persona versions: %w", err)
+	}
+	return versions, nil
+}
+
+// queryRower is satisfied by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getPersonaVersionByNumber(ctx context.Context, q queryRower, personaID uuid.UUID, version int) (*PersonaVersion, error) {
+	query := `
+		SELECT ` + personaVersionColumns + `
+		FROM persona_versions
+		WHERE persona_id = $1 AND version = $2
+	`
+	v, err := scanPersonaVersion(q.QueryRowContext(ctx, query, personaID, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Persona version not found
+		}
+		return nil, fmt.Errorf("failed to get persona version: %w", err)
+	}
+	return v, nil
+}
+
+// lockPersona loads a persona and locks its row until tx ends, serialising
+// concurrent version changes.
+func lockPersona(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*Persona, error) {
+	query := `
+		SELECT ` + personaColumns + `
+		FROM personas
+		WHERE persona_id = $1
+		FOR UPDATE
+	`
+	persona, err := scanPersona(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("persona %s: %w", id, ErrPersonaNotFound)
+		}
+		return nil, fmt.Errorf("failed to lock persona: %w", err)
+	}
+	return persona, nil
+}
+
+// appendPersonaVersion stores the next version of a persona locked by
+// lockPersona and makes it current.
+func appendPersonaVersion(ctx context.Context, tx *sql.Tx, persona *Persona, promptTemplate string, modelConfig json.RawMessage, rolledBackFrom sql.NullInt64) (*PersonaVersion, error) {
+	version := &PersonaVersion{
+		PersonaID:      persona.ID,
+		Version:        persona.CurrentVersion + 1,
+		PromptTemplate: promptTemplate,
+		ModelConfig:    modelConfig,
+		RolledBackFrom: rolledBackFrom,
+		CreatedAt:      persistedNow(),
+	}
+	if err := insertPersonaVersion(ctx, tx, version); err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE personas
+		SET prompt_template = $1, model_config = $2, current_version = $3, updated_at = $4
+		WHERE persona_id = $5
+	`
+	_, err := tx.ExecContext(ctx, query, promptTemplate, modelConfig, version.Version, version.CreatedAt, persona.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update current persona version: %w", err)
+	}
+	persona.PromptTemplate = promptTemplate
+	persona.ModelConfig = modelConfig
+	persona.CurrentVersion = version.Version
+	persona.UpdatedAt = version.CreatedAt
+	return version, nil
+}
+
+func insertPersonaVersion(ctx context.Context, tx *sql.Tx, version *PersonaVersion) error {
+	version.ID = uuid.New()
+	query := `
+		INSERT INTO persona_versions (persona_version_id, persona_id, version, prompt_template, model_config, rolled_back_from, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := tx.ExecContext(ctx, query,
+		version.ID,
+		version.PersonaID,
+		version.Version,
+		version.PromptTemplate,
+		version.ModelConfig,
+		version.RolledBackFrom,
+		version.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create persona version: %w", err)
+	}
+	return nil
+}
+
+const personaVersionColumns = `persona_version_id, persona_id, version, prompt_template, model_config, rolled_back_from, created_at`
+
+func scanPersonaVersion(row rowScanner) (*PersonaVersion, error) {
+	version := &PersonaVersion{}
+	err := row.Scan(
+		&version.ID,
+		&version.PersonaID,
+		&version.Version,
+		&version.PromptTemplate,
+		&version.ModelConfig,
+		&version.RolledBackFrom,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
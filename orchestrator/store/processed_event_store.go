@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProcessedEventStore remembers which events each consumer has handled, so
+// an event delivered again is recognised and skipped.
+type ProcessedEventStore struct {
+	db *sql.DB
+}
+
+func NewProcessedEventStore(db *sql.DB) *ProcessedEventStore {
+	return &ProcessedEventStore{db: db}
+}
+
+// IsEventProcessed reports whether consumer has already handled the event.
+func (s *ProcessedEventStore) IsEventProcessed(ctx context.Context, consumer string, eventID uuid.UUID) (bool, error) {
+	var processed bool
+	query := `SELECT EXISTS (SELECT 1 FROM processed_events WHERE consumer = $1 AND event_id = $2)`
+	if err := s.db.QueryRowContext(ctx, query, consumer, eventID).Scan(&processed); err != nil {
+		return false, fmt.Errorf("failed to check processed event: %w", err)
+	}
+	return processed, nil
+}
+
+// MarkEventProcessed records that consumer handled the event. It reports
+// false if the event was already recorded.
+func (s *ProcessedEventStore) MarkEventProcessed(ctx context.Context, consumer string, eventID uuid.UUID, eventType string) (bool, error) {
+	query := `
+		INSERT INTO processed_events (consumer, event_id, event_type, processed_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (consumer, event_id) DO NOTHING
+	`
+	result, err := s.db.ExecContext(ctx, query, consumer, eventID, eventType, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return inserted == 1, nil
+}
+
+// PruneProcessedEvents forgets events processed before cutoff and returns how
+// many were removed. Events must not be redelivered after cutoff.
+func (s *ProcessedEventStore) PruneProcessedEvents(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM processed_events WHERE processed_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune processed events: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune processed events: %w", err)
+	}
+	return pruned, nil
+}
@@ -23,10 +23,22 @@ type Project struct {
 	Name        string         `json:"name"`
 	Description sql.NullString `json:"description"`
 	Status      ProjectStatus  `json:"status"`
+	WorkflowID  uuid.NullUUID  `json:"workflow_id"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 }
 
+// ProjectEvent records one project status transition.
+type ProjectEvent struct {
+	ID         uuid.UUID      `json:"id"`
+	ProjectID  uuid.UUID      `json:"project_id"`
+	FromStatus sql.NullString `json:"from_status"`
+	ToStatus   ProjectStatus  `json:"to_status"`
+	Actor      string         `json:"actor"`
+	Reason     sql.NullString `json:"reason"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
 type ProjectStore struct {
 	db *sql.DB
 }
@@ -35,63 +47,288 @@ func NewProjectStore(db *sql.DB) *ProjectStore {
 	return &ProjectStore{db: db}
 }
 
+// CreateProject inserts a new project and records its creation in the
+// project's history. A caller-chosen ID is kept; otherwise one is generated.
+// It fails with ErrProjectExists when the ID is taken.
 func (s *ProjectStore) CreateProject(ctx context.Context, project *Project) error {
-	project.ID = uuid.New()
+	if project.ID == uuid.Nil {
+		project.ID = uuid.New()
+	}
 	project.Status = ProjectStatusCreated
 	project.CreatedAt = time.Now()
 	project.UpdatedAt = time.Now()
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO projects (project_id, name, description, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO projects (project_id, name, description, status, workflow_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := s.db.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		project.ID,
 		project.Name,
 		project.Description,
 		project.Status,
+		project.WorkflowID,
 		project.CreatedAt,
 		project.UpdatedAt,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("project %s: %w", project.ID, ErrProjectExists)
+		}
 		return fmt.Errorf("failed to create project: %w", err)
 	}
+	event := &ProjectEvent{
+		ProjectID: project.ID,
+		ToStatus:  project.Status,
+		Actor:     SystemActor,
+		CreatedAt: project.CreatedAt,
+	}
+	if err := insertProjectEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := enqueueProjectEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit project creation: %w", err)
+	}
 	return nil
 }
 
 func (s *ProjectStore) GetProject(ctx context.Context, id uuid.UUID) (*Project, error) {
-	project := &Project{}
 	query := `
-		SELECT project_id, name, description, status, created_at, updated_at
+		SELECT ` + projectColumns + `
 		FROM projects
 		WHERE project_id = $1
 	`
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	project, err := scanProject(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Project not found
+		}
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return project, nil
+}
+
+// ListProjectsByStatus returns every project with the given status, oldest
+// first.
+func (s *ProjectStore) ListProjectsByStatus(ctx context.Context, status ProjectStatus) ([]*Project, error) {
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects
+		WHERE status = $1
+		ORDER BY created_at, project_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []*Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, project)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	return projects, nil
+}
+
+// ProjectFilter narrows and pages ListProjects.
+type ProjectFilter struct {
+	// Status matches projects in this status; empty matches every status.
+	Status ProjectStatus
+	// Limit caps the number of projects returned; zero means DefaultProjectPageSize.
+	Limit  int
+	Offset int
+}
+
+const (
+	DefaultProjectPageSize = 50
+	MaxProjectPageSize     = 500
+)
+
+// ListProjects returns the projects matching filter, newest first.
+func (s *ProjectStore) ListProjects(ctx context.Context, filter ProjectFilter) ([]*Project, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultProjectPageSize
+	}
+	if limit > MaxProjectPageSize {
+		limit = MaxProjectPageSize
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + projectColumns + `
+		FROM projects
+		WHERE ($1 = '' OR status::text = $1)
+		ORDER BY created_at DESC, project_id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, filter.Status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []*Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, project)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	return projects, nil
+}
+
+const projectColumns = `project_id, name, description, status, workflow_id, created_at, updated_at`
+
+func scanProject(row rowScanner) (*Project, error) {
+	project := &Project{}
+	err := row.Scan(
 		&project.ID,
 		&project.Name,
 		&project.Description,
 		&project.Status,
+		&project.WorkflowID,
 		&project.CreatedAt,
 		&project.UpdatedAt,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // Project not found
-		}
-		return nil, fmt.Errorf("failed to get project: %w", err)
+		return nil, err
 	}
 	return project, nil
 }
 
-func (s *ProjectStore) UpdateProjectStatus(ctx context.Context, id uuid.UUID, status ProjectStatus) error {
+// SystemActor is the actor recorded for changes the engine makes on its own.
+const SystemActor = "system"
+
+// UpdateProjectStatus moves a project to status and records the transition,
+// with who made it and why, in the project's history. Transitions outside the
+// table fail with an *IllegalProjectTransitionError.
+func (s *ProjectStore) UpdateProjectStatus(ctx context.Context, id uuid.UUID, status ProjectStatus, actor, reason string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current ProjectStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM projects WHERE project_id = $1 FOR UPDATE`, id).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("project %s: %w", id, ErrProjectNotFound)
+		}
+		return fmt.Errorf("failed to lock project: %w", err)
+	}
+	if !CanProjectTransition(current, status) {
+		return &IllegalProjectTransitionError{ProjectID: id, From: current, To: status}
+	}
+
+	now := time.Now()
 	query := `
 		UPDATE projects
 		SET status = $1, updated_at = $2
 		WHERE project_id = $3
 	`
-	_, err := s.db.ExecContext(ctx, query, status, time.Now(), id)
+	_, err = tx.ExecContext(ctx, query, status, now, id)
 	if err != nil {
 		return fmt.Errorf("failed to update project status: %w", err)
 	}
+	event := &ProjectEvent{
+		ProjectID:  id,
+		FromStatus: sql.NullString{String: string(current), Valid: true},
+		ToStatus:   status,
+		Actor:      actor,
+		Reason:     sql.NullString{String: reason, Valid: reason != ""},
+		CreatedAt:  now,
+	}
+	if err := insertProjectEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := enqueueProjectEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit project status update: %w", err)
+	}
+	return nil
+}
+
+// ListProjectEvents returns a project's status history, oldest first.
+func (s *ProjectStore) ListProjectEvents(ctx context.Context, projectID uuid.UUID) ([]*ProjectEvent, error) {
+	query := `
+		SELECT event_id, project_id, from_status, to_status, actor, reason, created_at
+		FROM project_events
+		WHERE project_id = $1
+		ORDER BY created_at, event_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project events: %w", err)
+	}
+	defer rows.Close()
+
+	var projectEvents []*ProjectEvent
+	for rows.Next() {
+		event := &ProjectEvent{}
+		err := rows.Scan(
+			&event.ID,
+			&event.ProjectID,
+			&event.FromStatus,
+			&event.ToStatus,
+			&event.Actor,
+			&event.Reason,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project event: %w", err)
+		}
+		projectEvents = append(projectEvents, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list project events: %w", err)
+	}
+	return projectEvents, nil
+}
+
+func insertProjectEvent(ctx context.Context, tx *sql.Tx, event *ProjectEvent) error {
+	event.ID = uuid.New()
+	query := `
+		INSERT INTO project_events (event_id, project_id, from_status, to_status, actor, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := tx.ExecContext(ctx, query,
+		event.ID,
+		event.ProjectID,
+		event.FromStatus,
+		event.ToStatus,
+		event.Actor,
+		event.Reason,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record project event: %w", err)
+	}
 	return nil
 }
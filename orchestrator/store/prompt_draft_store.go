@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PromptDraftStatus string
+
+const (
+	PromptDraftStatusPending  PromptDraftStatus = "pending"
+	PromptDraftStatusAccepted PromptDraftStatus = "accepted"
+	PromptDraftStatusRejected PromptDraftStatus = "rejected"
+)
+
+// PromptDraft is a suggested revision of a persona's prompt template awaiting
+// a maintainer's decision.
+type PromptDraft struct {
+	ID                     uuid.UUID         `json:"id"`
+	PersonaID              uuid.UUID         `json:"persona_id"`
+	BasePromptTemplate     string            `json:"base_prompt_template"`
+	ProposedPromptTemplate string            `json:"proposed_prompt_template"`
+	Rationale              sql.NullString    `json:"rationale"`
+	Status                 PromptDraftStatus `json:"status"`
+	DecidedBy              sql.NullString    `json:"decided_by"`
+	DecidedAt              sql.NullTime      `json:"decided_at"`
+	CreatedAt              time.Time         `json:"created_at"`
+	UpdatedAt              time.Time         `json:"updated_at"`
+}
+
+type PromptDraftStore struct {
+	db *sql.DB
+	// personas validates the persona an accepted draft revises.
+	personas *PersonaStore
+}
+
+func NewPromptDraftStore(db *sql.DB, personas *PersonaStore) *PromptDraftStore {
+	return &PromptDraftStore{db: db, personas: personas}
+}
+
+func (s *PromptDraftStore) CreatePromptDraft(ctx context.Context, draft *PromptDraft) error {
+	draft.ID = uuid.New()
+	draft.Status = PromptDraftStatusPending
+	draft.CreatedAt = time.Now()
+	draft.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO persona_prompt_drafts (draft_id, persona_id, base_prompt_template, proposed_prompt_template, rationale, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		draft.ID,
+		draft.PersonaID,
+		draft.BasePromptTemplate,
+		draft.ProposedPromptTemplate,
+		draft.Rationale,
+		draft.Status,
+		draft.CreatedAt,
+		draft.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create prompt draft: %w", err)
+	}
+	return nil
+}
+
+func (s *PromptDraftStore) GetPromptDraft(ctx context.Context, id uuid.UUID) (*PromptDraft, error) {
+	query := `
+		SELECT ` + promptDraftColumns + `
+		FROM persona_prompt_drafts
+		WHERE draft_id = $1
+	`
+	draft, err := scanPromptDraft(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Prompt draft not found
+		}
+		return nil, fmt.Errorf("failed to get prompt draft: %w", err)
+	}
+	return draft, nil
+}
+
+// GetPendingPromptDraft returns the persona's draft awaiting a decision, if any.
+func (s *PromptDraftStore) GetPendingPromptDraft(ctx context.Context, personaID uuid.UUID) (*PromptDraft, error) {
+	query := `
+		SELECT ` + promptDraftColumns + `
+		FROM persona_prompt_drafts
+		WHERE persona_id = $1 AND status = 'pending'
+	`
+	draft, err := scanPromptDraft(s.db.QueryRowContext(ctx, query, personaID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No pending draft
+		}
+		return nil, fmt.Errorf("failed to get pending prompt draft: %w", err)
+	}
+	return draft, nil
+}
+
+// ListPromptDraftsByStatus returns drafts with the given status, newest first.
+func (s *PromptDraftStore) ListPromptDraftsByStatus(ctx context.Context, status PromptDraftStatus) ([]*PromptDraft, error) {
+	query := `
+		SELECT ` + promptDraftColumns + `
+		FROM persona_prompt_drafts
+		WHERE status = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt drafts: %w", err)
+	}
+	defer rows.Close()
+
+	var drafts []*PromptDraft
+	for rows.Next() {
+		draft, err := scanPromptDraft(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan prompt draft: %w", err)
+		}
+		drafts = append(drafts, draft)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list prompt drafts: %w", err)
+	}
+	return drafts, nil
+}
+
+// AcceptPromptDraft makes the draft's proposed template the persona's active
+// prompt by recording it as a new persona version. The revised persona must
+// pass the persona validators. It fails with ErrDraftOutdated if the persona's
+// prompt changed after the draft was proposed, and with ErrDraftNotPending if
+// it was already decided.
+func (s *PromptDraftStore) AcceptPromptDraft(ctx context.Context, id uuid.UUID, decidedBy string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draft, err := lockPendingPromptDraft(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	persona, err := lockPersona(ctx, tx, draft.PersonaID)
+	if err != nil {
+		return err
+	}
+	if persona.PromptTemplate != draft.BasePromptTemplate {
+		return ErrDraftOutdated
+	}
+	revised := *persona
+	revised.PromptTemplate = draft.ProposedPromptTemplate
+	if err := s.personas.validate(ctx, &revised); err != nil {
+		return err
+	}
+
+	version, err := appendPersonaVersion(ctx, tx, persona, draft.ProposedPromptTemplate, persona.ModelConfig, sql.NullInt64{})
+	if err != nil {
+		return err
+	}
+	now := version.CreatedAt
+	if err := decidePromptDraft(ctx, tx, id, PromptDraftStatusAccepted, decidedBy, now); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit prompt draft acceptance: %w", err)
+	}
+	return nil
+}
+
+// RejectPromptDraft discards a pending draft.
+func (s *PromptDraftStore) RejectPromptDraft(ctx context.Context, id uuid.UUID, decidedBy string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPendingPromptDraft(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := decidePromptDraft(ctx, tx, id, PromptDraftStatusRejected, decidedBy, time.Now()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit prompt draft rejection: %w", err)
+	}
+	return nil
+}
+
+func lockPendingPromptDraft(ctx context.Context, tx *sql.Tx, id uuid.UUID) (*PromptDraft, error) {
+	query := `
+		SELECT ` + promptDraftColumns + `
+		FROM persona_prompt_drafts
+		WHERE draft_id = $1
+		FOR UPDATE
+	`
+	draft, err := scanPromptDraft(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("prompt draft %s not found", id)
+		}
+		return nil, fmt.Errorf("failed to lock prompt draft: %w", err)
+	}
+	if draft.Status != PromptDraftStatusPending {
+		return nil, ErrDraftNotPending
+	}
+	return draft, nil
+}
+
+func decidePromptDraft(ctx context.Context, tx *sql.Tx, id uuid.UUID, status PromptDraftStatus, decidedBy string, at time.Time) error {
+	query := `
+		UPDATE persona_prompt_drafts
+		SET status = $1, decided_by = $2, decided_at = $3, updated_at = $3
+		WHERE draft_id = $4
+	`
+	_, err := tx.ExecContext(ctx, query, status, decidedBy, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to update prompt draft: %w", err)
+	}
+	return nil
+}
+
+const promptDraftColumns = `draft_id, persona_id, base_prompt_template, proposed_prompt_template, rationale, status, decided_by, decided_at, created_at, updated_at`
+
+func scanPromptDraft(row rowScanner) (*PromptDraft, error) {
+	draft := &PromptDraft{}
+	err := row.Scan(
+		&draft.ID,
+		&draft.PersonaID,
+		&draft.BasePromptTemplate,
+		&draft.ProposedPromptTemplate,
+		&draft.Rationale,
+		&draft.Status,
+		&draft.DecidedBy,
+		&draft.DecidedAt,
+		&draft.CreatedAt,
+		&draft.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
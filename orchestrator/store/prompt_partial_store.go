@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PromptPartial is a named template fragment shared across persona prompts.
+type PromptPartial struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PromptPartialStore struct {
+	db *sql.DB
+}
+
+func NewPromptPartialStore(db *sql.DB) *PromptPartialStore {
+	return &PromptPartialStore{db: db}
+}
+
+// UpsertPromptPartial creates the partial or replaces the body of the one with
+// the same name. The stored ID and CreatedAt are written back to partial.
+func (s *PromptPartialStore) UpsertPromptPartial(ctx context.Context, partial *PromptPartial) error {
+	now := time.Now()
+	query := `
+		INSERT INTO prompt_partials (partial_id, name, body, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET body = EXCLUDED.body, updated_at = EXCLUDED.updated_at
+		RETURNING partial_id, created_at, updated_at
+	`
+	err := s.db.QueryRowContext(ctx, query,
+		uuid.New(),
+		partial.Name,
+		partial.Body,
+		now,
+	).Scan(&partial.ID, &partial.CreatedAt, &partial.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert prompt partial: %w", err)
+	}
+	return nil
+}
+
+func (s *PromptPartialStore) GetPromptPartial(ctx context.Context, name string) (*PromptPartial, error) {
+	query := `
+		SELECT partial_id, name, body, created_at, updated_at
+		FROM prompt_partials
+		WHERE name = $1
+	`
+	partial := &PromptPartial{}
+	err := s.db.QueryRowContext(ctx, query, name).Scan(
+		&partial.ID,
+		&partial.Name,
+		&partial.Body,
+		&partial.CreatedAt,
+		&partial.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Prompt partial not found
+		}
+		return nil, fmt.Errorf("failed to get prompt partial: %w", err)
+	}
+	return partial, nil
+}
+
+// ListPromptPartials returns every partial, ordered by name.
+func (s *PromptPartialStore) ListPromptPartials(ctx context.Context) ([]*PromptPartial, error) {
+	query := `
+		SELECT partial_id, name, body, created_at, updated_at
+		FROM prompt_partials
+		ORDER BY name
+	`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt partials: %w", err)
+	}
+	defer rows.Close()
+
+	var partials []*PromptPartial
+	for rows.Next() {
+		partial := &PromptPartial{}
+		err := rows.Scan(
+			&partial.ID,
+			&partial.Name,
+			&partial.Body,
+			&partial.CreatedAt,
+			&partial.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan prompt partial: %w", err)
+		}
+		partials = append(partials, partial)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list prompt partials: %w", err)
+	}
+	return partials, nil
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Rubric holds the criteria the Quality-Analyst scores a persona's output against.
+type Rubric struct {
+	ID        uuid.UUID       `json:"id"`
+	PersonaID uuid.UUID       `json:"persona_id"`
+	Name      string          `json:"name"`
+	Criteria  json.RawMessage `json:"criteria"` // JSONB type
+	Threshold float64         `json:"threshold"`
+	OnFailure string          `json:"on_failure"`
+	MaxReruns int             `json:"max_reruns"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type RubricStore struct {
+	db *sql.DB
+}
+
+func NewRubricStore(db *sql.DB) *RubricStore {
+	return &RubricStore{db: db}
+}
+
+func (s *RubricStore) CreateRubric(ctx context.Context, rubric *Rubric) error {
+	rubric.ID = uuid.New()
+	rubric.CreatedAt = time.Now()
+	rubric.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO rubrics (rubric_id, persona_id, name, criteria, threshold, on_failure, max_reruns, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		rubric.ID,
+		rubric.PersonaID,
+		rubric.Name,
+		rubric.Criteria,
+		rubric.Threshold,
+		rubric.OnFailure,
+		rubric.MaxReruns,
+		rubric.CreatedAt,
+		rubric.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create rubric: %w", err)
+	}
+	return nil
+}
+
+func (s *RubricStore) GetRubricByPersona(ctx context.Context, personaID uuid.UUID) (*Rubric, error) {
+	query := `
+		SELECT rubric_id, persona_id, name, criteria, threshold, on_failure, max_reruns, created_at, updated_at
+		FROM rubrics
+		WHERE persona_id = $1
+	`
+	return s.getRubric(ctx, query, personaID)
+}
+
+// GetRubricByPersonaName looks a rubric up through its persona's unique name,
+// which is how workflow stages refer to personas.
+func (s *RubricStore) GetRubricByPersonaName(ctx context.Context, personaName string) (*Rubric, error) {
+	query := `
+		SELECT r.rubric_id, r.persona_id, r.name, r.criteria, r.threshold, r.on_failure, r.max_reruns, r.created_at, r.updated_at
+		FROM rubrics r
+		JOIN personas p ON p.persona_id = r.persona_id
+		WHERE p.name = $1
+	`
+	return s.getRubric(ctx, query, personaName)
+}
+
+func (s *RubricStore) getRubric(ctx context.Context, query string, arg interface{}) (*Rubric, error) {
+	rubric := &Rubric{}
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(
+		&rubric.ID,
+		&rubric.PersonaID,
+		&rubric.Name,
+		&rubric.Criteria,
+		&rubric.Threshold,
+		&rubric.OnFailure,
+		&rubric.MaxReruns,
+		&rubric.CreatedAt,
+		&rubric.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Rubric not found
+		}
+		return nil, fmt.Errorf("failed to get rubric: %w", err)
+	}
+	return rubric, nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Leases let several orchestrator replicas share the stage_runs table: a
+// replica claims a pending run, which moves it to running under a lease held
+// by the replica, renews the lease while it executes the run and releases it
+// when the run finishes. Runs whose lease expired, because their replica died
+// or stalled, are failed so their stage's retry policy decides whether they
+// run again. Lease expiry is computed with the database clock so replicas
+// need not agree on the time.
+
+// ClaimStageRun moves the oldest due pending run to running under a lease
+// held by owner for ttl. Runs locked by a concurrent claim are skipped, so
+// replicas never claim the same run. It returns nil when no run is due.
+func (s *StageRunStore) ClaimStageRun(ctx context.Context, owner string, ttl time.Duration) (*StageRun, error) {
+	query := `
+		UPDATE stage_runs
+		SET status = $1, lease_owner = $2, lease_expires_at = now() + $3 * interval '1 millisecond',
+		    started_at = now(), updated_at = now()
+		WHERE stage_run_id = (
+			SELECT stage_run_id
+			FROM stage_runs
+			WHERE status = $4 AND (next_attempt_at IS NULL OR next_attempt_at <= now())
+			ORDER BY created_at, stage_run_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + stageRunColumns + `
+	`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stageRun, err := scanStageRun(tx.QueryRowContext(ctx, query, StageRunStatusRunning, owner, ttl.Milliseconds(), StageRunStatusPending))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Nothing to claim
+		}
+		return nil, fmt.Errorf("failed to claim stage run: %w", err)
+	}
+	if err := enqueueStageRunEvent(ctx, tx, stageRun, StageRunStatusPending); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit stage run claim: %w", err)
+	}
+	return stageRun, nil
+}
+
+// RenewStageRunLease extends owner's lease on a running run to ttl from now.
+// It fails with ErrLeaseLost when owner no longer holds the lease.
+func (s *StageRunStore) RenewStageRunLease(ctx context.Context, id uuid.UUID, owner string, ttl time.Duration) error {
+	query := `
+		UPDATE stage_runs
+		SET lease_expires_at = now() + $1 * interval '1 millisecond', updated_at = now()
+		WHERE stage_run_id = $2 AND lease_owner = $3 AND status = $4
+	`
+	result, err := s.db.ExecContext(ctx, query, ttl.Milliseconds(), id, owner, StageRunStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to renew stage run lease: %w", err)
+	}
+	renewed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to renew stage run lease: %w", err)
+	}
+	if renewed == 0 {
+		return fmt.Errorf("stage run %s: %w", id, ErrLeaseLost)
+	}
+	return nil
+}
+
+// ReleaseStageRun returns a running run owner holds the lease on to pending,
+// for when owner stops before the run finishes. The interrupted attempt does
+// not count against the stage's retry policy. It fails with ErrLeaseLost when
+// owner no longer holds the lease.
+func (s *StageRunStore) ReleaseStageRun(ctx context.Context, id uuid.UUID, owner string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE stage_runs
+		SET status = $1, lease_owner = NULL, lease_expires_at = NULL, started_at = NULL, updated_at = $2
+		WHERE stage_run_id = $3 AND lease_owner = $4 AND status = $5
+		RETURNING project_id, stage_name, attempt
+	`
+	run := &StageRun{ID: id, Status: StageRunStatusPending}
+	err = tx.QueryRowContext(ctx, query, StageRunStatusPending, time.Now(), id, owner, StageRunStatusRunning).
+		Scan(&run.ProjectID, &run.StageName, &run.Attempt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("stage run %s: %w", id, ErrLeaseLost)
+		}
+		return fmt.Errorf("failed to release stage run: %w", err)
+	}
+	if err := enqueueStageRunEvent(ctx, tx, run, StageRunStatusRunning); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run release: %w", err)
+	}
+	return nil
+}
+
+// StageRunOutcome is how an attempt at a stage run ended.
+type StageRunOutcome struct {
+	// Status is StageRunStatusCompleted or StageRunStatusFailed.
+	Status StageRunStatus
+	Output json.RawMessage
+	// ErrorClass and Error describe why a failed attempt failed.
+	ErrorClass string
+	Error      string
+}
+
+// FinishStageRun records the outcome of a run owner holds the lease on and
+// releases the lease. It fails with ErrLeaseLost when owner no longer holds
+// the lease, in which case nothing is written.
+func (s *StageRunStore) FinishStageRun(ctx context.Context, id uuid.UUID, owner string, outcome StageRunOutcome) error {
+	if outcome.Status != StageRunStatusCompleted && outcome.Status != StageRunStatusFailed {
+		return &IllegalTransitionError{StageRunID: id, From: StageRunStatusRunning, To: outcome.Status}
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE stage_runs
+		SET status = $1, output_context = $2,
+		    error_class = COALESCE($3, error_class), last_error = COALESCE($4, last_error),
+		    lease_owner = NULL, lease_expires_at = NULL, completed_at = $5, updated_at = $5
+		WHERE stage_run_id = $6 AND lease_owner = $7 AND status = $8
+		RETURNING project_id, stage_name, attempt
+	`
+	run := &StageRun{ID: id, Status: outcome.Status}
+	err = tx.QueryRowContext(ctx, query,
+		outcome.Status,
+		outcome.Output,
+		sql.NullString{String: outcome.ErrorClass, Valid: outcome.ErrorClass != ""},
+		sql.NullString{String: outcome.Error, Valid: outcome.Error != ""},
+		time.Now(),
+		id,
+		owner,
+		StageRunStatusRunning,
+	).Scan(&run.ProjectID, &run.StageName, &run.Attempt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("stage run %s: %w", id, ErrLeaseLost)
+		}
+		return fmt.Errorf("failed to finish stage run: %w", err)
+	}
+	if err := enqueueStageRunEvent(ctx, tx, run, StageRunStatusRunning); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run outcome: %w", err)
+	}
+	return nil
+}
+
+// FailExpiredStageRuns fails running runs whose lease expired, because the
+// replica executing them died or stalled, with the given error class and
+// message, and returns them. The lost attempt counts against the stage's
+// retry policy like any other failure, so a stage that keeps crashing its
+// executor eventually fails the project instead of being retried forever.
+func (s *StageRunStore) FailExpiredStageRuns(ctx context.Context, class, message string) ([]*StageRun, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE stage_runs
+		SET status = $1, error_class = $2, last_error = $3,
+		    lease_owner = NULL, lease_expires_at = NULL, completed_at = now(), updated_at = now()
+		WHERE status = $4 AND lease_expires_at < now()
+		RETURNING stage_run_id, project_id, stage_name, attempt
+	`
+	rows, err := tx.QueryContext(ctx, query, StageRunStatusFailed, class, message, StageRunStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail expired stage runs: %w", err)
+	}
+	var runs []*StageRun
+	for rows.Next() {
+		run := &StageRun{Status: StageRunStatusFailed}
+		if err := rows.Scan(&run.ID, &run.ProjectID, &run.StageName, &run.Attempt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan expired stage run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fail expired stage runs: %w", err)
+	}
+
+	for _, run := range runs {
+		if err := enqueueStageRunEvent(ctx, tx, run, StageRunStatusRunning); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit expired stage runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ReviewFilter narrows and pages ListPendingReviews.
+type ReviewFilter struct {
+	// ProjectID matches runs of this project; when not valid, runs of every
+	// project match.
+	ProjectID uuid.NullUUID
+	// Limit caps the number of runs returned; zero means DefaultReviewPageSize.
+	Limit  int
+	Offset int
+}
+
+const (
+	DefaultReviewPageSize = 50
+	MaxReviewPageSize     = 500
+)
+
+// ListPendingReviews returns completed runs that require review, have passed
+// the quality gate and have not been reviewed yet, the longest waiting first.
+func (s *StageRunStore) ListPendingReviews(ctx context.Context, filter ReviewFilter) ([]*StageRun, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultReviewPageSize
+	}
+	if limit > MaxReviewPageSize {
+		limit = MaxReviewPageSize
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + stageRunColumns + `
+		FROM stage_runs
+		WHERE status = $1 AND review_required AND quality_checked_at IS NOT NULL
+		  AND ($2::uuid IS NULL OR project_id = $2)
+		ORDER BY completed_at, stage_run_id
+		LIMIT $3 OFFSET $4
+	`
+	return s.queryStageRuns(ctx, query, StageRunStatusCompleted, filter.ProjectID, limit, offset)
+}
+
+// ReviewStageRun records a reviewer's decision on a run awaiting review:
+// decision must be StageRunStatusApproved or StageRunStatusRejected. A
+// rejection may pass rerun, a new run of the same stage that is created in the
+// same transaction and linked to the rejected run; rerun must be nil for an
+// approval. It fails with ErrReviewNotPending when the run does not require
+// review, has not been through the quality gate yet or was already decided on,
+// and with ErrStageRunNotFound when it does not exist.
+func (s *StageRunStore) ReviewStageRun(ctx context.Context, id uuid.UUID, decision StageRunStatus, reviewer, comment string, rerun *StageRun) error {
+	if decision != StageRunStatusApproved && decision != StageRunStatusRejected {
+		return fmt.Errorf("invalid review decision %q", decision)
+	}
+	if rerun != nil && decision != StageRunStatusRejected {
+		return errors.New("only a rejected stage run can be rerun")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE stage_runs
+		SET status = $1, reviewed_by = $2, review_comment = $3, reviewed_at = now(), updated_at = now()
+		WHERE stage_run_id = $4 AND status = $5 AND review_required AND quality_checked_at IS NOT NULL
+		RETURNING project_id, stage_name, attempt
+	`
+	run := &StageRun{ID: id, Status: decision}
+	err = tx.QueryRowContext(ctx, query, decision, reviewer, sql.NullString{String: comment, Valid: comment != ""}, id, StageRunStatusCompleted).
+		Scan(&run.ProjectID, &run.StageName, &run.Attempt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return s.reviewError(ctx, id)
+		}
+		return fmt.Errorf("failed to review stage run: %w", err)
+	}
+	if err := enqueueStageRunEvent(ctx, tx, run, StageRunStatusCompleted); err != nil {
+		return err
+	}
+	if rerun != nil {
+		if rerun.ProjectID != run.ProjectID || rerun.StageName != run.StageName {
+			return fmt.Errorf("rerun of stage run %s must be for stage %s of project %s", id, run.StageName, run.ProjectID)
+		}
+		rerun.PreviousRunID = uuid.NullUUID{UUID: id, Valid: true}
+		if err := insertStageRun(ctx, tx, rerun); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run review: %w", err)
+	}
+	return nil
+}
+
+// reviewError explains why a review matched no run.
+func (s *StageRunStore) reviewError(ctx context.Context, id uuid.UUID) error {
+	run, err := s.GetStageRun(ctx, id)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return fmt.Errorf("stage run %s: %w", id, ErrStageRunNotFound)
+	}
+	if !run.ReviewRequired {
+		return fmt.Errorf("stage %s does not require review: %w", run.StageName, ErrReviewNotPending)
+	}
+	if run.Status == StageRunStatusCompleted && !run.QualityCheckedAt.Valid {
+		return fmt.Errorf("stage run %s has not been quality checked yet: %w", id, ErrReviewNotPending)
+	}
+	return fmt.Errorf("stage run %s is %s: %w", id, run.Status, ErrReviewNotPending)
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type StageRunStatus string
@@ -23,16 +24,31 @@ const (
 )
 
 type StageRun struct {
-	ID            uuid.UUID       `json:"id"`
-	ProjectID     uuid.UUID       `json:"project_id"`
-	StageName     string          `json:"stage_name"`
-	Status        StageRunStatus  `json:"status"`
-	InputContext  json.RawMessage `json:"input_context"`  // JSONB type
-	OutputContext json.RawMessage `json:"output_context"` // JSONB type
-	StartedAt     sql.NullTime    `json:"started_at"`
-	CompletedAt   sql.NullTime    `json:"completed_at"`
-	CreatedAt     time.Time       `json:"created_at"`
-	UpdatedAt     time.Time       `json:"updated_at"`
+	ID                 uuid.UUID       `json:"id"`
+	ProjectID          uuid.UUID       `json:"project_id"`
+	StageName          string          `json:"stage_name"`
+	PersonaVersionID   uuid.NullUUID   `json:"persona_version_id"`
+	Status             StageRunStatus  `json:"status"`
+	Prompt             sql.NullString  `json:"prompt"`
+	Attempt            int             `json:"attempt"`
+	LastError          sql.NullString  `json:"last_error"`
+	ErrorClass         sql.NullString  `json:"error_class"`
+	NextAttemptAt      sql.NullTime    `json:"next_attempt_at"`
+	LeaseOwner         sql.NullString  `json:"lease_owner"`
+	LeaseExpiresAt     sql.NullTime    `json:"lease_expires_at"`
+	ReviewRequired     bool            `json:"review_required"` // completed run waits for approval
+	ReviewedBy         sql.NullString  `json:"reviewed_by"`
+	ReviewComment      sql.NullString  `json:"review_comment"`
+	ReviewedAt         sql.NullTime    `json:"reviewed_at"`
+	PreviousRunID      uuid.NullUUID   `json:"previous_run_id"` // rejected run this one reworks
+	QualityCheckedAt   sql.NullTime    `json:"quality_checked_at"`
+	OutputsPublishedAt sql.NullTime    `json:"outputs_published_at"`
+	InputContext       json.RawMessage `json:"input_context"`  // JSONB type
+	OutputContext      json.RawMessage `json:"output_context"` // JSONB type
+	StartedAt          sql.NullTime    `json:"started_at"`
+	CompletedAt        sql.NullTime    `json:"completed_at"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
 }
 
 type StageRunStore struct {
@@ -43,21 +59,48 @@ func NewStageRunStore(db *sql.DB) *StageRunStore {
 	return &StageRunStore{db: db}
 }
 
+// CreateStageRun stores a new pending run. It fails with ErrStageRunExists
+// while the stage already has a pending or running run in the project.
 func (s *StageRunStore) CreateStageRun(ctx context.Context, stageRun *StageRun) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertStageRun(ctx, tx, stageRun); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run creation: %w", err)
+	}
+	return nil
+}
+
+// insertStageRun stores a new pending run as part of tx.
+func insertStageRun(ctx context.Context, tx *sql.Tx, stageRun *StageRun) error {
 	stageRun.ID = uuid.New()
 	stageRun.Status = StageRunStatusPending
+	if stageRun.Attempt == 0 {
+		stageRun.Attempt = 1
+	}
 	stageRun.CreatedAt = time.Now()
 	stageRun.UpdatedAt = time.Now()
 
 	query := `
-		INSERT INTO stage_runs (stage_run_id, project_id, stage_name, status, input_context, output_context, started_at, completed_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO stage_runs (stage_run_id, project_id, stage_name, persona_version_id, status, prompt, attempt, review_required, previous_run_id, input_context, output_context, started_at, completed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
-	_, err := s.db.ExecContext(ctx, query,
+	_, err := tx.ExecContext(ctx, query,
 		stageRun.ID,
 		stageRun.ProjectID,
 		stageRun.StageName,
+		stageRun.PersonaVersionID,
 		stageRun.Status,
+		stageRun.Prompt,
+		stageRun.Attempt,
+		stageRun.ReviewRequired,
+		stageRun.PreviousRunID,
 		stageRun.InputContext,
 		stageRun.OutputContext,
 		stageRun.StartedAt,
@@ -66,30 +109,21 @@ func (s *StageRunStore) CreateStageRun(ctx context.Context, stageRun *StageRun)
 		stageRun.UpdatedAt,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("stage %s of project %s: %w", stageRun.StageName, stageRun.ProjectID, ErrStageRunExists)
+		}
 		return fmt.Errorf("failed to create stage run: %w", err)
 	}
-	return nil
+	return enqueueStageRunEvent(ctx, tx, stageRun, "")
 }
 
 func (s *StageRunStore) GetStageRun(ctx context.Context, id uuid.UUID) (*StageRun, error) {
-	stageRun := &StageRun{}
 	query := `
-		SELECT stage_run_id, project_id, stage_name, status, input_context, output_context, started_at, completed_at, created_at, updated_at
+		SELECT ` + stageRunColumns + `
 		FROM stage_runs
 		WHERE stage_run_id = $1
 	`
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&stageRun.ID,
-		&stageRun.ProjectID,
-		&stageRun.StageName,
-		&stageRun.Status,
-		&stageRun.InputContext,
-		&stageRun.OutputContext,
-		&stageRun.StartedAt,
-		&stageRun.CompletedAt,
-		&stageRun.CreatedAt,
-		&stageRun.UpdatedAt,
-	)
+	stageRun, err := scanStageRun(s.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Stage run not found
@@ -99,15 +133,279 @@ func (s *StageRunStore) GetStageRun(ctx context.Context, id uuid.UUID) (*StageRu
 	return stageRun, nil
 }
 
+// UpdateStageRunStatus moves a stage run to status. The update only applies
+// if the run's current status may transition to status, checked in the same
+// statement so concurrent writers cannot both win; otherwise it fails with an
+// *IllegalTransitionError.
 func (s *StageRunStore) UpdateStageRunStatus(ctx context.Context, id uuid.UUID, status StageRunStatus, startedAt, completedAt sql.NullTime) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		UPDATE stage_runs
+		UPDATE stage_runs r
 		SET status = $1, started_at = $2, completed_at = $3, updated_at = $4
-		WHERE stage_run_id = $5
+		FROM (
+			SELECT stage_run_id, status
+			FROM stage_runs
+			WHERE stage_run_id = $5 AND status = ANY($6::stage_run_status[])
+			FOR UPDATE
+		) previous
+		WHERE r.stage_run_id = previous.stage_run_id
+		RETURNING previous.status, r.project_id, r.stage_name, r.attempt
 	`
-	_, err := s.db.ExecContext(ctx, query, status, startedAt, completedAt, time.Now(), id)
+	run := &StageRun{ID: id, Status: status}
+	var from StageRunStatus
+	err = tx.QueryRowContext(ctx, query, status, startedAt, completedAt, time.Now(), id, pq.Array(statusesTransitioningTo(status))).
+		Scan(&from, &run.ProjectID, &run.StageName, &run.Attempt)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return s.transitionError(ctx, id, status)
+		}
 		return fmt.Errorf("failed to update stage run status: %w", err)
 	}
+	if err := enqueueStageRunEvent(ctx, tx, run, from); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run status update: %w", err)
+	}
 	return nil
 }
+
+// transitionError explains why a conditional status update matched no row.
+func (s *StageRunStore) transitionError(ctx context.Context, id uuid.UUID, to StageRunStatus) error {
+	var current StageRunStatus
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM stage_runs WHERE stage_run_id = $1`, id).Scan(&current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("stage run %s: %w", id, ErrStageRunNotFound)
+		}
+		return fmt.Errorf("failed to get stage run status: %w", err)
+	}
+	return &IllegalTransitionError{StageRunID: id, From: current, To: to}
+}
+
+// RecordStageRunError stores why the current attempt of a stage run failed.
+func (s *StageRunStore) RecordStageRunError(ctx context.Context, id uuid.UUID, class, message string) error {
+	query := `
+		UPDATE stage_runs
+		SET error_class = $1, last_error = $2, updated_at = $3
+		WHERE stage_run_id = $4
+	`
+	_, err := s.db.ExecContext(ctx, query, class, message, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to record stage run error: %w", err)
+	}
+	return nil
+}
+
+// RequeueStageRun moves a failed run back to pending for its next attempt,
+// which executors pick up no earlier than nextAttemptAt. The last error is
+// kept for reference. It fails with an *IllegalTransitionError unless the run
+// is failed.
+func (s *StageRunStore) RequeueStageRun(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE stage_runs
+		SET status = $1, attempt = attempt + 1, next_attempt_at = $2,
+		    output_context = NULL, started_at = NULL, completed_at = NULL, updated_at = $3
+		WHERE stage_run_id = $4 AND status = $5
+		RETURNING project_id, stage_name, attempt
+	`
+	run := &StageRun{ID: id, Status: StageRunStatusPending}
+	err = tx.QueryRowContext(ctx, query, StageRunStatusPending, nextAttemptAt, time.Now(), id, StageRunStatusFailed).
+		Scan(&run.ProjectID, &run.StageName, &run.Attempt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return s.transitionError(ctx, id, StageRunStatusPending)
+		}
+		return fmt.Errorf("failed to requeue stage run: %w", err)
+	}
+	if err := enqueueStageRunEvent(ctx, tx, run, StageRunStatusFailed); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stage run requeue: %w", err)
+	}
+	return nil
+}
+
+// MarkStageRunQualityChecked records that the quality gate has evaluated a
+// completed run. Marking a run twice keeps the first time.
+func (s *StageRunStore) MarkStageRunQualityChecked(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE stage_runs
+		SET quality_checked_at = $1, updated_at = $1
+		WHERE stage_run_id = $2 AND quality_checked_at IS NULL
+	`
+	_, err := s.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark stage run quality checked: %w", err)
+	}
+	return nil
+}
+
+// ListUncheckedStageRuns returns completed runs of running projects that the
+// quality gate has not evaluated and that completed before completedBefore,
+// oldest first.
+func (s *StageRunStore) ListUncheckedStageRuns(ctx context.Context, completedBefore time.Time) ([]*StageRun, error) {
+	query := `
+		SELECT ` + stageRunColumns + `
+		FROM stage_runs
+		WHERE status = $1 AND quality_checked_at IS NULL AND completed_at < $2
+		  AND project_id IN (SELECT project_id FROM projects WHERE status = $3)
+		ORDER BY completed_at, stage_run_id
+	`
+	return s.queryStageRuns(ctx, query, StageRunStatusCompleted, completedBefore, ProjectStatusRunning)
+}
+
+// MarkStageRunOutputsPublished records that a run's declared outputs were
+// published to the Context Bus. Marking a run twice keeps the first time.
+func (s *StageRunStore) MarkStageRunOutputsPublished(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE stage_runs
+		SET outputs_published_at = $1, updated_at = $1
+		WHERE stage_run_id = $2 AND outputs_published_at IS NULL
+	`
+	_, err := s.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark stage run outputs published: %w", err)
+	}
+	return nil
+}
+
+// ListUnpublishedStageRuns returns runs of running projects that succeeded,
+// passed the quality gate and last changed before changedBefore, but whose
+// outputs were not published, oldest first. A run succeeded when it was
+// approved, or completed without requiring review.
+func (s *StageRunStore) ListUnpublishedStageRuns(ctx context.Context, changedBefore time.Time) ([]*StageRun, error) {
+	query := `
+		SELECT ` + stageRunColumns + `
+		FROM stage_runs
+		WHERE outputs_published_at IS NULL AND quality_checked_at IS NOT NULL
+		  AND (status = $1 OR (status = $2 AND NOT review_required))
+		  AND updated_at < $3
+		  AND project_id IN (SELECT project_id FROM projects WHERE status = $4)
+		ORDER BY updated_at, stage_run_id
+	`
+	return s.queryStageRuns(ctx, query, StageRunStatusApproved, StageRunStatusCompleted, changedBefore, ProjectStatusRunning)
+}
+
+// ListStageRunsByProject returns every stage run of a project, oldest first.
+func (s *StageRunStore) ListStageRunsByProject(ctx context.Context, projectID uuid.UUID) ([]*StageRun, error) {
+	query := `
+		SELECT ` + stageRunColumns + `
+		FROM stage_runs
+		WHERE project_id = $1
+		ORDER BY created_at, stage_run_id
+	`
+	return s.queryStageRuns(ctx, query, projectID)
+}
+
+// StageRunFilter pages ListStageRuns.
+type StageRunFilter struct {
+	ProjectID uuid.UUID
+	// Limit caps the number of runs returned; zero means DefaultStageRunPageSize.
+	Limit  int
+	Offset int
+}
+
+const (
+	DefaultStageRunPageSize = 50
+	MaxStageRunPageSize     = 500
+)
+
+// ListStageRuns returns a page of a project's stage runs, oldest first.
+func (s *StageRunStore) ListStageRuns(ctx context.Context, filter StageRunFilter) ([]*StageRun, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultStageRunPageSize
+	}
+	if limit > MaxStageRunPageSize {
+		limit = MaxStageRunPageSize
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := `
+		SELECT ` + stageRunColumns + `
+		FROM stage_runs
+		WHERE project_id = $1
+		ORDER BY created_at, stage_run_id
+		LIMIT $2 OFFSET $3
+	`
+	return s.queryStageRuns(ctx, query, filter.ProjectID, limit, offset)
+}
+
+func (s *StageRunStore) queryStageRuns(ctx context.Context, query string, args ...interface{}) ([]*StageRun, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stage runs: %w", err)
+	}
+	defer rows.Close()
+
+	var stageRuns []*StageRun
+	for rows.Next() {
+		stageRun, err := scanStageRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stage run: %w", err)
+		}
+		stageRuns = append(stageRuns, stageRun)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stage runs: %w", err)
+	}
+	return stageRuns, nil
+}
+
+const stageRunColumns = `stage_run_id, project_id, stage_name, persona_version_id, status, prompt, attempt, last_error, error_class, next_attempt_at, lease_owner, lease_expires_at, review_required, reviewed_by, review_comment, reviewed_at, previous_run_id, quality_checked_at, outputs_published_at, input_context, output_context, started_at, completed_at, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanStageRun(row rowScanner) (*StageRun, error) {
+	stageRun := &StageRun{}
+	err := row.Scan(
+		&stageRun.ID,
+		&stageRun.ProjectID,
+		&stageRun.StageName,
+		&stageRun.PersonaVersionID,
+		&stageRun.Status,
+		&stageRun.Prompt,
+		&stageRun.Attempt,
+		&stageRun.LastError,
+		&stageRun.ErrorClass,
+		&stageRun.NextAttemptAt,
+		&stageRun.LeaseOwner,
+		&stageRun.LeaseExpiresAt,
+		&stageRun.ReviewRequired,
+		&stageRun.ReviewedBy,
+		&stageRun.ReviewComment,
+		&stageRun.ReviewedAt,
+		&stageRun.PreviousRunID,
+		&stageRun.QualityCheckedAt,
+		&stageRun.OutputsPublishedAt,
+		&stageRun.InputContext,
+		&stageRun.OutputContext,
+		&stageRun.StartedAt,
+		&stageRun.CompletedAt,
+		&stageRun.CreatedAt,
+		&stageRun.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return stageRun, nil
+}
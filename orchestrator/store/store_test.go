@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json" // Import for json.RawMessage
+	"errors"
 	"log"
 	"os"
 	"testing"
@@ -66,7 +67,7 @@ func TestMain(m *testing.M) {
 }
 
 func clearTables(db *sql.DB) {
-	_, err := db.Exec("TRUNCATE TABLE projects, personas, stage_runs RESTART IDENTITY CASCADE;")
+	_, err := db.Exec("TRUNCATE TABLE projects, personas, stage_runs, workflows, context_entries, rubrics, stage_run_evaluations, persona_prompt_drafts, persona_versions, prompt_partials, project_events, outbox, processed_events RESTART IDENTITY CASCADE;")
 	if err != nil {
 		log.Printf("Failed to truncate tables: %v", err)
 	}
@@ -115,6 +116,34 @@ func TestProjectStore_CreateAndGetProject(t *testing.T) {
 	}
 }
 
+func TestProjectStore_CreateProjectKeepsCallerID(t *testing.T) {
+	clearTables(testDB)
+
+	store := NewProjectStore(testDB)
+	ctx := context.Background()
+
+	projectID := uuid.New()
+	project := &Project{
+		ID:   projectID,
+		Name: "Project With Chosen ID",
+	}
+	err := store.CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if project.ID != projectID {
+		t.Fatalf("Expected project ID %s to be kept, got %s", projectID, project.ID)
+	}
+
+	retrievedProject, err := store.GetProject(ctx, projectID)
+	if err != nil {
+		t.Fatalf("GetProject failed: %v", err)
+	}
+	if retrievedProject == nil {
+		t.Fatal("Retrieved project is nil")
+	}
+}
+
 func TestProjectStore_UpdateProjectStatus(t *testing.T) {
 	clearTables(testDB)
 
@@ -130,7 +159,7 @@ func TestProjectStore_UpdateProjectStatus(t *testing.T) {
 	}
 
 	newStatus := ProjectStatusRunning
-	err = store.UpdateProjectStatus(ctx, project.ID, newStatus)
+	err = store.UpdateProjectStatus(ctx, project.ID, newStatus, "tester", "workflow started")
 	if err != nil {
 		t.Fatalf("UpdateProjectStatus failed: %v", err)
 	}
@@ -145,6 +174,72 @@ func TestProjectStore_UpdateProjectStatus(t *testing.T) {
 	if retrievedProject.UpdatedAt.Equal(project.UpdatedAt) {
 		t.Errorf("UpdatedAt was not updated")
 	}
+
+	err = store.UpdateProjectStatus(ctx, project.ID, ProjectStatusCreated, "tester", "")
+	var transitionErr *IllegalProjectTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("Expected *IllegalProjectTransitionError, got %v", err)
+	}
+	if transitionErr.From != ProjectStatusRunning {
+		t.Errorf("Expected transition from %s, got %s", ProjectStatusRunning, transitionErr.From)
+	}
+
+	projectEvents, err := store.ListProjectEvents(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("ListProjectEvents failed: %v", err)
+	}
+	if len(projectEvents) != 2 {
+		t.Fatalf("Expected 2 project events, got %d", len(projectEvents))
+	}
+	if projectEvents[0].FromStatus.Valid || projectEvents[0].ToStatus != ProjectStatusCreated {
+		t.Errorf("Expected creation event first, got %+v", projectEvents[0])
+	}
+	started := projectEvents[1]
+	if started.FromStatus.String != string(ProjectStatusCreated) || started.ToStatus != ProjectStatusRunning ||
+		started.Actor != "tester" || started.Reason.String != "workflow started" {
+		t.Errorf("Unexpected transition event %+v", started)
+	}
+}
+
+func TestProjectStore_ListProjects(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+
+	var projects []*Project
+	for _, name := range []string{"First", "Second", "Third"} {
+		project := &Project{Name: name}
+		if err := projectStore.CreateProject(ctx, project); err != nil {
+			t.Fatalf("CreateProject failed: %v", err)
+		}
+		projects = append(projects, project)
+	}
+	if err := projectStore.UpdateProjectStatus(ctx, projects[0].ID, ProjectStatusRunning, "test", "started"); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+
+	page, err := projectStore.ListProjects(ctx, ProjectFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(page) != 2 || page[0].Name != "Third" || page[1].Name != "Second" {
+		t.Fatalf("Expected the two newest projects, got %+v", page)
+	}
+	page, err = projectStore.ListProjects(ctx, ProjectFilter{Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "First" {
+		t.Errorf("Expected the oldest project on the second page, got %+v", page)
+	}
+
+	running, err := projectStore.ListProjects(ctx, ProjectFilter{Status: ProjectStatusRunning})
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(running) != 1 || running[0].ID != projects[0].ID {
+		t.Errorf("Expected only %s to be running, got %+v", projects[0].ID, running)
+	}
 }
 
 func TestPersonaStore_CreateAndGetPersona(t *testing.T) {
@@ -303,3 +398,1303 @@ func TestStageRunStore_UpdateStageRunStatus(t *testing.T) {
 		t.Errorf("CompletedAt was not updated correctly after setting completed status")
 	}
 }
+
+func TestWorkflowStore_UpsertAndGetWorkflow(t *testing.T) {
+	clearTables(testDB)
+
+	store := NewWorkflowStore(testDB)
+	ctx := context.Background()
+
+	workflow := &Workflow{
+		Name:       "test-workflow",
+		Definition: json.RawMessage(`{"name": "test-workflow", "stages": [{"name": "plan", "persona": "architect"}]}`),
+	}
+	err := store.UpsertWorkflow(ctx, workflow)
+	if err != nil {
+		t.Fatalf("UpsertWorkflow failed: %v", err)
+	}
+	if workflow.ID == uuid.Nil {
+		t.Fatal("Workflow ID was not generated")
+	}
+	firstID := workflow.ID
+
+	updated := &Workflow{
+		Name:        "test-workflow",
+		Description: sql.NullString{String: "second revision", Valid: true},
+		Definition:  json.RawMessage(`{"name": "test-workflow", "stages": [{"name": "build", "persona": "developer"}]}`),
+	}
+	err = store.UpsertWorkflow(ctx, updated)
+	if err != nil {
+		t.Fatalf("UpsertWorkflow (update) failed: %v", err)
+	}
+	if updated.ID != firstID {
+		t.Errorf("Expected upsert to keep workflow ID %s, got %s", firstID, updated.ID)
+	}
+
+	retrieved, err := store.GetWorkflowByName(ctx, "test-workflow")
+	if err != nil {
+		t.Fatalf("GetWorkflowByName failed: %v", err)
+	}
+	if retrieved == nil {
+		t.Fatal("Retrieved workflow is nil")
+	}
+	if retrieved.Description.String != "second revision" {
+		t.Errorf("Expected description %q, got %q", "second revision", retrieved.Description.String)
+	}
+
+	projectStore := NewProjectStore(testDB)
+	project := &Project{
+		Name:       "Project With Workflow",
+		WorkflowID: uuid.NullUUID{UUID: retrieved.ID, Valid: true},
+	}
+	err = projectStore.CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	retrievedProject, err := projectStore.GetProject(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("GetProject failed: %v", err)
+	}
+	if !retrievedProject.WorkflowID.Valid || retrievedProject.WorkflowID.UUID != retrieved.ID {
+		t.Errorf("Expected project workflow %s, got %v", retrieved.ID, retrievedProject.WorkflowID)
+	}
+}
+
+func TestPersonaStore_ExistingPersonaNames(t *testing.T) {
+	clearTables(testDB)
+
+	store := NewPersonaStore(testDB)
+	ctx := context.Background()
+
+	err := store.CreatePersona(ctx, &Persona{Name: "architect", PromptTemplate: "Design it."})
+	if err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+
+	existing, err := store.ExistingPersonaNames(ctx, []string{"architect", "ghost"})
+	if err != nil {
+		t.Fatalf("ExistingPersonaNames failed: %v", err)
+	}
+	if !existing["architect"] {
+		t.Error("Expected architect to exist")
+	}
+	if existing["ghost"] {
+		t.Error("Expected ghost not to exist")
+	}
+}
+
+func TestStageRunStore_ListStageRunsByProject(t *testing.T) {
+	clearTables(testDB)
+
+	projectStore := NewProjectStore(testDB)
+	ctx := context.Background()
+	project := &Project{Name: "Project for StageRun Listing"}
+	err := projectStore.CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("Failed to create project for stage run listing test: %v", err)
+	}
+
+	store := NewStageRunStore(testDB)
+	for _, stageName := range []string{"plan", "build"} {
+		err = store.CreateStageRun(ctx, &StageRun{ProjectID: project.ID, StageName: stageName})
+		if err != nil {
+			t.Fatalf("CreateStageRun failed: %v", err)
+		}
+	}
+
+	stageRuns, err := store.ListStageRunsByProject(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("ListStageRunsByProject failed: %v", err)
+	}
+	if len(stageRuns) != 2 {
+		t.Fatalf("Expected 2 stage runs, got %d", len(stageRuns))
+	}
+	if stageRuns[0].StageName != "plan" || stageRuns[1].StageName != "build" {
+		t.Errorf("Expected stage runs in creation order, got %s, %s", stageRuns[0].StageName, stageRuns[1].StageName)
+	}
+}
+
+func TestContextEntryStore_AppendAndGetVersions(t *testing.T) {
+	clearTables(testDB)
+
+	projectStore := NewProjectStore(testDB)
+	ctx := context.Background()
+	project := &Project{Name: "Project for Context Entries"}
+	err := projectStore.CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("Failed to create project for context entry test: %v", err)
+	}
+
+	store := NewContextEntryStore(testDB)
+	for _, value := range []string{`{"languages": ["Go"]}`, `{"languages": ["Go", "SQL"]}`} {
+		entry := &ContextEntry{
+			ProjectID: project.ID,
+			Key:       "tech_stack",
+			Kind:      "tech_stack",
+			Value:     json.RawMessage(value),
+		}
+		err = store.AppendContextEntry(ctx, entry)
+		if err != nil {
+			t.Fatalf("AppendContextEntry failed: %v", err)
+		}
+	}
+	err = store.AppendContextEntry(ctx, &ContextEntry{
+		ProjectID: project.ID,
+		Key:       "risks",
+		Kind:      "risks",
+		Value:     json.RawMessage(`{"items": []}`),
+	})
+	if err != nil {
+		t.Fatalf("AppendContextEntry failed: %v", err)
+	}
+
+	latest, err := store.GetLatestContextEntry(ctx, project.ID, "tech_stack")
+	if err != nil {
+		t.Fatalf("GetLatestContextEntry failed: %v", err)
+	}
+	if latest == nil || latest.Version != 2 {
+		t.Fatalf("Expected latest version 2, got %+v", latest)
+	}
+
+	first, err := store.GetContextEntry(ctx, project.ID, "tech_stack", 1)
+	if err != nil {
+		t.Fatalf("GetContextEntry failed: %v", err)
+	}
+	if first == nil || first.Version != 1 {
+		t.Fatalf("Expected version 1, got %+v", first)
+	}
+
+	snapshot, err := store.ListLatestContextEntries(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("ListLatestContextEntries failed: %v", err)
+	}
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(snapshot))
+	}
+
+	versions, err := store.ListContextEntryVersions(ctx, project.ID, "tech_stack")
+	if err != nil {
+		t.Fatalf("ListContextEntryVersions failed: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("Expected 2 versions, got %d", len(versions))
+	}
+}
+
+func TestRubricStore_AndEvaluationStore(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	persona := &Persona{Name: "architect", PromptTemplate: "Design it."}
+	err := NewPersonaStore(testDB).CreatePersona(ctx, persona)
+	if err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+
+	rubricStore := NewRubricStore(testDB)
+	rubric := &Rubric{
+		PersonaID: persona.ID,
+		Name:      "architecture-review",
+		Criteria:  json.RawMessage(`[{"name": "completeness", "weight": 1}]`),
+		Threshold: 0.7,
+		OnFailure: "rerun",
+		MaxReruns: 2,
+	}
+	err = rubricStore.CreateRubric(ctx, rubric)
+	if err != nil {
+		t.Fatalf("CreateRubric failed: %v", err)
+	}
+
+	retrievedRubric, err := rubricStore.GetRubricByPersonaName(ctx, "architect")
+	if err != nil {
+		t.Fatalf("GetRubricByPersonaName failed: %v", err)
+	}
+	if retrievedRubric == nil || retrievedRubric.ID != rubric.ID {
+		t.Fatalf("Expected rubric %s, got %+v", rubric.ID, retrievedRubric)
+	}
+	if retrievedRubric.MaxReruns != 2 {
+		t.Errorf("Expected max reruns 2, got %d", retrievedRubric.MaxReruns)
+	}
+
+	project := &Project{Name: "Project for Evaluations"}
+	err = NewProjectStore(testDB).CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	stageRun := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	err = NewStageRunStore(testDB).CreateStageRun(ctx, stageRun)
+	if err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+
+	evaluationStore := NewEvaluationStore(testDB)
+	evaluation := &Evaluation{
+		StageRunID:   stageRun.ID,
+		RubricID:     uuid.NullUUID{UUID: rubric.ID, Valid: true},
+		Scores:       json.RawMessage(`[{"criterion": "completeness", "score": 0.5}]`),
+		OverallScore: 0.5,
+		Verdict:      EvaluationVerdictFail,
+		Comments:     sql.NullString{String: "completeness: missing risks", Valid: true},
+	}
+	err = evaluationStore.CreateEvaluation(ctx, evaluation)
+	if err != nil {
+		t.Fatalf("CreateEvaluation failed: %v", err)
+	}
+
+	evaluations, err := evaluationStore.ListEvaluationsByStageRun(ctx, stageRun.ID)
+	if err != nil {
+		t.Fatalf("ListEvaluationsByStageRun failed: %v", err)
+	}
+	if len(evaluations) != 1 {
+		t.Fatalf("Expected 1 evaluation, got %d", len(evaluations))
+	}
+	if evaluations[0].Verdict != EvaluationVerdictFail {
+		t.Errorf("Expected verdict %s, got %s", EvaluationVerdictFail, evaluations[0].Verdict)
+	}
+}
+
+func TestPromptDraftStore_AcceptAndReject(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	personaStore := NewPersonaStore(testDB)
+	persona := &Persona{Name: "architect", PromptTemplate: "Design it."}
+	err := personaStore.CreatePersona(ctx, persona)
+	if err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+
+	draftStore := NewPromptDraftStore(testDB, personaStore)
+	draft := &PromptDraft{
+		PersonaID:              persona.ID,
+		BasePromptTemplate:     "Design it.",
+		ProposedPromptTemplate: "Design it.\n\n## Quality guidelines\n- completeness",
+		Rationale:              sql.NullString{String: "completeness failed 3 times", Valid: true},
+	}
+	err = draftStore.CreatePromptDraft(ctx, draft)
+	if err != nil {
+		t.Fatalf("CreatePromptDraft failed: %v", err)
+	}
+
+	pending, err := draftStore.GetPendingPromptDraft(ctx, persona.ID)
+	if err != nil {
+		t.Fatalf("GetPendingPromptDraft failed: %v", err)
+	}
+	if pending == nil || pending.ID != draft.ID {
+		t.Fatalf("Expected pending draft %s, got %+v", draft.ID, pending)
+	}
+
+	err = draftStore.AcceptPromptDraft(ctx, draft.ID, "maintainer")
+	if err != nil {
+		t.Fatalf("AcceptPromptDraft failed: %v", err)
+	}
+	retrievedPersona, err := personaStore.GetPersona(ctx, persona.ID)
+	if err != nil {
+		t.Fatalf("GetPersona failed: %v", err)
+	}
+	if retrievedPersona.PromptTemplate != draft.ProposedPromptTemplate {
+		t.Errorf("Expected persona prompt to be the accepted draft, got %q", retrievedPersona.PromptTemplate)
+	}
+	err = draftStore.RejectPromptDraft(ctx, draft.ID, "maintainer")
+	if !errors.Is(err, ErrDraftNotPending) {
+		t.Errorf("Expected ErrDraftNotPending, got %v", err)
+	}
+
+	outdated := &PromptDraft{
+		PersonaID:              persona.ID,
+		BasePromptTemplate:     "Design it.",
+		ProposedPromptTemplate: "Design it carefully.",
+	}
+	err = draftStore.CreatePromptDraft(ctx, outdated)
+	if err != nil {
+		t.Fatalf("CreatePromptDraft failed: %v", err)
+	}
+	err = draftStore.AcceptPromptDraft(ctx, outdated.ID, "maintainer")
+	if !errors.Is(err, ErrDraftOutdated) {
+		t.Errorf("Expected ErrDraftOutdated, got %v", err)
+	}
+	err = draftStore.RejectPromptDraft(ctx, outdated.ID, "maintainer")
+	if err != nil {
+		t.Fatalf("RejectPromptDraft failed: %v", err)
+	}
+	retrievedDraft, err := draftStore.GetPromptDraft(ctx, outdated.ID)
+	if err != nil {
+		t.Fatalf("GetPromptDraft failed: %v", err)
+	}
+	if retrievedDraft.Status != PromptDraftStatusRejected {
+		t.Errorf("Expected status %s, got %s", PromptDraftStatusRejected, retrievedDraft.Status)
+	}
+}
+
+func TestPersonaStore_VersionsAndRollback(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	personaStore := NewPersonaStore(testDB)
+	persona := &Persona{Name: "architect", PromptTemplate: "v1 prompt", ModelConfig: json.RawMessage(`{"model": "a"}`)}
+	err := personaStore.CreatePersona(ctx, persona)
+	if err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+
+	unchanged, err := personaStore.RevisePersona(ctx, persona.ID, "v1 prompt", json.RawMessage(`{"model":"a"}`))
+	if err != nil {
+		t.Fatalf("RevisePersona failed: %v", err)
+	}
+	if unchanged.Version != 1 {
+		t.Errorf("Expected unchanged revision to keep version 1, got %d", unchanged.Version)
+	}
+
+	second, err := personaStore.RevisePersona(ctx, persona.ID, "v2 prompt", json.RawMessage(`{"model": "b"}`))
+	if err != nil {
+		t.Fatalf("RevisePersona failed: %v", err)
+	}
+	if second.Version != 2 {
+		t.Errorf("Expected version 2, got %d", second.Version)
+	}
+
+	third, err := personaStore.RollbackPersona(ctx, persona.ID, 1)
+	if err != nil {
+		t.Fatalf("RollbackPersona failed: %v", err)
+	}
+	if third.Version != 3 || third.PromptTemplate != "v1 prompt" || third.RolledBackFrom.Int64 != 1 {
+		t.Errorf("Unexpected rollback version %+v", third)
+	}
+
+	retrieved, err := personaStore.GetPersona(ctx, persona.ID)
+	if err != nil {
+		t.Fatalf("GetPersona failed: %v", err)
+	}
+	if retrieved.CurrentVersion != 3 || retrieved.PromptTemplate != "v1 prompt" {
+		t.Errorf("Expected persona at version 3 with v1 prompt, got %d %q", retrieved.CurrentVersion, retrieved.PromptTemplate)
+	}
+
+	versions, err := personaStore.ListPersonaVersions(ctx, persona.ID)
+	if err != nil {
+		t.Fatalf("ListPersonaVersions failed: %v", err)
+	}
+	if len(versions) != 3 || versions[1].PromptTemplate != "v2 prompt" {
+		t.Errorf("Expected 3 versions with v2 unchanged, got %+v", versions)
+	}
+
+	current, err := personaStore.GetCurrentPersonaVersionByName(ctx, "architect")
+	if err != nil {
+		t.Fatalf("GetCurrentPersonaVersionByName failed: %v", err)
+	}
+	if current == nil || current.ID != third.ID {
+		t.Errorf("Expected current version %s, got %+v", third.ID, current)
+	}
+
+	_, err = personaStore.RollbackPersona(ctx, persona.ID, 9)
+	if !errors.Is(err, ErrPersonaVersionNotFound) {
+		t.Errorf("Expected ErrPersonaVersionNotFound, got %v", err)
+	}
+
+	project := &Project{Name: "Project for Persona Versions"}
+	err = NewProjectStore(testDB).CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	stageRunStore := NewStageRunStore(testDB)
+	stageRun := &StageRun{ProjectID: project.ID, StageName: "plan", PersonaVersionID: uuid.NullUUID{UUID: second.ID, Valid: true}}
+	err = stageRunStore.CreateStageRun(ctx, stageRun)
+	if err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+	retrievedRun, err := stageRunStore.GetStageRun(ctx, stageRun.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrievedRun.PersonaVersionID.UUID != second.ID {
+		t.Errorf("Expected persona version %s, got %v", second.ID, retrievedRun.PersonaVersionID)
+	}
+}
+
+func TestPersonaStore_ListUpdateAndDelete(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	personaStore := NewPersonaStore(testDB)
+	for _, name := range []string{"architect", "backend-dev", "frontend-dev"} {
+		persona := &Persona{Name: name, PromptTemplate: "You are " + name + ".", ModelConfig: json.RawMessage(`{"model": "gpt-4o"}`)}
+		if err := personaStore.CreatePersona(ctx, persona); err != nil {
+			t.Fatalf("CreatePersona failed: %v", err)
+		}
+	}
+
+	devs, err := personaStore.ListPersonas(ctx, PersonaFilter{NameContains: "DEV"})
+	if err != nil {
+		t.Fatalf("ListPersonas failed: %v", err)
+	}
+	if len(devs) != 2 || devs[0].Name != "backend-dev" {
+		t.Fatalf("Expected backend-dev and frontend-dev, got %d personas", len(devs))
+	}
+	page, err := personaStore.ListPersonas(ctx, PersonaFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListPersonas failed: %v", err)
+	}
+	if len(page) != 1 || page[0].Name != "backend-dev" {
+		t.Errorf("Expected second page to hold backend-dev, got %+v", page)
+	}
+
+	persona, err := personaStore.GetPersonaByName(ctx, "architect")
+	if err != nil {
+		t.Fatalf("GetPersonaByName failed: %v", err)
+	}
+	if persona == nil {
+		t.Fatal("Expected persona architect, got nil")
+	}
+	stale := *persona
+
+	persona.Description = sql.NullString{String: "Designs systems", Valid: true}
+	persona.PromptTemplate = "You are a senior architect."
+	err = personaStore.UpdatePersona(ctx, persona)
+	if err != nil {
+		t.Fatalf("UpdatePersona failed: %v", err)
+	}
+	if persona.CurrentVersion != 2 {
+		t.Errorf("Expected prompt change to create version 2, got %d", persona.CurrentVersion)
+	}
+
+	stale.Name = "lead-architect"
+	err = personaStore.UpdatePersona(ctx, &stale)
+	if !errors.Is(err, ErrPersonaConflict) {
+		t.Errorf("Expected ErrPersonaConflict, got %v", err)
+	}
+
+	workflow := &Workflow{Name: "delivery", Definition: json.RawMessage(`{"name": "delivery", "stages": [{"name": "design", "persona": "architect"}]}`)}
+	err = NewWorkflowStore(testDB).CreateWorkflow(ctx, workflow)
+	if err != nil {
+		t.Fatalf("CreateWorkflow failed: %v", err)
+	}
+	project := &Project{Name: "Active Project", WorkflowID: uuid.NullUUID{UUID: workflow.ID, Valid: true}}
+	err = NewProjectStore(testDB).CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	err = personaStore.DeletePersona(ctx, persona.ID)
+	if !errors.Is(err, ErrPersonaInUse) {
+		t.Errorf("Expected ErrPersonaInUse, got %v", err)
+	}
+	persona.Name = "lead-architect"
+	err = personaStore.UpdatePersona(ctx, persona)
+	if !errors.Is(err, ErrPersonaInUse) {
+		t.Errorf("Expected ErrPersonaInUse renaming a persona in use, got %v", err)
+	}
+	persona.Name = "architect"
+	persona.Description = sql.NullString{String: "Designs delivery systems", Valid: true}
+	err = personaStore.UpdatePersona(ctx, persona)
+	if err != nil {
+		t.Errorf("Expected a persona in use to stay editable under its name, got %v", err)
+	}
+
+	backend, err := personaStore.GetPersonaByName(ctx, "backend-dev")
+	if err != nil {
+		t.Fatalf("GetPersonaByName failed: %v", err)
+	}
+	err = personaStore.DeletePersona(ctx, backend.ID)
+	if err != nil {
+		t.Fatalf("DeletePersona failed: %v", err)
+	}
+	deleted, err := personaStore.GetPersona(ctx, backend.ID)
+	if err != nil {
+		t.Fatalf("GetPersona failed: %v", err)
+	}
+	if deleted != nil {
+		t.Errorf("Expected deleted persona to be gone, got %+v", deleted)
+	}
+}
+
+func TestPromptPartialStore_UpsertAndList(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	partialStore := NewPromptPartialStore(testDB)
+	partial := &PromptPartial{Name: "house-style", Body: "Answer in Markdown."}
+	err := partialStore.UpsertPromptPartial(ctx, partial)
+	if err != nil {
+		t.Fatalf("UpsertPromptPartial failed: %v", err)
+	}
+	replacement := &PromptPartial{Name: "house-style", Body: "Answer in plain text."}
+	err = partialStore.UpsertPromptPartial(ctx, replacement)
+	if err != nil {
+		t.Fatalf("UpsertPromptPartial failed: %v", err)
+	}
+	if replacement.ID != partial.ID {
+		t.Errorf("Expected upsert to keep ID %s, got %s", partial.ID, replacement.ID)
+	}
+
+	partials, err := partialStore.ListPromptPartials(ctx)
+	if err != nil {
+		t.Fatalf("ListPromptPartials failed: %v", err)
+	}
+	if len(partials) != 1 || partials[0].Body != "Answer in plain text." {
+		t.Errorf("Expected the replaced partial, got %+v", partials)
+	}
+}
+
+func TestPersonaStore_ValidatorRejectsPersona(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	personaStore := NewPersonaStore(testDB)
+	problem := errors.New("unknown variable .Foo")
+	personaStore.AddValidator(func(ctx context.Context, persona *Persona) error {
+		if persona.PromptTemplate == "{{.Foo}}" {
+			return problem
+		}
+		return nil
+	})
+
+	err := personaStore.CreatePersona(ctx, &Persona{Name: "broken", PromptTemplate: "{{.Foo}}"})
+	if !errors.Is(err, ErrInvalidPersona) || !errors.Is(err, problem) {
+		t.Errorf("Expected ErrInvalidPersona wrapping the validator error, got %v", err)
+	}
+
+	persona := &Persona{Name: "architect", PromptTemplate: "Design it."}
+	err = personaStore.CreatePersona(ctx, persona)
+	if err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+	_, err = personaStore.RevisePersona(ctx, persona.ID, "{{.Foo}}", nil)
+	if !errors.Is(err, ErrInvalidPersona) {
+		t.Errorf("Expected ErrInvalidPersona, got %v", err)
+	}
+
+	draftStore := NewPromptDraftStore(testDB, personaStore)
+	draft := &PromptDraft{PersonaID: persona.ID, BasePromptTemplate: "Design it.", ProposedPromptTemplate: "{{.Foo}}"}
+	if err := draftStore.CreatePromptDraft(ctx, draft); err != nil {
+		t.Fatalf("CreatePromptDraft failed: %v", err)
+	}
+	err = draftStore.AcceptPromptDraft(ctx, draft.ID, "maintainer")
+	if !errors.Is(err, ErrInvalidPersona) {
+		t.Errorf("Expected ErrInvalidPersona accepting an invalid draft, got %v", err)
+	}
+
+	// A version saved before the validator rejected it cannot be rolled back to.
+	unvalidated := NewPersonaStore(testDB)
+	if _, err := unvalidated.RevisePersona(ctx, persona.ID, "{{.Foo}}", nil); err != nil {
+		t.Fatalf("RevisePersona failed: %v", err)
+	}
+	if _, err := unvalidated.RevisePersona(ctx, persona.ID, "Design it.", nil); err != nil {
+		t.Fatalf("RevisePersona failed: %v", err)
+	}
+	_, err = personaStore.RollbackPersona(ctx, persona.ID, 2)
+	if !errors.Is(err, ErrInvalidPersona) {
+		t.Errorf("Expected ErrInvalidPersona rolling back to an invalid version, got %v", err)
+	}
+}
+
+func TestStageRunStore_ListStageRuns(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	project := &Project{Name: "Project for Executor"}
+	err := NewProjectStore(testDB).CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	stageRunStore := NewStageRunStore(testDB)
+	first := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	second := &StageRun{ProjectID: project.ID, StageName: "build"}
+	for _, run := range []*StageRun{first, second} {
+		if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+			t.Fatalf("CreateStageRun failed: %v", err)
+		}
+	}
+
+	all, err := stageRunStore.ListStageRuns(ctx, StageRunFilter{ProjectID: project.ID})
+	if err != nil {
+		t.Fatalf("ListStageRuns failed: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != first.ID {
+		t.Errorf("Expected both runs, oldest first, got %d runs", len(all))
+	}
+	page, err := stageRunStore.ListStageRuns(ctx, StageRunFilter{ProjectID: project.ID, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("ListStageRuns failed: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != second.ID {
+		t.Errorf("Expected the second page to hold the build run, got %d runs", len(page))
+	}
+}
+
+func TestStageRunStore_RequeueFailedRun(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	project := &Project{Name: "Retry Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	run := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+	if run.Attempt != 1 {
+		t.Errorf("Expected first attempt, got %d", run.Attempt)
+	}
+
+	err := stageRunStore.RequeueStageRun(ctx, run.ID, time.Now())
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Expected ErrIllegalTransition requeueing a pending run, got %v", err)
+	}
+
+	now := time.Now()
+	if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusRunning, sql.NullTime{Time: now, Valid: true}, sql.NullTime{}); err != nil {
+		t.Fatalf("UpdateStageRunStatus failed: %v", err)
+	}
+	if err := stageRunStore.RecordStageRunError(ctx, run.ID, "provider", "rate limited"); err != nil {
+		t.Fatalf("RecordStageRunError failed: %v", err)
+	}
+	if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusFailed, sql.NullTime{Time: now, Valid: true}, sql.NullTime{Time: now, Valid: true}); err != nil {
+		t.Fatalf("UpdateStageRunStatus failed: %v", err)
+	}
+	if err := stageRunStore.RequeueStageRun(ctx, run.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("RequeueStageRun failed: %v", err)
+	}
+
+	retrieved, err := stageRunStore.GetStageRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved.Status != StageRunStatusPending || retrieved.Attempt != 2 {
+		t.Errorf("Expected pending second attempt, got %s attempt %d", retrieved.Status, retrieved.Attempt)
+	}
+	if retrieved.LastError.String != "rate limited" || retrieved.ErrorClass.String != "provider" {
+		t.Errorf("Expected last error to be kept, got %q (%s)", retrieved.LastError.String, retrieved.ErrorClass.String)
+	}
+	if retrieved.StartedAt.Valid || retrieved.CompletedAt.Valid {
+		t.Error("Expected timestamps of the failed attempt to be cleared")
+	}
+
+	claimed, err := stageRunStore.ClaimStageRun(ctx, "replica-a", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimStageRun failed: %v", err)
+	}
+	if claimed != nil {
+		t.Errorf("Expected the run to wait for its backoff, claimed %s", claimed.ID)
+	}
+}
+
+func TestProcessedEventStore(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	processedEvents := NewProcessedEventStore(testDB)
+
+	eventID := uuid.New()
+	processed, err := processedEvents.IsEventProcessed(ctx, "orchestrator", eventID)
+	if err != nil || processed {
+		t.Fatalf("Expected a new event to be unprocessed, got %v, %v", processed, err)
+	}
+	inserted, err := processedEvents.MarkEventProcessed(ctx, "orchestrator", eventID, "project_created")
+	if err != nil || !inserted {
+		t.Fatalf("Expected MarkEventProcessed to record the event, got %v, %v", inserted, err)
+	}
+	inserted, err = processedEvents.MarkEventProcessed(ctx, "orchestrator", eventID, "project_created")
+	if err != nil || inserted {
+		t.Errorf("Expected a second mark to be a no-op, got %v, %v", inserted, err)
+	}
+	processed, err = processedEvents.IsEventProcessed(ctx, "orchestrator", eventID)
+	if err != nil || !processed {
+		t.Errorf("Expected the event to be processed, got %v, %v", processed, err)
+	}
+	processed, err = processedEvents.IsEventProcessed(ctx, "auditor", eventID)
+	if err != nil || processed {
+		t.Errorf("Expected other consumers to be tracked separately, got %v, %v", processed, err)
+	}
+
+	pruned, err := processedEvents.PruneProcessedEvents(ctx, time.Now().Add(time.Minute))
+	if err != nil || pruned != 1 {
+		t.Errorf("Expected one event pruned, got %d, %v", pruned, err)
+	}
+}
+
+func TestStore_RejectsDuplicates(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	project := &Project{ID: uuid.New(), Name: "Duplicate Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	err := projectStore.CreateProject(ctx, &Project{ID: project.ID, Name: "Duplicate Project"})
+	if !errors.Is(err, ErrProjectExists) {
+		t.Errorf("Expected ErrProjectExists, got %v", err)
+	}
+
+	first := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	if err := stageRunStore.CreateStageRun(ctx, first); err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+	err = stageRunStore.CreateStageRun(ctx, &StageRun{ProjectID: project.ID, StageName: "plan"})
+	if !errors.Is(err, ErrStageRunExists) {
+		t.Errorf("Expected ErrStageRunExists for a second active run, got %v", err)
+	}
+
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	if err := stageRunStore.UpdateStageRunStatus(ctx, first.ID, StageRunStatusFailed, sql.NullTime{}, now); err != nil {
+		t.Fatalf("UpdateStageRunStatus failed: %v", err)
+	}
+	if err := stageRunStore.CreateStageRun(ctx, &StageRun{ProjectID: project.ID, StageName: "plan"}); err != nil {
+		t.Errorf("Expected a new run once the first finished, got %v", err)
+	}
+
+	personaStore := NewPersonaStore(testDB)
+	if err := personaStore.CreatePersona(ctx, &Persona{Name: "Duplicate Persona", PromptTemplate: "Hello"}); err != nil {
+		t.Fatalf("CreatePersona failed: %v", err)
+	}
+	err = personaStore.CreatePersona(ctx, &Persona{Name: "Duplicate Persona", PromptTemplate: "Hello again"})
+	if !errors.Is(err, ErrPersonaExists) {
+		t.Errorf("Expected ErrPersonaExists, got %v", err)
+	}
+}
+
+func TestOutboxStore_RelaysStateChanges(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+	outboxStore := NewOutboxStore(testDB)
+
+	project := &Project{Name: "Outbox Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if err := projectStore.UpdateProjectStatus(ctx, project.ID, ProjectStatusRunning, "tester", ""); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+	run := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+	// A rejected transition must not leave an event behind.
+	if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusApproved, sql.NullTime{}, sql.NullTime{}); err == nil {
+		t.Fatal("Expected an illegal transition error")
+	}
+
+	publishErr := errors.New("redis down")
+	delivered, err := outboxStore.RelayOutbox(ctx, 10, func(ctx context.Context, msg *OutboxMessage) error {
+		return publishErr
+	})
+	if !errors.Is(err, publishErr) || delivered != 0 {
+		t.Fatalf("Expected the publish failure to be reported, got %d, %v", delivered, err)
+	}
+
+	var published []*OutboxMessage
+	delivered, err = outboxStore.RelayOutbox(ctx, 10, func(ctx context.Context, msg *OutboxMessage) error {
+		published = append(published, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RelayOutbox failed: %v", err)
+	}
+	if delivered != 3 || len(published) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(published))
+	}
+	wantTypes := []string{"project_status_changed", "project_status_changed", "stage_run_status_changed"}
+	for i, msg := range published {
+		if msg.EventType != wantTypes[i] {
+			t.Errorf("Expected event %d to be %s, got %s", i, wantTypes[i], msg.EventType)
+		}
+	}
+	if published[0].Attempts != 1 || !published[0].LastError.Valid {
+		t.Errorf("Expected the failed attempt to be recorded, got %d attempts", published[0].Attempts)
+	}
+	var changed struct {
+		Payload struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(published[1].Envelope, &changed); err != nil || changed.Payload.From != "created" || changed.Payload.To != "running" {
+		t.Errorf("Unexpected project status event %s", published[1].Envelope)
+	}
+
+	delivered, err = outboxStore.RelayOutbox(ctx, 10, func(ctx context.Context, msg *OutboxMessage) error {
+		t.Errorf("Expected no redelivery, got event %s", msg.EventID)
+		return nil
+	})
+	if err != nil || delivered != 0 {
+		t.Errorf("Expected an empty outbox, got %d, %v", delivered, err)
+	}
+
+	pruned, err := outboxStore.PruneOutbox(ctx, time.Now().Add(-time.Hour))
+	if err != nil || pruned != 0 {
+		t.Errorf("Expected recently delivered messages to be kept, got %d, %v", pruned, err)
+	}
+	pruned, err = outboxStore.PruneOutbox(ctx, time.Now().Add(time.Minute))
+	if err != nil || pruned != int64(len(published)) {
+		t.Errorf("Expected %d delivered messages to be pruned, got %d, %v", len(published), pruned, err)
+	}
+
+	// While another relay holds the lock nothing is published.
+	if err := projectStore.UpdateProjectStatus(ctx, project.ID, ProjectStatusCompleted, "test", "done"); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+	holder, err := testDB.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx failed: %v", err)
+	}
+	defer holder.Rollback()
+	if _, err := holder.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxRelayLock); err != nil {
+		t.Fatalf("Failed to take the relay lock: %v", err)
+	}
+	delivered, err = outboxStore.RelayOutbox(ctx, 10, func(ctx context.Context, msg *OutboxMessage) error {
+		t.Errorf("Expected no delivery while the relay lock is held, got event %s", msg.EventID)
+		return nil
+	})
+	if err != nil || delivered != 0 {
+		t.Errorf("Expected nothing to be relayed, got %d, %v", delivered, err)
+	}
+}
+
+func TestStageRunStore_Leases(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	project := &Project{Name: "Lease Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	run := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+
+	claimed, err := stageRunStore.ClaimStageRun(ctx, "replica-a", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimStageRun failed: %v", err)
+	}
+	if claimed == nil || claimed.ID != run.ID || claimed.Status != StageRunStatusRunning || claimed.LeaseOwner.String != "replica-a" {
+		t.Fatalf("Expected replica-a to claim the run, got %+v", claimed)
+	}
+	again, err := stageRunStore.ClaimStageRun(ctx, "replica-b", time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimStageRun failed: %v", err)
+	}
+	if again != nil {
+		t.Errorf("Expected no run left to claim, got %s", again.ID)
+	}
+
+	if err := stageRunStore.RenewStageRunLease(ctx, run.ID, "replica-a", time.Minute); err != nil {
+		t.Errorf("RenewStageRunLease failed: %v", err)
+	}
+	err = stageRunStore.RenewStageRunLease(ctx, run.ID, "replica-b", time.Minute)
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost renewing another replica's lease, got %v", err)
+	}
+
+	// Let the lease expire so the run fails.
+	if err := stageRunStore.RenewStageRunLease(ctx, run.ID, "replica-a", -time.Second); err != nil {
+		t.Fatalf("RenewStageRunLease failed: %v", err)
+	}
+	expired, err := stageRunStore.FailExpiredStageRuns(ctx, "internal", "lease expired")
+	if err != nil {
+		t.Fatalf("FailExpiredStageRuns failed: %v", err)
+	}
+	if len(expired) != 1 || expired[0].ID != run.ID {
+		t.Fatalf("Expected the run to fail, got %+v", expired)
+	}
+	retrieved, err := stageRunStore.GetStageRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved.Status != StageRunStatusFailed || retrieved.ErrorClass.String != "internal" || retrieved.LeaseOwner.Valid {
+		t.Errorf("Expected the expired run to fail as an internal error without a lease, got %+v", retrieved)
+	}
+	if err := stageRunStore.RequeueStageRun(ctx, run.ID, time.Now()); err != nil {
+		t.Fatalf("RequeueStageRun failed: %v", err)
+	}
+
+	claimed, err = stageRunStore.ClaimStageRun(ctx, "replica-a", time.Minute)
+	if err != nil || claimed == nil {
+		t.Fatalf("Expected replica-a to claim the requeued run, got %v, %v", claimed, err)
+	}
+	if claimed.Attempt != 2 {
+		t.Errorf("Expected the lost attempt to count, got attempt %d", claimed.Attempt)
+	}
+	// replica-a shuts down before the run finishes.
+	if err := stageRunStore.ReleaseStageRun(ctx, run.ID, "replica-a"); err != nil {
+		t.Fatalf("ReleaseStageRun failed: %v", err)
+	}
+	err = stageRunStore.ReleaseStageRun(ctx, run.ID, "replica-a")
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost releasing a released run, got %v", err)
+	}
+
+	claimed, err = stageRunStore.ClaimStageRun(ctx, "replica-b", time.Minute)
+	if err != nil || claimed == nil {
+		t.Fatalf("Expected replica-b to claim the released run, got %v, %v", claimed, err)
+	}
+	err = stageRunStore.FinishStageRun(ctx, run.ID, "replica-a", StageRunOutcome{Status: StageRunStatusCompleted})
+	if !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost finishing after losing the lease, got %v", err)
+	}
+	err = stageRunStore.FinishStageRun(ctx, run.ID, "replica-b", StageRunOutcome{
+		Status: StageRunStatusCompleted,
+		Output: json.RawMessage(`{"plan": "ship it"}`),
+	})
+	if err != nil {
+		t.Fatalf("FinishStageRun failed: %v", err)
+	}
+
+	retrieved, err = stageRunStore.GetStageRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved.Status != StageRunStatusCompleted || retrieved.LeaseOwner.Valid || !retrieved.CompletedAt.Valid {
+		t.Errorf("Expected a completed run without a lease, got %+v", retrieved)
+	}
+}
+
+func TestProjectStore_ListProjectsByStatus(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+
+	project := &Project{Name: "Running Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if err := projectStore.UpdateProjectStatus(ctx, project.ID, ProjectStatusRunning, "test", "started"); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+	idle := &Project{Name: "Idle Project"}
+	if err := projectStore.CreateProject(ctx, idle); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	running, err := projectStore.ListProjectsByStatus(ctx, ProjectStatusRunning)
+	if err != nil {
+		t.Fatalf("ListProjectsByStatus failed: %v", err)
+	}
+	if len(running) != 1 || running[0].ID != project.ID {
+		t.Fatalf("Expected only %s to be running, got %+v", project.ID, running)
+	}
+}
+
+func TestStageRunStore_QualityChecks(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	running := &Project{Name: "Running Project"}
+	idle := &Project{Name: "Idle Project"}
+	for _, project := range []*Project{running, idle} {
+		if err := projectStore.CreateProject(ctx, project); err != nil {
+			t.Fatalf("CreateProject failed: %v", err)
+		}
+	}
+	if err := projectStore.UpdateProjectStatus(ctx, running.ID, ProjectStatusRunning, "test", "started"); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+
+	started := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	completed := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	var runs []*StageRun
+	for i, project := range []*Project{running, running, idle} {
+		run := &StageRun{ProjectID: project.ID, StageName: []string{"draft", "edit", "draft"}[i]}
+		if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+			t.Fatalf("CreateStageRun failed: %v", err)
+		}
+		if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusRunning, started, sql.NullTime{}); err != nil {
+			t.Fatalf("UpdateStageRunStatus failed: %v", err)
+		}
+		if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusCompleted, started, completed); err != nil {
+			t.Fatalf("UpdateStageRunStatus failed: %v", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := stageRunStore.MarkStageRunQualityChecked(ctx, runs[1].ID); err != nil {
+		t.Fatalf("MarkStageRunQualityChecked failed: %v", err)
+	}
+
+	unchecked, err := stageRunStore.ListUncheckedStageRuns(ctx, time.Now().Add(-2*time.Minute))
+	if err != nil {
+		t.Fatalf("ListUncheckedStageRuns failed: %v", err)
+	}
+	if len(unchecked) != 0 {
+		t.Errorf("Expected runs completed since the cutoff to be left alone, got %d", len(unchecked))
+	}
+	unchecked, err = stageRunStore.ListUncheckedStageRuns(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ListUncheckedStageRuns failed: %v", err)
+	}
+	if len(unchecked) != 1 || unchecked[0].ID != runs[0].ID {
+		t.Fatalf("Expected only %s to be unchecked, got %+v", runs[0].ID, unchecked)
+	}
+
+	retrieved, err := stageRunStore.GetStageRun(ctx, runs[1].ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if !retrieved.QualityCheckedAt.Valid {
+		t.Errorf("Expected run %s to be marked quality checked", runs[1].ID)
+	}
+}
+
+func TestStageRunStore_Reviews(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	project := &Project{Name: "Review Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	started := sql.NullTime{Time: time.Now(), Valid: true}
+	var runs []*StageRun
+	for _, stage := range []struct {
+		name   string
+		review bool
+	}{{"design", true}, {"build", false}} {
+		run := &StageRun{ProjectID: project.ID, StageName: stage.name, ReviewRequired: stage.review}
+		if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+			t.Fatalf("CreateStageRun failed: %v", err)
+		}
+		for _, status := range []StageRunStatus{StageRunStatusRunning, StageRunStatusCompleted} {
+			if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, status, started, started); err != nil {
+				t.Fatalf("UpdateStageRunStatus failed: %v", err)
+			}
+		}
+		runs = append(runs, run)
+	}
+	design, build := runs[0], runs[1]
+
+	// A run is only reviewed once it has passed the quality gate.
+	pending, err := stageRunStore.ListPendingReviews(ctx, ReviewFilter{})
+	if err != nil {
+		t.Fatalf("ListPendingReviews failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected runs not yet quality checked to be left out, got %d", len(pending))
+	}
+	err = stageRunStore.ReviewStageRun(ctx, design.ID, StageRunStatusApproved, "ana", "", nil)
+	if !errors.Is(err, ErrReviewNotPending) {
+		t.Errorf("Expected ErrReviewNotPending for a run not yet quality checked, got %v", err)
+	}
+	for _, run := range runs {
+		if err := stageRunStore.MarkStageRunQualityChecked(ctx, run.ID); err != nil {
+			t.Fatalf("MarkStageRunQualityChecked failed: %v", err)
+		}
+	}
+
+	pending, err = stageRunStore.ListPendingReviews(ctx, ReviewFilter{ProjectID: uuid.NullUUID{UUID: project.ID, Valid: true}})
+	if err != nil {
+		t.Fatalf("ListPendingReviews failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != design.ID || !pending[0].ReviewRequired {
+		t.Fatalf("Expected only the design run to await review, got %+v", pending)
+	}
+
+	err = stageRunStore.ReviewStageRun(ctx, build.ID, StageRunStatusApproved, "ana", "", nil)
+	if !errors.Is(err, ErrReviewNotPending) {
+		t.Errorf("Expected ErrReviewNotPending for a run without review, got %v", err)
+	}
+	err = stageRunStore.ReviewStageRun(ctx, uuid.New(), StageRunStatusApproved, "ana", "", nil)
+	if !errors.Is(err, ErrStageRunNotFound) {
+		t.Errorf("Expected ErrStageRunNotFound for an unknown run, got %v", err)
+	}
+
+	if err := stageRunStore.ReviewStageRun(ctx, design.ID, StageRunStatusApproved, "ana", "Clear and complete.", nil); err != nil {
+		t.Fatalf("ReviewStageRun failed: %v", err)
+	}
+	err = stageRunStore.ReviewStageRun(ctx, design.ID, StageRunStatusRejected, "ben", "Too late.", nil)
+	if !errors.Is(err, ErrReviewNotPending) {
+		t.Errorf("Expected ErrReviewNotPending reviewing a decided run, got %v", err)
+	}
+
+	retrieved, err := stageRunStore.GetStageRun(ctx, design.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved.Status != StageRunStatusApproved || retrieved.ReviewedBy.String != "ana" ||
+		retrieved.ReviewComment.String != "Clear and complete." || !retrieved.ReviewedAt.Valid {
+		t.Errorf("Expected the approval to be recorded, got %+v", retrieved)
+	}
+	pending, err = stageRunStore.ListPendingReviews(ctx, ReviewFilter{})
+	if err != nil {
+		t.Fatalf("ListPendingReviews failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending reviews, got %d", len(pending))
+	}
+
+	// Rejecting with a rerun schedules a new attempt linked to the rejected one.
+	qa := &StageRun{ProjectID: project.ID, StageName: "qa", ReviewRequired: true}
+	if err := stageRunStore.CreateStageRun(ctx, qa); err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+	for _, status := range []StageRunStatus{StageRunStatusRunning, StageRunStatusCompleted} {
+		if err := stageRunStore.UpdateStageRunStatus(ctx, qa.ID, status, started, started); err != nil {
+			t.Fatalf("UpdateStageRunStatus failed: %v", err)
+		}
+	}
+	if err := stageRunStore.MarkStageRunQualityChecked(ctx, qa.ID); err != nil {
+		t.Fatalf("MarkStageRunQualityChecked failed: %v", err)
+	}
+	rerun := &StageRun{ProjectID: project.ID, StageName: "qa", ReviewRequired: true, InputContext: json.RawMessage(`{"revision": {}}`)}
+	if err := stageRunStore.ReviewStageRun(ctx, qa.ID, StageRunStatusApproved, "ana", "", rerun); err == nil {
+		t.Errorf("Expected approving with a rerun to fail")
+	}
+	if err := stageRunStore.ReviewStageRun(ctx, qa.ID, StageRunStatusRejected, "ana", "Cover the edge cases.", rerun); err != nil {
+		t.Fatalf("ReviewStageRun failed: %v", err)
+	}
+	retrieved, err = stageRunStore.GetStageRun(ctx, rerun.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved == nil || retrieved.Status != StageRunStatusPending || retrieved.PreviousRunID.UUID != qa.ID || !retrieved.ReviewRequired {
+		t.Errorf("Expected a pending rerun linked to %s, got %+v", qa.ID, retrieved)
+	}
+	retrieved, err = stageRunStore.GetStageRun(ctx, qa.ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if retrieved.Status != StageRunStatusRejected {
+		t.Errorf("Expected the reviewed run to be rejected, got %s", retrieved.Status)
+	}
+}
+
+func TestStageRunStore_RejectsIllegalTransitions(t *testing.T) {
+	clearTables(testDB)
+
+	ctx := context.Background()
+	project := &Project{Name: "Project for Transitions"}
+	err := NewProjectStore(testDB).CreateProject(ctx, project)
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	stageRunStore := NewStageRunStore(testDB)
+	stageRun := &StageRun{ProjectID: project.ID, StageName: "plan"}
+	err = stageRunStore.CreateStageRun(ctx, stageRun)
+	if err != nil {
+		t.Fatalf("CreateStageRun failed: %v", err)
+	}
+
+	err = stageRunStore.UpdateStageRunStatus(ctx, stageRun.ID, StageRunStatusApproved, sql.NullTime{}, sql.NullTime{})
+	var transitionErr *IllegalTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("Expected *IllegalTransitionError, got %v", err)
+	}
+	if transitionErr.From != StageRunStatusPending || transitionErr.To != StageRunStatusApproved {
+		t.Errorf("Unexpected transition error %+v", transitionErr)
+	}
+
+	startedAt := sql.NullTime{Time: time.Now(), Valid: true}
+	err = stageRunStore.UpdateStageRunStatus(ctx, stageRun.ID, StageRunStatusRunning, startedAt, sql.NullTime{})
+	if err != nil {
+		t.Fatalf("UpdateStageRunStatus failed: %v", err)
+	}
+	// A second worker claiming the same run loses.
+	err = stageRunStore.UpdateStageRunStatus(ctx, stageRun.ID, StageRunStatusRunning, startedAt, sql.NullTime{})
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("Expected ErrIllegalTransition, got %v", err)
+	}
+
+	err = stageRunStore.UpdateStageRunStatus(ctx, uuid.New(), StageRunStatusRunning, startedAt, sql.NullTime{})
+	if !errors.Is(err, ErrStageRunNotFound) {
+		t.Errorf("Expected ErrStageRunNotFound, got %v", err)
+	}
+
+	tests := []struct {
+		from, to StageRunStatus
+		want     bool
+	}{
+		{StageRunStatusPending, StageRunStatusRunning, true},
+		{StageRunStatusRunning, StageRunStatusCompleted, true},
+		{StageRunStatusCompleted, StageRunStatusApproved, true},
+		{StageRunStatusCompleted, StageRunStatusPending, false},
+		{StageRunStatusFailed, StageRunStatusApproved, false},
+		{StageRunStatusFailed, StageRunStatusPending, true},
+		{StageRunStatusApproved, StageRunStatusRejected, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStageRunStore_OutputPublication(t *testing.T) {
+	clearTables(testDB)
+	ctx := context.Background()
+	projectStore := NewProjectStore(testDB)
+	stageRunStore := NewStageRunStore(testDB)
+
+	project := &Project{Name: "Publishing Project"}
+	if err := projectStore.CreateProject(ctx, project); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if err := projectStore.UpdateProjectStatus(ctx, project.ID, ProjectStatusRunning, "test", "started"); err != nil {
+		t.Fatalf("UpdateProjectStatus failed: %v", err)
+	}
+
+	started := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	completed := sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	var runs []*StageRun
+	for i := 0; i < 3; i++ {
+		run := &StageRun{ProjectID: project.ID, StageName: []string{"draft", "edit", "review"}[i], ReviewRequired: i == 2}
+		if err := stageRunStore.CreateStageRun(ctx, run); err != nil {
+			t.Fatalf("CreateStageRun failed: %v", err)
+		}
+		if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusRunning, started, sql.NullTime{}); err != nil {
+			t.Fatalf("UpdateStageRunStatus failed: %v", err)
+		}
+		if err := stageRunStore.UpdateStageRunStatus(ctx, run.ID, StageRunStatusCompleted, started, completed); err != nil {
+			t.Fatalf("UpdateStageRunStatus failed: %v", err)
+		}
+		runs = append(runs, run)
+	}
+
+	unpublished, err := stageRunStore.ListUnpublishedStageRuns(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("ListUnpublishedStageRuns failed: %v", err)
+	}
+	if len(unpublished) != 0 {
+		t.Errorf("Expected runs not yet quality checked to be left alone, got %d", len(unpublished))
+	}
+
+	for _, run := range runs {
+		if err := stageRunStore.MarkStageRunQualityChecked(ctx, run.ID); err != nil {
+			t.Fatalf("MarkStageRunQualityChecked failed: %v", err)
+		}
+	}
+	if err := stageRunStore.MarkStageRunOutputsPublished(ctx, runs[1].ID); err != nil {
+		t.Fatalf("MarkStageRunOutputsPublished failed: %v", err)
+	}
+
+	unpublished, err = stageRunStore.ListUnpublishedStageRuns(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListUnpublishedStageRuns failed: %v", err)
+	}
+	if len(unpublished) != 0 {
+		t.Errorf("Expected runs changed since the cutoff to be left alone, got %d", len(unpublished))
+	}
+	unpublished, err = stageRunStore.ListUnpublishedStageRuns(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ListUnpublishedStageRuns failed: %v", err)
+	}
+	if len(unpublished) != 1 || unpublished[0].ID != runs[0].ID {
+		t.Fatalf("Expected only %s to be unpublished, got %+v", runs[0].ID, unpublished)
+	}
+
+	retrieved, err := stageRunStore.GetStageRun(ctx, runs[1].ID)
+	if err != nil {
+		t.Fatalf("GetStageRun failed: %v", err)
+	}
+	if !retrieved.OutputsPublishedAt.Valid {
+		t.Errorf("Expected run %s to be marked published", runs[1].ID)
+	}
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// stageRunTransitions lists, for each status, the statuses a stage run may
+// move to from it. Approved and rejected runs are final.
+var stageRunTransitions = map[StageRunStatus][]StageRunStatus{
+	// A pending run fails without running when its inputs cannot be assembled.
+	StageRunStatusPending: {StageRunStatusRunning, StageRunStatusFailed},
+	// A running run goes back to pending when its executor gives it up.
+	StageRunStatusRunning:   {StageRunStatusCompleted, StageRunStatusFailed, StageRunStatusPending},
+	StageRunStatusCompleted: {StageRunStatusApproved, StageRunStatusRejected},
+	// A failed run is re-queued while its stage's retry policy allows.
+	StageRunStatusFailed: {StageRunStatusPending},
+}
+
+// CanTransition reports whether a stage run may move from one status to another.
+func CanTransition(from, to StageRunStatus) bool {
+	for _, allowed := range stageRunTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusesTransitioningTo returns every status a run may reach to from.
+func statusesTransitioningTo(to StageRunStatus) []string {
+	var from []string
+	for status, targets := range stageRunTransitions {
+		for _, target := range targets {
+			if target == to {
+				from = append(from, string(status))
+			}
+		}
+	}
+	return from
+}
+
+// projectTransitions lists, for each status, the statuses a project may move
+// to from it. Completed and failed projects are final.
+var projectTransitions = map[ProjectStatus][]ProjectStatus{
+	// A created project fails without running when its workflow cannot start.
+	ProjectStatusCreated: {ProjectStatusRunning, ProjectStatusFailed},
+	ProjectStatusRunning: {ProjectStatusCompleted, ProjectStatusFailed},
+}
+
+// CanProjectTransition reports whether a project may move from one status to another.
+func CanProjectTransition(from, to ProjectStatus) bool {
+	for _, allowed := range projectTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IllegalTransitionError is returned when a stage run status change is not in
+// the transition table, including when another writer changed the status
+// first.
+type IllegalTransitionError struct {
+	StageRunID uuid.UUID
+	From       StageRunStatus
+	To         StageRunStatus
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("stage run %s cannot move from %s to %s", e.StageRunID, e.From, e.To)
+}
+
+// Is makes errors.Is(err, ErrIllegalTransition) match.
+func (e *IllegalTransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// IllegalProjectTransitionError is returned when a project status change is
+// not in the transition table.
+type IllegalProjectTransitionError struct {
+	ProjectID uuid.UUID
+	From      ProjectStatus
+	To        ProjectStatus
+}
+
+func (e *IllegalProjectTransitionError) Error() string {
+	return fmt.Sprintf("project %s cannot move from %s to %s", e.ProjectID, e.From, e.To)
+}
+
+// Is makes errors.Is(err, ErrIllegalTransition) match.
+func (e *IllegalProjectTransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type Workflow struct {
+	ID          uuid.UUID       `json:"id"`
+	Name        string          `json:"name"`
+	Description sql.NullString  `json:"description"`
+	Definition  json.RawMessage `json:"definition"` // JSONB type
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type WorkflowStore struct {
+	db *sql.DB
+}
+
+func NewWorkflowStore(db *sql.DB) *WorkflowStore {
+	return &WorkflowStore{db: db}
+}
+
+func (s *WorkflowStore) CreateWorkflow(ctx context.Context, workflow *Workflow) error {
+	workflow.ID = uuid.New()
+	workflow.CreatedAt = time.Now()
+	workflow.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO workflows (workflow_id, name, description, definition, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := s.db.ExecContext(ctx, query,
+		workflow.ID,
+		workflow.Name,
+		workflow.Description,
+		workflow.Definition,
+		workflow.CreatedAt,
+		workflow.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create workflow: %w", err)
+	}
+	return nil
+}
+
+// UpsertWorkflow creates the workflow or, if one with the same name exists,
+// replaces its description and definition. The stored ID and CreatedAt are
+// written back to workflow.
+func (s *WorkflowStore) UpsertWorkflow(ctx context.Context, workflow *Workflow) error {
+	now := time.Now()
+	query := `
+		INSERT INTO workflows (workflow_id, name, description, definition, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, definition = EXCLUDED.definition, updated_at = EXCLUDED.updated_at
+		RETURNING workflow_id, created_at, updated_at
+	`
+	err := s.db.QueryRowContext(ctx, query,
+		uuid.New(),
+		workflow.Name,
+		workflow.Description,
+		workflow.Definition,
+		now,
+	).Scan(&workflow.ID, &workflow.CreatedAt, &workflow.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to upsert workflow: %w", err)
+	}
+	return nil
+}
+
+func (s *WorkflowStore) GetWorkflow(ctx context.Context, id uuid.UUID) (*Workflow, error) {
+	return s.getWorkflow(ctx, "workflow_id", id)
+}
+
+func (s *WorkflowStore) GetWorkflowByName(ctx context.Context, name string) (*Workflow, error) {
+	return s.getWorkflow(ctx, "name", name)
+}
+
+func (s *WorkflowStore) getWorkflow(ctx context.Context, column string, value interface{}) (*Workflow, error) {
+	workflow := &Workflow{}
+	query := `
+		SELECT workflow_id, name, description, definition, created_at, updated_at
+		FROM workflows
+		WHERE ` + column + ` = $1
+	`
+	err := s.db.QueryRowContext(ctx, query, value).Scan(
+		&workflow.ID,
+		&workflow.Name,
+		&workflow.Description,
+		&workflow.Definition,
+		&workflow.CreatedAt,
+		&workflow.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Workflow not found
+		}
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+	return workflow, nil
+}
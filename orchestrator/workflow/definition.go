@@ -0,0 +1,357 @@
+package workflow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Definition describes a workflow as a DAG of stages.
+type Definition struct {
+	Name        string  `json:"name" yaml:"name"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Stages      []Stage `json:"stages" yaml:"stages"`
+}
+
+// Stage is a single node of the workflow DAG, executed by one persona.
+type Stage struct {
+	Name      string   `json:"name" yaml:"name"`
+	Persona   string   `json:"persona" yaml:"persona"`
+	DependsOn []string `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	Inputs    []Input  `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Outputs   []string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+	// OnConflict decides what happens when two direct parents publish the
+	// same output key and the stage declares no stage inputs of its own.
+	OnConflict ConflictPolicy `json:"on_conflict,omitempty" yaml:"on_conflict,omitempty"`
+	// Retry re-queues failed runs of the stage; without it a failure is final.
+	Retry *RetryPolicy `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// RequiresReview holds completed runs of the stage until a person
+	// approves them; downstream stages only start after approval.
+	RequiresReview bool `json:"requires_review,omitempty" yaml:"requires_review,omitempty"`
+}
+
+// InputSource says where an input value is read from.
+type InputSource string
+
+const (
+	// InputSourceStage reads a key from an upstream stage's output. It is the
+	// default when Source is empty.
+	InputSourceStage InputSource = "stage"
+	// InputSourceContextBus reads the latest version of a Context Bus key.
+	InputSourceContextBus InputSource = "context_bus"
+)
+
+// Input maps a key published by an upstream stage, or a Context Bus entry,
+// into this stage's input. As defaults to Key.
+type Input struct {
+	Source   InputSource `json:"source,omitempty" yaml:"source,omitempty"`
+	Stage    string      `json:"stage,omitempty" yaml:"stage,omitempty"`
+	Key      string      `json:"key" yaml:"key"`
+	As       string      `json:"as,omitempty" yaml:"as,omitempty"`
+	Optional bool        `json:"optional,omitempty" yaml:"optional,omitempty"`
+}
+
+// Name returns the key the input is exposed under.
+func (i Input) Name() string {
+	if i.As != "" {
+		return i.As
+	}
+	return i.Key
+}
+
+// FromContextBus reports whether the input is read from the Context Bus.
+func (i Input) FromContextBus() bool {
+	return i.Source == InputSourceContextBus
+}
+
+// ConflictPolicy resolves keys published by more than one parent stage.
+type ConflictPolicy string
+
+const (
+	// ConflictError fails the stage. It is the default.
+	ConflictError ConflictPolicy = "error"
+	// ConflictFirstWins keeps the value of the parent listed first in depends_on.
+	ConflictFirstWins ConflictPolicy = "first_wins"
+	// ConflictLastWins keeps the value of the parent listed last in depends_on.
+	ConflictLastWins ConflictPolicy = "last_wins"
+	// ConflictNamespace replaces the key with an object of values keyed by
+	// parent stage name.
+	ConflictNamespace ConflictPolicy = "namespace"
+)
+
+// HasStageInputs reports whether the stage maps upstream outputs explicitly
+// instead of merging everything its parents publish.
+func (s Stage) HasStageInputs() bool {
+	for _, input := range s.Inputs {
+		if !input.FromContextBus() {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError lists every problem found in a workflow definition.
+type ValidationError struct {
+	Workflow string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid workflow %q: %s", e.Workflow, strings.Join(e.Problems, "; "))
+}
+
+// Stage returns the stage with the given name.
+func (d *Definition) Stage(name string) (Stage, bool) {
+	for _, stage := range d.Stages {
+		if stage.Name == name {
+			return stage, true
+		}
+	}
+	return Stage{}, false
+}
+
+// Ancestors returns the names of every stage the named stage transitively depends on.
+func (d *Definition) Ancestors(name string) map[string]bool {
+	ancestors := make(map[string]bool)
+	var visit func(string)
+	visit = func(n string) {
+		stage, ok := d.Stage(n)
+		if !ok {
+			return
+		}
+		for _, dep := range stage.DependsOn {
+			if !ancestors[dep] {
+				ancestors[dep] = true
+				visit(dep)
+			}
+		}
+	}
+	visit(name)
+	return ancestors
+}
+
+// PersonaNames returns the distinct personas referenced by the workflow, sorted.
+func (d *Definition) PersonaNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, stage := range d.Stages {
+		if stage.Persona != "" && !seen[stage.Persona] {
+			seen[stage.Persona] = true
+			names = append(names, stage.Persona)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks the definition for structural problems, cycles, stages that
+// can never be scheduled and, when personaExists is non-nil, personas that do
+// not exist. All problems are reported together in a *ValidationError.
+func (d *Definition) Validate(personaExists func(name string) bool) error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(d.Name) == "" {
+		addf("name is required")
+	}
+	if len(d.Stages) == 0 {
+		addf("at least one stage is required")
+	}
+
+	stages := make(map[string]Stage, len(d.Stages))
+	for i, stage := range d.Stages {
+		if strings.TrimSpace(stage.Name) == "" {
+			addf("stage #%d has no name", i+1)
+			continue
+		}
+		if _, dup := stages[stage.Name]; dup {
+			addf("stage %q is defined more than once", stage.Name)
+			continue
+		}
+		stages[stage.Name] = stage
+	}
+
+	// blocked holds stages that can never become ready on their own account.
+	blocked := make(map[string]bool)
+	for _, stage := range d.Stages {
+		if stage.Name == "" {
+			continue
+		}
+		if strings.TrimSpace(stage.Persona) == "" {
+			addf("stage %q has no persona", stage.Name)
+		} else if personaExists != nil && !personaExists(stage.Persona) {
+			addf("stage %q uses unknown persona %q", stage.Name, stage.Persona)
+		}
+
+		seenDeps := make(map[string]bool)
+		for _, dep := range stage.DependsOn {
+			switch {
+			case dep == stage.Name:
+				addf("stage %q depends on itself", stage.Name)
+				blocked[stage.Name] = true
+			case seenDeps[dep]:
+				addf("stage %q lists dependency %q more than once", stage.Name, dep)
+			default:
+				if _, ok := stages[dep]; !ok {
+					addf("stage %q depends on unknown stage %q", stage.Name, dep)
+					blocked[stage.Name] = true
+				}
+			}
+			seenDeps[dep] = true
+		}
+
+		switch stage.OnConflict {
+		case "", ConflictError, ConflictFirstWins, ConflictLastWins, ConflictNamespace:
+		default:
+			addf("stage %q has unknown on_conflict policy %q", stage.Name, stage.OnConflict)
+		}
+
+		if stage.Retry != nil {
+			problems = append(problems, stage.Retry.validate(stage.Name)...)
+		}
+
+		seenOutputs := make(map[string]bool)
+		for _, output := range stage.Outputs {
+			if seenOutputs[output] {
+				addf("stage %q declares output %q more than once", stage.Name, output)
+			}
+			seenOutputs[output] = true
+		}
+	}
+
+	for _, cycle := range d.cycles(stages) {
+		addf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		for _, name := range cycle {
+			blocked[name] = true
+		}
+	}
+
+	for _, name := range d.unreachable(stages, blocked) {
+		addf("stage %q can never run because an upstream stage is invalid", name)
+	}
+
+	for _, stage := range d.Stages {
+		if stage.Name == "" {
+			continue
+		}
+		problems = append(problems, d.validateInputs(stage, stages)...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Workflow: d.Name, Problems: problems}
+	}
+	return nil
+}
+
+func (d *Definition) validateInputs(stage Stage, stages map[string]Stage) []string {
+	var problems []string
+	ancestors := d.Ancestors(stage.Name)
+	seen := make(map[string]bool)
+	for _, input := range stage.Inputs {
+		if input.Key == "" {
+			problems = append(problems, fmt.Sprintf("stage %q has an input without a key", stage.Name))
+			continue
+		}
+		if seen[input.Name()] {
+			problems = append(problems, fmt.Sprintf("stage %q maps more than one input to %q", stage.Name, input.Name()))
+		}
+		seen[input.Name()] = true
+
+		switch input.Source {
+		case InputSourceContextBus:
+			if input.Stage != "" {
+				problems = append(problems, fmt.Sprintf("stage %q reads Context Bus key %q but also names stage %q", stage.Name, input.Key, input.Stage))
+			}
+			continue
+		case "", InputSourceStage:
+		default:
+			problems = append(problems, fmt.Sprintf("stage %q input %q has unknown source %q", stage.Name, input.Key, input.Source))
+			continue
+		}
+
+		upstream, ok := stages[input.Stage]
+		if !ok || !ancestors[input.Stage] {
+			problems = append(problems, fmt.Sprintf("stage %q reads %q from %q, which is not an upstream stage", stage.Name, input.Key, input.Stage))
+			continue
+		}
+		if !contains(upstream.Outputs, input.Key) {
+			problems = append(problems, fmt.Sprintf("stage %q reads %q from %q, which does not declare that output", stage.Name, input.Key, input.Stage))
+		}
+	}
+	return problems
+}
+
+// cycles returns each dependency cycle once, in stage declaration order.
+func (d *Definition) cycles(stages map[string]Stage) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(stages))
+	var stack []string
+	var cycles [][]string
+
+	var visit func(string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range stages[name].DependsOn {
+			if dep == name {
+				continue // reported as a self-dependency
+			}
+			if _, ok := stages[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				start := len(stack) - 1
+				for stack[start] != dep {
+					start--
+				}
+				cycle := append([]string{}, stack[start:]...)
+				cycles = append(cycles, append(cycle, dep))
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+	}
+
+	for _, stage := range d.Stages {
+		if _, ok := stages[stage.Name]; ok && state[stage.Name] == unvisited {
+			visit(stage.Name)
+		}
+	}
+	return cycles
+}
+
+// unreachable returns the stages that transitively depend on a blocked stage
+// without being blocked themselves.
+func (d *Definition) unreachable(stages map[string]Stage, blocked map[string]bool) []string {
+	var names []string
+	for _, stage := range d.Stages {
+		if _, ok := stages[stage.Name]; !ok || blocked[stage.Name] {
+			continue
+		}
+		for ancestor := range d.Ancestors(stage.Name) {
+			if blocked[ancestor] {
+				names = append(names, stage.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// FormatForPath picks the definition format from a file extension.
+func FormatForPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, true
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	}
+	return "", false
+}
+
+// Parse decodes a workflow definition. Unknown fields are rejected so typos in
+// hand-written files surface immediately. The result is not validated.
+func Parse(data []byte, format Format) (*Definition, error) {
+	def := &Definition{}
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(def); err != nil {
+			return nil, fmt.Errorf("failed to parse workflow JSON: %w", err)
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(def); err != nil {
+			return nil, fmt.Errorf("failed to parse workflow YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported workflow format %q", format)
+	}
+	return def, nil
+}
+
+// LoadFile reads and parses a single workflow definition file.
+func LoadFile(path string) (*Definition, error) {
+	format, ok := FormatForPath(path)
+	if !ok {
+		return nil, fmt.Errorf("unsupported workflow file extension: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow file: %w", err)
+	}
+	def, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// LoadDir parses every .json, .yaml and .yml file in dir, sorted by file name.
+// Other files are ignored.
+func LoadDir(dir string) ([]*Definition, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow directory: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if _, ok := FormatForPath(entry.Name()); ok && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	defs := make([]*Definition, 0, len(names))
+	for _, name := range names {
+		def, err := LoadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
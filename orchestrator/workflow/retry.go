@@ -0,0 +1,166 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrorClass groups the ways a stage run can fail, so retry policies can
+// choose which failures are worth another attempt.
+type ErrorClass string
+
+const (
+	// ErrorClassProvider means the model provider returned an error.
+	ErrorClassProvider ErrorClass = "provider"
+	// ErrorClassTimeout means the model call or the run exceeded its deadline.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassInvalidOutput means the model answered with output the stage
+	// could not use.
+	ErrorClassInvalidOutput ErrorClass = "invalid_output"
+	// ErrorClassInternal covers everything else, such as database errors or
+	// a missing persona version.
+	ErrorClassInternal ErrorClass = "internal"
+)
+
+var errorClasses = map[ErrorClass]bool{
+	ErrorClassProvider:      true,
+	ErrorClassTimeout:       true,
+	ErrorClassInvalidOutput: true,
+	ErrorClassInternal:      true,
+}
+
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultMultiplier     = 2.0
+)
+
+// RetryPolicy decides whether a failed stage run is attempted again and how
+// long to wait first. Without a policy a failed run is final.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 3 allows two retries.
+	MaxAttempts    int      `json:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff Duration `json:"initial_backoff,omitempty" yaml:"initial_backoff,omitempty"`
+	MaxBackoff     Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	Multiplier     float64  `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	// Jitter spreads each delay by up to this fraction in either direction.
+	Jitter float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	// RetryOn lists the retryable error classes; empty means all of them.
+	RetryOn []ErrorClass `json:"retry_on,omitempty" yaml:"retry_on,omitempty"`
+}
+
+// Allows reports whether a run that failed with class on its attempt-th
+// attempt may be attempted again.
+func (p *RetryPolicy) Allows(attempt int, class ErrorClass) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, retryable := range p.RetryOn {
+		if retryable == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait after the attempt-th attempt failed. The
+// delay grows by Multiplier per attempt up to MaxBackoff; random must return
+// values in [0, 1) and is only used when Jitter is set.
+func (p *RetryPolicy) Backoff(attempt int, random func() float64) time.Duration {
+	initial, maxBackoff, multiplier := time.Duration(p.InitialBackoff), time.Duration(p.MaxBackoff), p.Multiplier
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	if multiplier == 0 {
+		multiplier = DefaultMultiplier
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		delay *= 1 - p.Jitter + 2*p.Jitter*random()
+	}
+	if delay > float64(maxBackoff) {
+		delay = float64(maxBackoff)
+	}
+	return time.Duration(delay)
+}
+
+func (p *RetryPolicy) validate(stage string) []string {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("stage %q retry policy: "+format, append([]interface{}{stage}, args...)...))
+	}
+
+	if p.MaxAttempts < 1 {
+		addf("max_attempts must be at least 1")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		addf("backoff durations must not be negative")
+	}
+	if p.InitialBackoff > 0 && p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		addf("initial_backoff %s exceeds max_backoff %s", p.InitialBackoff, p.MaxBackoff)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		addf("multiplier must be at least 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		addf("jitter must be between 0 and 1")
+	}
+	for _, class := range p.RetryOn {
+		if !errorClasses[class] {
+			addf("unknown error class %q", class)
+		}
+	}
+	return problems
+}
+
+// Duration is a time.Duration written as a string such as "30s" in workflow
+// files.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
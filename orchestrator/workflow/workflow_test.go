@@ -0,0 +1,323 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pipelineYAML = `
+name: feature-pipeline
+description: Plan, build and review a feature
+stages:
+  - name: plan
+    persona: architect
+    outputs: [tech_stack, risks]
+  - name: backend
+    persona: developer
+    depends_on: [plan]
+    inputs:
+      - stage: plan
+        key: tech_stack
+    outputs: [api_spec]
+  - name: frontend
+    persona: developer
+    depends_on: [plan]
+    outputs: [ui_spec]
+  - name: review
+    persona: reviewer
+    depends_on: [backend, frontend]
+    inputs:
+      - stage: backend
+        key: api_spec
+      - stage: plan
+        key: risks
+        as: known_risks
+      - source: context_bus
+        key: milestone_summary
+        optional: true
+`
+
+func knownPersonas(names ...string) func(string) bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(name string) bool { return set[name] }
+}
+
+func TestParse_YAMLAndJSON(t *testing.T) {
+	def, err := Parse([]byte(pipelineYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("Parse YAML failed: %v", err)
+	}
+	if def.Name != "feature-pipeline" {
+		t.Errorf("Expected name feature-pipeline, got %s", def.Name)
+	}
+	if len(def.Stages) != 4 {
+		t.Fatalf("Expected 4 stages, got %d", len(def.Stages))
+	}
+	review, ok := def.Stage("review")
+	if !ok {
+		t.Fatal("Stage review not found")
+	}
+	if review.Inputs[1].Name() != "known_risks" {
+		t.Errorf("Expected input alias known_risks, got %s", review.Inputs[1].Name())
+	}
+
+	jsonDef := `{"name": "single", "stages": [{"name": "only", "persona": "architect"}]}`
+	def, err = Parse([]byte(jsonDef), FormatJSON)
+	if err != nil {
+		t.Fatalf("Parse JSON failed: %v", err)
+	}
+	if len(def.Stages) != 1 || def.Stages[0].Name != "only" {
+		t.Errorf("Expected the single stage only, got %+v", def.Stages)
+	}
+}
+
+func TestParse_RejectsUnknownFields(t *testing.T) {
+	if _, err := Parse([]byte("name: x\nstages:\n  - name: a\n    persona: p\n    depends: [b]\n"), FormatYAML); err == nil {
+		t.Error("Expected YAML with unknown field to be rejected")
+	}
+	if _, err := Parse([]byte(`{"name": "x", "stage": []}`), FormatJSON); err == nil {
+		t.Error("Expected JSON with unknown field to be rejected")
+	}
+}
+
+func TestValidate_ValidPipeline(t *testing.T) {
+	def, err := Parse([]byte(pipelineYAML), FormatYAML)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := def.Validate(knownPersonas("architect", "developer", "reviewer")); err != nil {
+		t.Fatalf("Expected valid workflow, got %v", err)
+	}
+	if got := strings.Join(def.PersonaNames(), ","); got != "architect,developer,reviewer" {
+		t.Errorf("Unexpected persona names %s", got)
+	}
+}
+
+func TestValidate_ReportsProblems(t *testing.T) {
+	cases := []struct {
+		name    string
+		def     Definition
+		problem string
+	}{
+		{
+			name: "missing persona",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "ghost"},
+			}},
+			problem: `stage "a" uses unknown persona "ghost"`,
+		},
+		{
+			name: "cycle",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p"},
+				{Name: "b", Persona: "p", DependsOn: []string{"a", "c"}},
+				{Name: "c", Persona: "p", DependsOn: []string{"b"}},
+			}},
+			problem: "dependency cycle: b -> c -> b",
+		},
+		{
+			name: "downstream of cycle is unreachable",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", DependsOn: []string{"b"}},
+				{Name: "b", Persona: "p", DependsOn: []string{"a"}},
+				{Name: "c", Persona: "p", DependsOn: []string{"b"}},
+			}},
+			problem: `stage "c" can never run`,
+		},
+		{
+			name: "unknown dependency",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", DependsOn: []string{"missing"}},
+				{Name: "b", Persona: "p", DependsOn: []string{"a"}},
+			}},
+			problem: `stage "b" can never run`,
+		},
+		{
+			name: "duplicate stage",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p"},
+				{Name: "a", Persona: "p"},
+			}},
+			problem: `stage "a" is defined more than once`,
+		},
+		{
+			name: "input from non-upstream stage",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", Outputs: []string{"x"}},
+				{Name: "b", Persona: "p", Inputs: []Input{{Stage: "a", Key: "x"}}},
+			}},
+			problem: `which is not an upstream stage`,
+		},
+		{
+			name: "input of undeclared output",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p"},
+				{Name: "b", Persona: "p", DependsOn: []string{"a"}, Inputs: []Input{{Stage: "a", Key: "x"}}},
+			}},
+			problem: `which does not declare that output`,
+		},
+		{
+			name: "context bus input naming a stage",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", Inputs: []Input{{Source: InputSourceContextBus, Stage: "a", Key: "x"}}},
+			}},
+			problem: `reads Context Bus key "x" but also names stage "a"`,
+		},
+		{
+			name: "unknown conflict policy",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", OnConflict: "coin_flip"},
+			}},
+			problem: `unknown on_conflict policy "coin_flip"`,
+		},
+		{
+			name: "retry policy without attempts",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", Retry: &RetryPolicy{}},
+			}},
+			problem: `stage "a" retry policy: max_attempts must be at least 1`,
+		},
+		{
+			name: "retry on unknown error class",
+			def: Definition{Name: "w", Stages: []Stage{
+				{Name: "a", Persona: "p", Retry: &RetryPolicy{MaxAttempts: 2, RetryOn: []ErrorClass{"gremlins"}}},
+			}},
+			problem: `unknown error class "gremlins"`,
+		},
+		{
+			name:    "no stages",
+			def:     Definition{Name: "w"},
+			problem: "at least one stage is required",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.def.Validate(knownPersonas("p"))
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Expected ValidationError, got %v", err)
+			}
+			if !strings.Contains(verr.Error(), tc.problem) {
+				t.Errorf("Expected problem %q, got %v", tc.problem, verr.Problems)
+			}
+		})
+	}
+}
+
+func TestParse_RetryPolicy(t *testing.T) {
+	yamlDef := `
+name: w
+stages:
+  - name: a
+    persona: p
+    retry:
+      max_attempts: 3
+      initial_backoff: 2s
+      max_backoff: 1m
+      retry_on: [provider, timeout]
+`
+	def, err := Parse([]byte(yamlDef), FormatYAML)
+	if err != nil {
+		t.Fatalf("Parse YAML failed: %v", err)
+	}
+	retry := def.Stages[0].Retry
+	if retry == nil || retry.MaxAttempts != 3 || time.Duration(retry.InitialBackoff) != 2*time.Second || time.Duration(retry.MaxBackoff) != time.Minute {
+		t.Fatalf("Unexpected retry policy %+v", retry)
+	}
+
+	data, err := json.Marshal(def)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"initial_backoff":"2s"`) {
+		t.Errorf("Expected durations marshalled as strings, got %s", data)
+	}
+	roundTrip, err := Parse(data, FormatJSON)
+	if err != nil {
+		t.Fatalf("Parse JSON failed: %v", err)
+	}
+	if got := roundTrip.Stages[0].Retry; got.MaxBackoff != retry.MaxBackoff || len(got.RetryOn) != 2 {
+		t.Errorf("Expected retry policy to survive a round trip, got %+v", got)
+	}
+
+	if _, err := Parse([]byte(`{"name": "w", "stages": [{"name": "a", "persona": "p", "retry": {"max_attempts": 2, "max_backoff": 60}}]}`), FormatJSON); err == nil {
+		t.Error("Expected a numeric duration to be rejected")
+	}
+}
+
+func TestRetryPolicy_Allows(t *testing.T) {
+	var none *RetryPolicy
+	if none.Allows(1, ErrorClassProvider) {
+		t.Error("Expected no retries without a policy")
+	}
+
+	policy := &RetryPolicy{MaxAttempts: 3, RetryOn: []ErrorClass{ErrorClassProvider, ErrorClassTimeout}}
+	if !policy.Allows(1, ErrorClassTimeout) || !policy.Allows(2, ErrorClassProvider) {
+		t.Error("Expected retryable classes to be retried before the last attempt")
+	}
+	if policy.Allows(3, ErrorClassProvider) {
+		t.Error("Expected no retry after the last attempt")
+	}
+	if policy.Allows(1, ErrorClassInvalidOutput) {
+		t.Error("Expected classes outside retry_on not to be retried")
+	}
+	if !(&RetryPolicy{MaxAttempts: 2}).Allows(1, ErrorClassInternal) {
+		t.Error("Expected an empty retry_on to retry every class")
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 10, InitialBackoff: Duration(time.Second), MaxBackoff: Duration(10 * time.Second)}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second} {
+		if got := policy.Backoff(attempt, nil); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	if got := policy.Backoff(2, func() float64 { return 0 }); got != time.Second {
+		t.Errorf("Expected lowest jitter to halve the delay, got %s", got)
+	}
+	if got := policy.Backoff(2, func() float64 { return 0.5 }); got != 2*time.Second {
+		t.Errorf("Expected middle jitter to keep the delay, got %s", got)
+	}
+
+	defaults := &RetryPolicy{MaxAttempts: 2}
+	if got := defaults.Backoff(1, nil); got != DefaultInitialBackoff {
+		t.Errorf("Expected default initial backoff, got %s", got)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.yaml":    pipelineYAML,
+		"a.json":    `{"name": "single", "stages": [{"name": "only", "persona": "architect"}]}`,
+		"notes.txt": "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	defs, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	if len(defs) != 2 {
+		t.Fatalf("Expected 2 definitions, got %d", len(defs))
+	}
+	if defs[0].Name != "single" || defs[1].Name != "feature-pipeline" {
+		t.Errorf("Unexpected load order: %s, %s", defs[0].Name, defs[1].Name)
+	}
+}
@@ -0,0 +1,10 @@
+#!/bin/sh
+# Applies the Flyway-style migrations in version order. The entrypoint runs
+# /docker-entrypoint-initdb.d alphabetically, which would put V10 before V2.
+set -e
+
+cd /migrations
+for migration in $(ls V*__*.sql | sort -n -k1.2); do
+    echo "Applying $migration"
+    psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" -f "$migration"
+done